@@ -0,0 +1,29 @@
+//go:build linux
+
+package wpool
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const maxAffinityCPU = 1024
+
+// setAffinity pins the current OS thread to the CPU
+func setAffinity(cpu int) error {
+	if cpu < 0 || cpu >= maxAffinityCPU {
+		return fmt.Errorf("wpool: invalid cpu %d", cpu)
+	}
+
+	var mask [maxAffinityCPU / 64]uint64
+	mask[cpu/64] |= 1 << (cpu % 64)
+
+	// pid 0 is the calling thread
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return fmt.Errorf("wpool: set affinity to cpu %d: %w", cpu, errno)
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build linux
+
+package wpool
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestCPUAffinity(t *testing.T) {
+	handler := func(r int) uint64 {
+		var mask [maxAffinityCPU / 64]uint64
+		_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, uintptr(len(mask)*8), uintptr(unsafe.Pointer(&mask)))
+		if errno != 0 {
+			return 0
+		}
+		return mask[0]
+	}
+
+	wp := New[int, uint64](handler, &Options{
+		CPUAffinity: []int{0},
+		OnAffinityError: func(err error) {
+			t.Errorf("unexpected affinity error %v", err)
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go(1)
+	g.Go(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp := g.Wait(ctx, nil)
+	if len(resp) != 2 {
+		t.Fatalf("expect 2 responses, got %d", len(resp))
+	}
+	for _, mask := range resp {
+		if mask != 1 {
+			t.Fatalf("expect worker pinned to cpu 0, got mask %b", mask)
+		}
+	}
+}
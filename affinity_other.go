@@ -0,0 +1,12 @@
+//go:build !linux
+
+package wpool
+
+import (
+	"errors"
+)
+
+// setAffinity is supported on Linux only
+func setAffinity(int) error {
+	return errors.New("wpool: cpu affinity is not supported on this platform")
+}
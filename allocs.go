@@ -0,0 +1,63 @@
+package wpool
+
+import (
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+)
+
+// allocSampler measures heap allocations of every n-th task, see Options.KindAllocSampling
+type allocSampler struct {
+	every int64
+	count int64
+
+	samples sync.Pool // *[2]metrics.Sample, reused to not allocate while measuring
+}
+
+func newAllocSampler(every int) *allocSampler {
+	return &allocSampler{
+		every: int64(every),
+		samples: sync.Pool{New: func() any {
+			return &[2]metrics.Sample{
+				{Name: "/gc/heap/allocs:bytes"},
+				{Name: "/gc/heap/allocs:objects"},
+			}
+		}},
+	}
+}
+
+// sample reports whether the next task is sampled
+func (a *allocSampler) sample() bool {
+	return (atomic.AddInt64(&a.count, 1)-1)%a.every == 0
+}
+
+// read returns the cumulative heap allocations of the process
+func (a *allocSampler) read() (bytes, objects uint64) {
+	s := a.samples.Get().(*[2]metrics.Sample)
+	metrics.Read(s[:])
+	if s[0].Value.Kind() == metrics.KindUint64 {
+		bytes = s[0].Value.Uint64()
+	}
+	if s[1].Value.Kind() == metrics.KindUint64 {
+		objects = s[1].Value.Uint64()
+	}
+	a.samples.Put(s)
+	return bytes, objects
+}
+
+// startAllocs starts measuring heap allocations of the task, if it is sampled
+func (w *Pool[Req, Resp]) startAllocs(t *task[Req, Resp]) {
+	if w.allocs != nil && w.allocs.sample() {
+		t.allocSampled = true
+		t.allocBytes, t.allocObjects = w.allocs.read()
+	}
+}
+
+// stopAllocs records heap allocations of the sampled task by its kind
+func (w *Pool[Req, Resp]) stopAllocs(t *task[Req, Resp]) {
+	if !t.allocSampled {
+		return
+	}
+	bytes, objects := w.allocs.read()
+	w.kinds.recordAllocs(t.kind, int64(bytes-t.allocBytes), int64(objects-t.allocObjects))
+}
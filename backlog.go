@@ -0,0 +1,45 @@
+package wpool
+
+// SetCompaction sets the compaction of the results backlog, e.g. for monitoring workloads, where only aggregates
+// matter, if the consumer falls behind. When more than n results are delivered, but not received by Wait,
+// and nobody waits, responses of succeeded tasks are replaced by responses returned by fn, e.g. by the sum of them.
+// Errors and dropped tasks are kept. fn is called under the group lock, so it must not use the group,
+// and it should return much less than n responses. Compacted responses have Index -1 in Result, see WaitResults.
+// n <= 0 or nil fn disables the compaction, default disabled. Set the compaction before submitting tasks.
+func (g *Group[Req, Resp]) SetCompaction(n int, fn func([]Resp) []Resp) {
+	g.mu.Lock()
+	g.backlogLimit = n
+	g.backlogCompact = fn
+	g.mu.Unlock()
+}
+
+// compactBacklog compacts not received results, if the backlog is over the limit, guarded by mu.
+// Results are not compacted while there are waiters, because they read the results buffer without the lock.
+func (g *Group[Req, Resp]) compactBacklog() {
+	if g.backlogCompact == nil || g.backlogLimit <= 0 || len(g.wakers) > 0 || len(g.results)-g.consumed <= g.backlogLimit {
+		return
+	}
+	g.compact()
+
+	var resps []Resp
+	n := 0
+	for _, r := range g.results {
+		if r.dropped || r.err != nil || r.empty {
+			g.results[n] = r
+			n++
+			continue
+		}
+		resps = append(resps, r.resp)
+		if r.index >= 0 {
+			g.setReceived(r.index)
+		}
+	}
+	for i := n; i < len(g.results); i++ {
+		g.results[i] = result[Req, Resp]{}
+	}
+	g.results = g.results[:n]
+
+	for _, resp := range g.backlogCompact(resps) {
+		g.results = append(g.results, result[Req, Resp]{resp: resp, index: -1, call: -1})
+	}
+}
@@ -0,0 +1,167 @@
+package wpool
+
+import (
+	"context"
+	"testing"
+)
+
+func benchmarkRoundTrip(b *testing.B, opts *Options) {
+	handler := func(r int) int {
+		return r * 2
+	}
+
+	wp := New[int, int](handler, opts)
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	ctx := context.Background()
+	resp := make([]int, 0, 1)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		g.Go(i)
+		resp = g.Wait(ctx, resp[:0])
+	}
+}
+
+func BenchmarkRoundTrip(b *testing.B) {
+	benchmarkRoundTrip(b, nil)
+}
+
+func BenchmarkRoundTripSpin(b *testing.B) {
+	benchmarkRoundTrip(b, &Options{
+		SpinIterations: 100,
+	})
+}
+
+func BenchmarkGroup(b *testing.B) {
+	benchmarkGroup(b, 10, nil)
+}
+
+// BenchmarkSmallGroup runs small groups in the saturated pool
+func BenchmarkSmallGroup(b *testing.B) {
+	benchmarkGroup(b, 2, &Options{
+		WorkersLimitMax: 2,
+	})
+}
+
+func BenchmarkSmallGroupInline(b *testing.B) {
+	benchmarkGroup(b, 2, &Options{
+		WorkersLimitMax: 2,
+		InlineLastTask:  true,
+	})
+}
+
+func benchmarkGroup(b *testing.B, size int, opts *Options) {
+	handler := func(r int) int {
+		return r * 2
+	}
+
+	wp := New[int, int](handler, opts)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		resp := make([]int, 0, size)
+		for pb.Next() {
+			g := wp.AcquireGroup()
+			for i := 0; i < size; i++ {
+				g.Go(i)
+			}
+			resp = g.Wait(ctx, resp[:0])
+			wp.ReleaseGroup(g)
+		}
+	})
+}
+
+// largeReq is a large value request
+type largeReq struct {
+	id      int
+	payload [1024]byte
+}
+
+func benchmarkLargeValue(b *testing.B, typed *TypedOptions[largeReq, int], submit func(g *Group[largeReq, int], req *largeReq)) {
+	handler := func(r largeReq) int {
+		return r.id + int(r.payload[0])
+	}
+
+	wp := New[largeReq, int](handler, nil, typed)
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	ctx := context.Background()
+	resp := make([]int, 0, 16)
+	var req largeReq
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		req.id = i
+		submit(g, &req)
+		if i%16 == 15 {
+			resp = g.Wait(ctx, resp[:0])
+		}
+	}
+	g.Wait(ctx, resp[:0])
+}
+
+func BenchmarkLargeValueGo(b *testing.B) {
+	benchmarkLargeValue(b, nil, func(g *Group[largeReq, int], req *largeReq) {
+		g.Go(*req)
+	})
+}
+
+func BenchmarkLargeValueGoValue(b *testing.B) {
+	benchmarkLargeValue(b, nil, func(g *Group[largeReq, int], req *largeReq) {
+		g.GoValue(req)
+	})
+}
+
+// BenchmarkLargeValueInterceptors passes the large value request through interceptors and the middleware
+func BenchmarkLargeValueInterceptors(b *testing.B) {
+	benchmarkLargeValue(b, &TypedOptions[largeReq, int]{
+		Interceptors: []func(req largeReq) (largeReq, error){
+			func(req largeReq) (largeReq, error) {
+				req.payload[0]++
+				return req, nil
+			},
+		},
+		Middleware: []Middleware[largeReq, int]{
+			func(next Handler[largeReq, int]) Handler[largeReq, int] {
+				return func(ctx context.Context, req largeReq) (int, error) {
+					return next(ctx, req)
+				}
+			},
+		},
+	}, func(g *Group[largeReq, int], req *largeReq) {
+		g.GoValue(req)
+	})
+}
+
+// BenchmarkVoidGroup runs groups of VoidPool, compare with BenchmarkGroup:
+// results of void tasks are counted by the group, but not stored
+func BenchmarkVoidGroup(b *testing.B) {
+	wp := NewVoid[int](func(r int) {}, nil)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			g := wp.AcquireGroup()
+			for i := 0; i < 10; i++ {
+				g.Go(i)
+			}
+			_ = g.Wait(ctx)
+			wp.ReleaseGroup(g)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package wpool
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Deadline returns the deadline of the group, see GroupOptions.Deadline and AcquireGroupContext.
+// It is the latency budget of the group tasks: it bounds their deadlines, see TypedOptions.DeadlineFunc,
+// so the handler context of the task has it, and a stage of the pipeline may pass the remaining budget
+// to the next pool with AcquireGroupContext, instead of applying its own timeout.
+func (g *Group[Req, Resp]) Deadline() (time.Time, bool) {
+	return g.deadline, !g.deadline.IsZero()
+}
+
+// taskDeadline returns the deadline of the task bounded by the group deadline, zero if both are zero
+func (g *Group[Req, Resp]) taskDeadline(deadline time.Time) time.Time {
+	if !g.deadline.IsZero() && (deadline.IsZero() || g.deadline.Before(deadline)) {
+		return g.deadline
+	}
+	return deadline
+}
+
+// expireOverdue expires the group, if its deadline is exceeded, before the timer does it,
+// so the queued task dropped by the deadline is passed to TypedOptions.DeadLetter
+func (g *Group[Req, Resp]) expireOverdue(now time.Time) {
+	if !g.deadline.IsZero() && !g.deadline.After(now) {
+		g.expire()
+	}
+}
+
+// stopWithContext cancels the group, when the context is done, or expires it at the context deadline
+func (g *Group[Req, Resp]) stopWithContext(ctx context.Context) {
+	g.stopCtx = context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			g.expire()
+			return
+		}
+		g.cancel()
+	})
+}
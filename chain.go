@@ -0,0 +1,95 @@
+package wpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Pipeline is two pools chained with Chain: responses of the first pool are requests of the second one.
+// Each stage scales its workers independently, see Options.
+type Pipeline[Req any, Mid any, Resp any] struct {
+	first  *Pool[Req, Mid]
+	second *Pool[Mid, Resp]
+}
+
+// Chain chains the pools into the pipeline. A response of the first pool is submitted to the second pool
+// by the worker of the first pool, which completed the task, so if the second pool is saturated,
+// workers of the first pool wait for it, and `group.Go` of the pipeline blocks, when the first pool is saturated too.
+func Chain[Req any, Mid any, Resp any](first *Pool[Req, Mid], second *Pool[Mid, Resp]) *Pipeline[Req, Mid, Resp] {
+	return &Pipeline[Req, Mid, Resp]{first: first, second: second}
+}
+
+// AcquireGroup acquires the new group of the pipeline, it consists of groups of both pools.
+// You should call ReleaseGroup after `group.Wait` is done.
+func (p *Pipeline[Req, Mid, Resp]) AcquireGroup() *PipelineGroup[Req, Mid, Resp] {
+	g := &PipelineGroup[Req, Mid, Resp]{
+		first:  p.first.AcquireGroup(),
+		second: p.second.AcquireGroup(),
+	}
+	// workers of the first pool submit to the second one concurrently, a saturated second stage blocks only them
+	g.first.OnResult(g.next)
+	g.first.concurrent = true
+	return g
+}
+
+// ReleaseGroup releases groups of both pools. You must not use the group after calling ReleaseGroup.
+func (p *Pipeline[Req, Mid, Resp]) ReleaseGroup(g *PipelineGroup[Req, Mid, Resp]) {
+	p.first.ReleaseGroup(g.first)
+	p.second.ReleaseGroup(g.second)
+}
+
+// PipelineGroup is the group of tasks passing both stages of the pipeline, see Pipeline.AcquireGroup
+type PipelineGroup[Req any, Mid any, Resp any] struct {
+	first  *Group[Req, Mid]
+	second *Group[Mid, Resp]
+
+	mu   sync.Mutex
+	errs []error // rejections of the second stage
+}
+
+// next submits the response of the first stage to the second one, it is called by workers of the first pool
+func (g *PipelineGroup[Req, Mid, Resp]) next(mid Mid) {
+	if err := g.second.Submit(mid); err != nil {
+		g.mu.Lock()
+		g.errs = append(g.errs, err)
+		g.mu.Unlock()
+	}
+}
+
+// Go runs the task in the pipeline, see Group.Go
+func (g *PipelineGroup[Req, Mid, Resp]) Go(req Req) {
+	g.first.Go(req)
+}
+
+// Submit runs the task in the pipeline like Go, but returns an error, if the first stage rejects it, see Group.Submit
+func (g *PipelineGroup[Req, Mid, Resp]) Submit(req Req) error {
+	return g.first.Submit(req)
+}
+
+// Wait waits for all submitted tasks to pass both stages or the context is done, like Group.Wait.
+// Tasks failed or dropped at any stage have no response.
+func (g *PipelineGroup[Req, Mid, Resp]) Wait(ctx context.Context, dest []Resp) []Resp {
+	g.first.Wait(ctx, nil)
+	return g.second.Wait(ctx, dest)
+}
+
+// WaitErr waits like Wait, but returns responses of succeeded tasks only and errors of both stages,
+// including rejections of the second stage, joined with errors.Join, see Group.WaitErr
+func (g *PipelineGroup[Req, Mid, Resp]) WaitErr(ctx context.Context, dest []Resp) ([]Resp, error) {
+	_, err1 := g.first.WaitErr(ctx, nil)
+	dest, err2 := g.second.WaitErr(ctx, dest)
+
+	g.mu.Lock()
+	errs := append([]error{err1, err2}, g.errs...)
+	g.errs = nil
+	g.mu.Unlock()
+
+	return dest, errors.Join(errs...)
+}
+
+// Cancel cancels groups of both stages, see Group.Cancel
+func (g *PipelineGroup[Req, Mid, Resp]) Cancel() {
+	g.first.Cancel()
+	g.second.Cancel()
+}
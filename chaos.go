@@ -0,0 +1,91 @@
+package wpool
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Chaos is a fault injection configuration for tests.
+// It allows to check how an application handles slow, failed and lost tasks.
+type Chaos[Req any, Resp any] struct {
+	// LatencyRate is a fraction of tasks delayed by Latency before the handler call, from 0 to 1
+	LatencyRate float64
+	Latency     time.Duration
+
+	// FailureRate is a fraction of tasks, for which Failure is called instead of the handler, from 0 to 1
+	FailureRate float64
+	Failure     func(Req) Resp
+
+	// CrashRate is a fraction of tasks, which crash the worker, from 0 to 1.
+	// The task is dropped without a response, and the worker stops.
+	CrashRate float64
+
+	// Seed is a seed for the random generator, default is the current time
+	Seed int64
+}
+
+type chaos[Req any, Resp any] struct {
+	cfg Chaos[Req, Resp]
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newChaos[Req any, Resp any](cfg Chaos[Req, Resp]) *chaos[Req, Resp] {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &chaos[Req, Resp]{
+		cfg: cfg,
+		rnd: rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (c *chaos[Req, Resp]) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	v := c.rnd.Float64()
+	c.mu.Unlock()
+	return v < rate
+}
+
+// wrap returns the handler with injected latency and failures
+func (c *chaos[Req, Resp]) wrap(handler handlerFunc[Req, Resp]) handlerFunc[Req, Resp] {
+	return func(ctx context.Context, req *Req, attempt int, scratch any, emit func(Resp)) (Resp, error) {
+		if c.roll(c.cfg.LatencyRate) {
+			time.Sleep(c.cfg.Latency)
+		}
+		if c.cfg.Failure != nil && c.roll(c.cfg.FailureRate) {
+			return c.cfg.Failure(*req), nil
+		}
+		return handler(ctx, req, attempt, scratch, emit)
+	}
+}
+
+func (c *chaos[Req, Resp]) crash() bool {
+	return c.roll(c.cfg.CrashRate)
+}
+
+// crashWorker drops the task and removes the crashed worker from the pool.
+// If the workers count drops below the min limit, a new worker is started.
+func (w *Pool[Req, Resp]) crashWorker(wk *worker[Req, Resp], t *task[Req, Resp]) {
+	w.mu.Lock()
+	w.releaseBudget(wk)
+	if !wk.stuck && atomic.LoadInt64(&w.workersCount) <= w.workersLimitMin {
+		w.spawnWorker(nil, false)
+	} else {
+		w.releaseWorker(wk)
+		w.checkDrained()
+	}
+	w.mu.Unlock()
+
+	w.traceDecision(ReasonDropped)
+	t.deliver(result[Req, Resp]{req: t.req, index: t.index, dropped: true})
+	w.releaseTask(t)
+}
@@ -0,0 +1,86 @@
+package wpool
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// coalescer holds tasks for the window and merges tasks with the same key into them, see Options.CoalesceWindow
+type coalescer[Req any, Resp any] struct {
+	window time.Duration
+	key    func(Req) string
+	merge  func(held, req Req) Req
+
+	mu   sync.Mutex
+	held map[string]*task[Req, Resp]
+}
+
+// coalesced is the task merged into the held task, it receives the result of the held one.
+// The shared task is joined to the in-flight task, see TypedOptions.DedupKey.
+type coalesced[Req any, Resp any] struct {
+	group  *Group[Req, Resp]
+	req    Req
+	index  int
+	call   int
+	shared bool
+}
+
+func (m coalesced[Req, Resp]) deliver(r result[Req, Resp]) {
+	r.req, r.index, r.call, r.shared = m.req, m.index, m.call, m.shared
+	m.group.deliver(r)
+}
+
+// coalesce holds the task for the window, or merges it into the held task with the same key.
+// Reports false, if the task has no key and must be submitted as usual.
+func (w *Pool[Req, Resp]) coalesce(t *task[Req, Resp]) bool {
+	c := w.coalescer
+	key := c.key(t.req)
+	if key == "" {
+		return false
+	}
+
+	c.mu.Lock()
+	if held := c.held[key]; held != nil {
+		if c.merge != nil {
+			held.req = c.merge(held.req, t.req)
+		}
+		held.coalesced = append(held.coalesced, coalesced[Req, Resp]{group: t.group, req: t.req, index: t.group.acceptIndex(), call: t.call})
+		c.mu.Unlock()
+		w.traceDecision(ReasonCoalesced)
+		w.releaseTask(t)
+		return true
+	}
+	c.held[key] = t
+	c.mu.Unlock()
+
+	// the held task is counted as a submission in progress, so Wait waits for it
+	g := t.group
+	g.mu.Lock()
+	g.submitting++
+	g.mu.Unlock()
+
+	time.AfterFunc(c.window, func() {
+		w.submitHeld(key, t)
+	})
+	return true
+}
+
+// submitHeld submits the held task at the end of the window. If the task is rejected,
+// the error is delivered to the group of the held task and to groups of the merged tasks.
+func (w *Pool[Req, Resp]) submitHeld(key string, t *task[Req, Resp]) {
+	c := w.coalescer
+	c.mu.Lock()
+	delete(c.held, key)
+	merged := slices.Clone(t.coalesced)
+	c.mu.Unlock()
+
+	g, req, call := t.group, t.req, t.call
+	if err := w.task(t); err != nil {
+		coalesced[Req, Resp]{group: g, req: req, index: g.acceptIndex(), call: call}.deliver(result[Req, Resp]{err: err})
+		for _, m := range merged {
+			m.deliver(result[Req, Resp]{err: err})
+		}
+	}
+	g.submitted()
+}
@@ -0,0 +1,31 @@
+package wpool
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Codec encodes and decodes values of type T
+type Codec[T any] interface {
+	Encode(v T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// GobCodec is a Codec based on encoding/gob
+type GobCodec[T any] struct{}
+
+// Encode encodes the value with gob
+func (GobCodec[T]) Encode(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the value with gob
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
@@ -0,0 +1,58 @@
+package wpool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// defaultConcurrencyInterval is a default interval of Options.ConcurrencyFunc calls
+const defaultConcurrencyInterval = time.Second
+
+// overLimit reports whether the count of busy workers with extra workers exceeds the concurrency limit,
+// see Options.ConcurrencyFunc. It must be called under the mutex.
+func (w *Pool[Req, Resp]) overLimit(extra int64) bool {
+	if w.concurrencyFunc == nil {
+		return false
+	}
+	busy := atomic.LoadInt64(&w.workersCount) - int64(len(w.idle))
+	return busy+extra > atomic.LoadInt64(&w.concurrency)
+}
+
+// concurrencyLimit calls Options.ConcurrencyFunc, the limit is at least 1
+func (w *Pool[Req, Resp]) concurrencyLimit() int64 {
+	n := int64(w.concurrencyFunc())
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// watchConcurrency updates the concurrency limit until the pool shutdown.
+// When the limit grows, idle workers are woken up to take queued tasks.
+func (w *Pool[Req, Resp]) watchConcurrency(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		limit := w.concurrencyLimit()
+		prev := atomic.SwapInt64(&w.concurrency, limit)
+		for i := prev; i < limit; i++ {
+			w.kick()
+		}
+	}
+}
+
+// ConcurrencyLimit returns the current limit of busy workers, see Options.ConcurrencyFunc.
+// Returns 0, if the pool has no ConcurrencyFunc.
+func (w *Pool[Req, Resp]) ConcurrencyLimit() int {
+	if w.concurrencyFunc == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&w.concurrency))
+}
@@ -0,0 +1,47 @@
+package wpool
+
+import (
+	"context"
+	"errors"
+)
+
+// Consume executes requests received from in and sends responses of succeeded tasks to out in the completion order,
+// until in is closed or the context is done, so the pool can be a stage of a channel pipeline.
+// Workers wait for out to receive responses, so a slow receiver slows down the stage, and the stage waits
+// for the pool to accept requests, see `group.Submit`. Errors and dropped tasks are discarded, rejected requests
+// are skipped. Consume returns, when all accepted tasks are done and no response is sent to out anymore,
+// so out can be closed then. It returns the context error, or ErrPoolClosed, if the pool is closed.
+func (w *Pool[Req, Resp]) Consume(ctx context.Context, in <-chan Req, out chan<- Resp) error {
+	g := w.AcquireGroupContext(ctx)
+	defer w.ReleaseGroup(g)
+	g.discard = true
+	g.OnResult(func(resp Resp) {
+		select {
+		case out <- resp:
+		case <-ctx.Done():
+		}
+	})
+
+	var err error
+loop:
+	for {
+		select {
+		case req, ok := <-in:
+			if !ok {
+				break loop
+			}
+			if e := g.Submit(req); errors.Is(e, ErrPoolClosed) {
+				err = e
+				break loop
+			}
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	<-g.settled()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package wpool
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// dedup joins tasks to the in-flight task with the same key, see TypedOptions.DedupKey
+type dedup[Req any, Resp any] struct {
+	key func(Req) string
+
+	mu       sync.Mutex
+	inflight map[string]*task[Req, Resp]
+}
+
+// join joins the task to the in-flight task with the same key, the task is released then.
+// Otherwise, the key is set to the task, and it becomes in-flight, when it is accepted by the group.
+// Reports false, if the task must be submitted as usual.
+func (w *Pool[Req, Resp]) join(t *task[Req, Resp]) bool {
+	d := w.dedup
+	key := d.key(t.req)
+	if key == "" {
+		return false
+	}
+
+	d.mu.Lock()
+	leader := d.inflight[key]
+	if leader == nil {
+		d.mu.Unlock()
+		t.dedupKey = key
+		return false
+	}
+	leader.joined = append(leader.joined, coalesced[Req, Resp]{group: t.group, req: t.req, index: t.group.acceptIndex(), call: t.call, shared: true})
+	d.mu.Unlock()
+
+	atomic.AddInt64(&w.counters.deduplicated, 1)
+	w.traceDecision(ReasonDeduplicated)
+	w.releaseTask(t)
+	return true
+}
+
+// inFlight makes the accepted task in-flight, unless another task with the same key is in-flight already
+func (d *dedup[Req, Resp]) inFlight(t *task[Req, Resp]) {
+	d.mu.Lock()
+	if d.inflight[t.dedupKey] == nil {
+		d.inflight[t.dedupKey] = t
+	} else {
+		t.dedupKey = ""
+	}
+	d.mu.Unlock()
+}
+
+// finish removes the done task from in-flight tasks and returns tasks joined to it
+func (d *dedup[Req, Resp]) finish(t *task[Req, Resp]) []coalesced[Req, Resp] {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.inflight[t.dedupKey] == t {
+		delete(d.inflight, t.dedupKey)
+	}
+	t.dedupKey = ""
+	joined := t.joined
+	t.joined = nil
+	return joined
+}
@@ -0,0 +1,102 @@
+package wpool
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDeprecationInterval is a default interval of Options.OnDeprecatedKind calls per kind
+const defaultDeprecationInterval = time.Minute
+
+// poolMethodPrefix is a prefix of functions of the pool and group methods, they are skipped in the caller attribution
+const poolMethodPrefix = "github.com/negasus/wpool.(*"
+
+// DeprecationInfo is the submission of the task of the deprecated kind, see Options.DeprecatedKinds
+type DeprecationInfo struct {
+	// Kind is the deprecated kind
+	Kind string
+	// Message is the deprecation message from Options.DeprecatedKinds, e.g. the replacement
+	Message string
+	// Caller is the function, file and line, which submitted the task
+	Caller string
+	// Suppressed is a count of submissions of the kind since the previous call, which are not reported
+	Suppressed int64
+}
+
+// deprecations reports submissions of deprecated kinds, at most one per kind per interval
+type deprecations struct {
+	kinds    map[string]string
+	interval time.Duration
+	report   func(DeprecationInfo)
+
+	mu    sync.Mutex
+	state map[string]*deprecationState
+}
+
+type deprecationState struct {
+	last       time.Time
+	suppressed int64
+}
+
+func newDeprecations(kinds map[string]string, interval time.Duration, report func(DeprecationInfo)) *deprecations {
+	if interval <= 0 {
+		interval = defaultDeprecationInterval
+	}
+	d := &deprecations{
+		kinds:    make(map[string]string, len(kinds)),
+		interval: interval,
+		report:   report,
+		state:    make(map[string]*deprecationState, len(kinds)),
+	}
+	for k, v := range kinds {
+		d.kinds[k] = v
+		d.state[k] = &deprecationState{}
+	}
+	return d
+}
+
+// check reports the submission of the task of the kind, if the kind is deprecated and the interval is passed
+func (d *deprecations) check(kind string) {
+	msg, ok := d.kinds[kind]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	s := d.state[kind]
+	if !s.last.IsZero() && now.Sub(s.last) < d.interval {
+		s.suppressed++
+		d.mu.Unlock()
+		return
+	}
+	suppressed := s.suppressed
+	s.last, s.suppressed = now, 0
+	d.mu.Unlock()
+
+	d.report(DeprecationInfo{
+		Kind:       kind,
+		Message:    msg,
+		Caller:     caller(),
+		Suppressed: suppressed,
+	})
+}
+
+// caller returns the first function outside of the pool and group methods in the stack
+func caller() string {
+	var pcs [32]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, poolMethodPrefix) {
+			return f.Function + " " + f.File + ":" + strconv.Itoa(f.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
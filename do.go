@@ -0,0 +1,13 @@
+package wpool
+
+// Do runs the task, which response is irrelevant, e.g. a notification. The result is dropped without delivery
+// to a group, so nobody has to wait for it. Do blocks or returns an error like `group.Submit`,
+// according to the limits and the saturation policy, the error may be ignored.
+// Tasks of Do are executed with the pool options, e.g. retries, and are accounted in Stats.
+func (w *Pool[Req, Resp]) Do(req Req) error {
+	w.doOnce.Do(func() {
+		w.doGroup = w.AcquireGroup()
+		w.doGroup.discard = true
+	})
+	return w.doGroup.Submit(req)
+}
@@ -0,0 +1,87 @@
+package wpool
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrSaturated is returned, if the pool can not take the task without queueing with SaturationReject policy
+	ErrSaturated = errors.New("wpool: pool is saturated")
+
+	// ErrGroupCanceled is returned, if the task is submitted to the canceled group
+	ErrGroupCanceled = errors.New("wpool: group is canceled")
+
+	// ErrDeadlineExceeded is returned, if the task is submitted after its deadline, see DeadlineError
+	ErrDeadlineExceeded = errors.New("wpool: task deadline exceeded")
+
+	// ErrGroupExpired is passed to TypedOptions.DeadLetter for unfinished tasks of the group, which budget is expired
+	ErrGroupExpired = errors.New("wpool: group budget expired")
+
+	// ErrPoolClosed is returned, if the task is submitted to the pool after Shutdown
+	ErrPoolClosed = errors.New("wpool: pool is closed")
+
+	// ErrQueueFull is returned, if the task is rejected, because the pool queue is full, see Options.OverflowPolicy
+	ErrQueueFull = errors.New("wpool: queue is full")
+
+	// ErrTaskTimeout is the error of the task, which is not done before the Wait context is done, see Result.TimedOut
+	ErrTaskTimeout = errors.New("wpool: task timed out")
+
+	// ErrGroupReleased is returned, if the group is used after ReleaseGroup
+	ErrGroupReleased = errors.New("wpool: group is released")
+
+	// ErrGroupTransferred is returned, if the group is used by the previous owner after Group.Transfer
+	ErrGroupTransferred = errors.New("wpool: group is transferred")
+)
+
+// DeadlineError is returned, if the task is submitted after its deadline, see TypedOptions.DeadlineFunc.
+// It matches ErrDeadlineExceeded with errors.Is.
+type DeadlineError struct {
+	// Deadline is the task deadline
+	Deadline time.Time
+}
+
+func (e *DeadlineError) Error() string {
+	return fmt.Sprintf("wpool: task deadline exceeded by %v", time.Since(e.Deadline).Round(time.Microsecond))
+}
+
+// Is reports whether the target is ErrDeadlineExceeded
+func (e *DeadlineError) Is(target error) bool {
+	return target == ErrDeadlineExceeded
+}
+
+// PanicError is the task error, if the handler panicked. The panic is recovered by the pool.
+type PanicError struct {
+	// Value is the value passed to panic
+	Value any
+	// Stack is the stack trace of the panicked goroutine
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("wpool: handler panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value, if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// ShutdownError is returned by Shutdown, if the context is done before the pool is drained.
+// Remaining queued tasks are abandoned and delivered as dropped results.
+type ShutdownError struct {
+	// Dropped is the count of queued tasks dropped without execution, including tasks below Options.ShutdownDropBelow
+	Dropped int
+	// Err is the context error
+	Err error
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("wpool: shutdown: %v, %d tasks dropped", e.Err, e.Dropped)
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,74 @@
+package wpool
+
+import (
+	"expvar"
+	"time"
+)
+
+// PublishExpvar publishes live statistics of the pool to expvar under the name, see `/debug/vars`.
+// The variable is a map with the Pool.Stats counters and gauges, utilization, busy and total workers time in seconds,
+// pool labels, the concurrency limit, if the pool has Options.ConcurrencyFunc,
+// and scheduling decisions counts, if the pool is created with Options.TraceScheduling.
+// Like expvar.Publish, it panics if the name is already registered.
+func (w *Pool[Req, Resp]) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(w.expvar))
+}
+
+// expvar reads only atomic counters, so scraping never contends with dispatching
+func (w *Pool[Req, Resp]) expvar() any {
+	s := w.Stats()
+	busy, total := w.UtilizationTimes()
+
+	res := map[string]any{
+		"workers":              s.Workers,
+		"busy_workers":         s.BusyWorkers,
+		"idle_workers":         s.IdleWorkers,
+		"stuck_workers":        s.StuckWorkers,
+		"warming_workers":      s.WarmingWorkers,
+		"submitted":            s.Submitted,
+		"rejected":             s.Rejected,
+		"completed":            s.Completed,
+		"dropped":              s.Dropped,
+		"group_buffer_growths": s.GroupBufferGrowths,
+		"shadow_dropped":       s.ShadowDropped,
+		"deduplicated":         s.Deduplicated,
+		"spilled_over":         s.SpilledOver,
+		"queued":               s.Queued,
+		"queued_bytes":         s.QueuedBytes,
+		"spilled":              s.Spilled,
+		"handler_seconds":      s.HandlerTime.Seconds(),
+		"utilization":          w.Utilization(),
+		"busy_seconds":         float64(busy) / float64(time.Second),
+		"total_seconds":        float64(total) / float64(time.Second),
+	}
+
+	if s.Labels != nil {
+		res["labels"] = s.Labels
+	}
+
+	r := s.Rejections
+	res["rejections"] = map[string]int64{
+		"saturated":    r.Saturated,
+		"rate_limited": r.RateLimited,
+		"queue_full":   r.QueueFull,
+		"deadline":     r.Deadline,
+		"canceled":     r.Canceled,
+		"closed":       r.Closed,
+		"released":     r.Released,
+		"intercepted":  r.Intercepted,
+	}
+
+	if w.concurrencyFunc != nil {
+		res["concurrency_limit"] = w.ConcurrencyLimit()
+	}
+
+	if trace := w.SchedulingTrace(); trace != nil {
+		scheduling := make(map[string]int64, len(trace))
+		for reason, n := range trace {
+			scheduling[reason.String()] = n
+		}
+		res["scheduling"] = scheduling
+	}
+
+	return res
+}
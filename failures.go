@@ -0,0 +1,89 @@
+package wpool
+
+import (
+	"sync"
+	"time"
+)
+
+// FailureInfo is the failed task, see Options.FailureHistory
+type FailureInfo[Req any] struct {
+	// Req is the request of the failed task, it may be submitted again to re-run the task
+	Req Req
+	// Err is the error of the last attempt, see NewWithError
+	Err error
+	// Kind is the task kind, see TypedOptions.KindFunc
+	Kind string
+	// Attempts is a count of the task attempts, see TypedOptions.Retry
+	Attempts int
+	// Time is the time of the failure
+	Time time.Time
+}
+
+// failures retains the recent failed tasks in the ring buffer
+type failures[Req any] struct {
+	codec Codec[Req] // nil, if requests are retained as is
+
+	mu     sync.Mutex
+	recent []failure[Req]
+	next   int
+	total  int
+}
+
+// failure is the retained failed task, the request is encoded, if the codec is set
+type failure[Req any] struct {
+	info FailureInfo[Req]
+	data []byte
+}
+
+func newFailures[Req any](n int, codec Codec[Req]) *failures[Req] {
+	return &failures[Req]{codec: codec, recent: make([]failure[Req], n)}
+}
+
+// record retains the failed task. The request is encoded, so the retained request is not changed by the caller,
+// if the encoding fails, the request is retained as is.
+func (f *failures[Req]) record(info FailureInfo[Req]) {
+	var data []byte
+	if f.codec != nil {
+		if p, err := f.codec.Encode(info.Req); err == nil {
+			var zero Req
+			data, info.Req = p, zero
+		}
+	}
+
+	f.mu.Lock()
+	f.recent[f.next] = failure[Req]{info: info, data: data}
+	f.next = (f.next + 1) % len(f.recent)
+	f.total++
+	f.mu.Unlock()
+}
+
+// RecentFailures returns up to Options.FailureHistory recent failed tasks, the most recent is the last.
+// Requests are decoded with TypedOptions.FailureCodec, the task is skipped, if its request can not be decoded.
+// Returns nil, if the pool has no FailureHistory.
+func (w *Pool[Req, Resp]) RecentFailures() []FailureInfo[Req] {
+	f := w.failures
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	n := min(f.total, len(f.recent))
+	recent := make([]failure[Req], 0, n)
+	for i := 0; i < n; i++ {
+		recent = append(recent, f.recent[(f.next-n+i+len(f.recent))%len(f.recent)])
+	}
+	f.mu.Unlock()
+
+	res := make([]FailureInfo[Req], 0, n)
+	for _, r := range recent {
+		if r.data != nil {
+			req, err := f.codec.Decode(r.data)
+			if err != nil {
+				continue
+			}
+			r.info.Req = req
+		}
+		res = append(res, r.info)
+	}
+	return res
+}
@@ -0,0 +1,73 @@
+package wpool
+
+import (
+	"sync"
+	"time"
+)
+
+// QueueWaitStats is a distribution of queue waits of the group tasks, see Pool.QueueWaits.
+// Percentiles are estimated by a uniform sample of waits, like GroupStats percentiles.
+type QueueWaitStats struct {
+	// Tasks is a count of started tasks
+	Tasks int64
+	Avg   time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// queueWaits accumulates queue waits of started tasks by group names, see Options.QueueWaitAudit
+type queueWaits struct {
+	mu     sync.Mutex
+	groups map[string]*groupWaits
+}
+
+type groupWaits struct {
+	tasks  int64
+	total  time.Duration
+	max    time.Duration
+	sample reservoir
+}
+
+func (q *queueWaits) record(name string, wait time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.groups == nil {
+		q.groups = map[string]*groupWaits{}
+	}
+	gw := q.groups[name]
+	if gw == nil {
+		gw = &groupWaits{}
+		q.groups[name] = gw
+	}
+	gw.tasks++
+	gw.total += wait
+	gw.max = max(gw.max, wait)
+	gw.sample.add(wait)
+}
+
+// QueueWaits returns queue wait distributions of started tasks by group names since the pool creation,
+// see Options.QueueWaitAudit and GroupOptions.Name. Compare percentiles of groups to find starved groups,
+// which are hidden by the pool averages. Returns nil, if the audit is disabled.
+func (w *Pool[Req, Resp]) QueueWaits() map[string]QueueWaitStats {
+	if !w.queueWaitAudit {
+		return nil
+	}
+
+	w.queueWaits.mu.Lock()
+	defer w.queueWaits.mu.Unlock()
+
+	res := make(map[string]QueueWaitStats, len(w.queueWaits.groups))
+	for name, gw := range w.queueWaits.groups {
+		s := QueueWaitStats{
+			Tasks: gw.tasks,
+			Avg:   gw.total / time.Duration(gw.tasks),
+			Max:   gw.max,
+		}
+		s.P50, s.P90, s.P99 = gw.sample.percentiles()
+		res[name] = s
+	}
+	return res
+}
@@ -0,0 +1,1105 @@
+package wpool
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Group is a group of tasks.
+// Go and Submit are safe for concurrent use, so many producers can share one group.
+// Wait returns when all tasks accepted before and during the Wait call are done
+// and no Go or Submit call is in progress.
+// Wait calls are safe for concurrent use too: every concurrent Wait call receives all results,
+// which are not received by already finished Wait calls, so several consumers can observe the group completion.
+type Group[Req any, Resp any] struct {
+	pool *Pool[Req, Resp]
+
+	mu         sync.Mutex
+	results    []result[Req, Resp] // delivered results, results[:consumed] are received by Wait
+	consumed   int
+	pending    int             // accepted tasks without delivered result
+	submitting int             // Go and Submit calls in progress
+	wakers     []chan struct{} // wake up channels of Wait calls in progress, notified on a new result or when the group is done
+	spare      []chan struct{} // wake up channels for reuse
+	received   []uint64        // bitset of task indexes with received results
+	completed  chan struct{}   // closed when the group is done, nil if nobody asked for it
+	stats      groupStats
+
+	started  int64 // count of submitted tasks, used as the next task index
+	calls    int64 // count of submission calls, including rejected ones, see Map
+	limiter  *tokenBucket
+	waiting  int32
+	cancelCh chan struct{} // closed when the group is canceled
+
+	// ctx is the parent context of the task contexts, nil if the pool handler is not context aware
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	timer     *time.Timer
+	deadline  time.Time   // see GroupOptions.Deadline and Deadline
+	stopCtx   func() bool // stops the cancellation by the bound context, see AcquireGroupContext
+	canceled  int32
+	released  int32
+	name      string // see GroupOptions.Name
+	// transferred is set by Transfer, the group is used by its handle only
+	transferred int32
+	// limit is a max count of the group tasks executed at once, running is a count of tasks holding its slots,
+	// both are guarded by the pool mutex, see SetLimit
+	limit   int
+	running int
+
+	// backlog compaction, guarded by mu, see SetCompaction
+	backlogLimit   int
+	backlogCompact func([]Resp) []Resp
+
+	// cancelOnError enables the errgroup mode, err is the first error, see GroupOptions.CancelOnError
+	cancelOnError bool
+	err           error
+
+	// lastWorker is the worker, which started the last task of the group, see Options.GroupAffinity
+	lastWorker atomic.Pointer[worker[Req, Resp]]
+
+	order ordered[Req, Resp]
+
+	// middleware wraps the handler, see AcquireGroupWithMiddleware
+	middleware []Middleware[Req, Resp]
+
+	// onResult handles responses instead of Wait, see OnResult
+	onResult   func(Resp)
+	onResultMu sync.Mutex
+	// concurrent is set, if onResult may be called concurrently, e.g. it submits to the next stage, see Chain
+	concurrent bool
+
+	// discard drops all results of the group, nobody waits for them, see Pool.Do
+	discard bool
+
+	// settledCh is closed when accepted tasks are done or dropped, nil if nobody asked for it, see settled
+	settledCh chan struct{}
+
+	// queued tasks of the group, guarded by the pool mutex
+	queued taskHeap[Req, Resp]
+}
+
+// GroupOptions is a group options
+type GroupOptions struct {
+	// RateLimit is a maximum rate of tasks submitted to the pool by the group, per second, default 0 (unlimited).
+	// When the limit is reached, `group.Go` blocks until the task is allowed to run.
+	RateLimit float64
+
+	// RateBurst is a maximum number of tasks that can be submitted at once, above the RateLimit, default 1
+	RateBurst int
+
+	// Deadline is a time when the group is canceled, default zero (no deadline).
+	// The group is canceled even if `group.Wait` is never called: queued tasks are dropped,
+	// results of running tasks are discarded, `group.Go` drops new tasks and `group.Wait` returns immediately.
+	// Dropped tasks and tasks with discarded results are passed to TypedOptions.DeadLetter with ErrGroupExpired.
+	// The deadline bounds deadlines of the group tasks, see TypedOptions.DeadlineFunc and Group.Deadline,
+	// but does not move the group tasks ahead of tasks of other groups in the queue.
+	Deadline time.Time
+
+	// Timeout is an overall budget of the group from the acquisition, default 0 (no budget).
+	// It sets the Deadline, if the Deadline is zero or later.
+	Timeout time.Duration
+
+	// Size is an expected count of tasks in the group, default Options.GroupResponseChannelSize.
+	// The results buffer is pre-sized, and released groups are reused for groups of the similar size.
+	Size int
+
+	// Ordered enables the ordered results mode, default false: `group.Wait` returns responses in the order of tasks
+	// accepted by `group.Go`, so a result is received after results of all previous tasks.
+	// Dropped tasks are skipped in the order, emitted responses are ordered by their tasks, see NewWithEmit.
+	Ordered bool
+
+	// OverrideMiddleware replaces TypedOptions.Middleware with the group middleware, default false (the group middleware
+	// is called inside the pool one), see AcquireGroupWithMiddleware
+	OverrideMiddleware bool
+
+	// Name is a name of the group in Pool.QueueWaits, default empty
+	Name string
+
+	// CancelOnError enables the errgroup mode, default false: the first error of a task, see NewWithError,
+	// cancels the group, like Cancel, so queued tasks are dropped and the group context is canceled,
+	// and `group.WaitErr` returns the first error only.
+	CancelOnError bool
+}
+
+// AcquireGroup acquires the new group.
+// Use `group.Wait` to wait for all tasks in group to be done.
+// You should call ReleaseGroup after `group.Wait` is done.
+// You must not use the group after calling ReleaseGroup.
+func (w *Pool[Req, Resp]) AcquireGroup() *Group[Req, Resp] {
+	return w.AcquireGroupWithOptions(nil)
+}
+
+// AcquireGroupContext acquires the new group bound to the context, e.g. the context of the HTTP request.
+// When the context is done, the group is canceled, see Group.Cancel: queued tasks are dropped and blocked
+// `group.Go` calls return. The context deadline is the group deadline, see GroupOptions.Deadline,
+// so the latency budget of the caller, e.g. the handler of the previous pool, is propagated to the group tasks.
+// The same rules as for AcquireGroup apply.
+func (w *Pool[Req, Resp]) AcquireGroupContext(ctx context.Context) *Group[Req, Resp] {
+	var opts *GroupOptions
+	if deadline, ok := ctx.Deadline(); ok {
+		opts = &GroupOptions{Deadline: deadline}
+	}
+	g := w.AcquireGroupWithOptions(opts)
+	g.stopWithContext(ctx)
+	return g
+}
+
+// AcquireGroupWithOptions acquires the new group with options.
+// The same rules as for AcquireGroup apply.
+func (w *Pool[Req, Resp]) AcquireGroupWithOptions(opts *GroupOptions) *Group[Req, Resp] {
+	var gg *Group[Req, Resp]
+
+	size := w.groupResponseChannelSize
+	if opts != nil && opts.Size > 0 {
+		size = opts.Size
+	} else if hint := int(atomic.LoadInt64(&w.groupSizeHint)); hint > size {
+		size = hint
+	}
+
+	// the group from the size class has the results buffer capacity not less than the size
+	class := bits.Len(uint(size - 1))
+	var g any
+	if !w.disablePooling && class < len(w.groupsPools) {
+		g = w.groupsPools[class].Get()
+	}
+	if g == nil {
+		gg = &Group[Req, Resp]{
+			pool:     w,
+			results:  make([]result[Req, Resp], 0, 1<<class),
+			cancelCh: make(chan struct{}),
+		}
+	} else {
+		// canceled groups are not reused, so the cancel channel is not closed
+		gg = g.(*Group[Req, Resp])
+		gg.limiter = nil
+		gg.timer = nil
+		gg.stopCtx = nil
+		atomic.StoreInt32(&gg.released, 0)
+		atomic.StoreInt32(&gg.transferred, 0)
+		gg.lastWorker.Store(nil)
+		gg.order = ordered[Req, Resp]{}
+		gg.started = 0
+		gg.calls = 0
+		gg.received = gg.received[:0]
+		gg.stats.reset()
+	}
+
+	gg.middleware = w.middleware
+	gg.name = ""
+	gg.onResult = nil
+	gg.concurrent = false
+	gg.discard = false
+	gg.cancelOnError = false
+	gg.limit = 0
+	gg.backlogLimit = 0
+	gg.backlogCompact = nil
+	gg.err = nil
+	gg.deadline = time.Time{}
+
+	if w.contextAware {
+		gg.ctx, gg.ctxCancel = context.WithCancel(w.baseCtx)
+	}
+
+	if opts != nil {
+		gg.order.enabled = opts.Ordered
+		gg.name = opts.Name
+		gg.cancelOnError = opts.CancelOnError
+		if opts.RateLimit > 0 {
+			gg.limiter = newTokenBucket(opts.RateLimit, opts.RateBurst)
+		}
+		deadline := opts.Deadline
+		if opts.Timeout > 0 {
+			if d := time.Now().Add(opts.Timeout); deadline.IsZero() || d.Before(deadline) {
+				deadline = d
+			}
+		}
+		if !deadline.IsZero() {
+			gg.deadline = deadline
+			gg.timer = time.AfterFunc(time.Until(deadline), gg.expire)
+		}
+	}
+
+	return gg
+}
+
+// AcquireGroupWithDeadline acquires the new group, which is canceled at the deadline.
+// See GroupOptions.Deadline for details.
+func (w *Pool[Req, Resp]) AcquireGroupWithDeadline(deadline time.Time) *Group[Req, Resp] {
+	return w.AcquireGroupWithOptions(&GroupOptions{Deadline: deadline})
+}
+
+// AcquireGroupSized acquires the new group for about n tasks, see GroupOptions.Size.
+func (w *Pool[Req, Resp]) AcquireGroupSized(n int) *Group[Req, Resp] {
+	return w.AcquireGroupWithOptions(&GroupOptions{Size: n})
+}
+
+// ReleaseGroup releases group
+// You must not use group after calling ReleaseGroup. The transferred group is released by its handle, see Group.Transfer.
+func (w *Pool[Req, Resp]) ReleaseGroup(g *Group[Req, Resp]) {
+	if g.isTransferred() {
+		return
+	}
+	w.releaseGroup(g)
+}
+
+func (w *Pool[Req, Resp]) releaseGroup(g *Group[Req, Resp]) {
+	atomic.StoreInt32(&g.released, 1)
+	// if the bound context is already done, the group may be in use by the cancellation
+	if g.stopCtx != nil && !g.stopCtx() {
+		return
+	}
+	if g.ctxCancel != nil {
+		g.ctxCancel()
+	}
+	// if the deadline timer is already fired, the group may be in use by the cancellation
+	if g.timer != nil && !g.timer.Stop() {
+		return
+	}
+	// the canceled group may have dropped tasks, which are never done
+	if g.isCanceled() {
+		return
+	}
+	// if the group is busy, let GC collect it later
+	g.mu.Lock()
+	idle := g.pending == 0 && g.submitting == 0 && len(g.wakers) == 0
+	if idle {
+		for i := range g.results {
+			g.results[i] = result[Req, Resp]{}
+		}
+		g.results = g.results[:0]
+		g.consumed = 0
+	}
+	g.mu.Unlock()
+	if idle {
+		w.adaptGroupSize(atomic.LoadInt64(&g.started))
+	}
+	if idle && !w.disablePooling {
+		// the buffer may grow, so the size class is calculated from the current capacity
+		if class := bits.Len(uint(cap(g.results))) - 1; class >= 0 {
+			w.groupsPools[min(class, len(w.groupsPools)-1)].Put(g)
+		}
+	}
+}
+
+// adaptGroupSize moves the initial capacity of new groups towards the tasks count of the released group.
+// Concurrent updates may be lost, it is fine for the estimation.
+func (w *Pool[Req, Resp]) adaptGroupSize(n int64) {
+	hint := atomic.LoadInt64(&w.groupSizeHint)
+	atomic.StoreInt64(&w.groupSizeHint, hint+(n-hint)/8)
+}
+
+// Result is a task result with metadata
+type Result[Req any, Resp any] struct {
+	// Index is the task index in the group, in order of `group.Go` calls, -1 for compacted responses, see SetCompaction
+	Index int
+	// Call is the number of the submission call of the task in the group, counting rejected calls too,
+	// -1 for compacted responses and the placeholder. Unlike Index, it is not changed by Options.CoalesceWindow,
+	// so the caller submitting tasks one by one may map results back to its requests, see Map.
+	Call int
+	// Req is the task request, zero value for the placeholder
+	Req Req
+	// Resp is the task response, zero value for the placeholder and dropped tasks
+	Resp Resp
+	// TimedOut is true for the placeholder of the task, which is not done before the Wait context is done
+	// or the group is canceled
+	TimedOut bool
+	// Dropped is true for the task dropped without execution
+	Dropped bool
+	// Attempts is a count of the task attempts, see TypedOptions.Retry, zero for the placeholder and dropped tasks
+	Attempts int
+	// Err is the error returned by the handler, see NewWithError, PanicError, if the handler panicked,
+	// or ErrTaskTimeout for the placeholder
+	Err error
+	// Wait is a time from the submission to the first attempt
+	Wait time.Duration
+	// Busy is a handler execution time, summed over attempts
+	Busy time.Duration
+}
+
+// Wait waits for all tasks in group to be done or context is done.
+func (g *Group[Req, Resp]) Wait(ctx context.Context, dest []Resp) []Resp {
+	if g.isTransferred() {
+		return dest
+	}
+	return g.waitResps(ctx, dest)
+}
+
+func (g *Group[Req, Resp]) waitResps(ctx context.Context, dest []Resp) []Resp {
+	g.receive(ctx, func(v result[Req, Resp]) bool {
+		if !v.dropped {
+			dest = append(dest, v.resp)
+		}
+		return true
+	})
+	return dest
+}
+
+// WaitErr waits for all tasks in group like Wait, but returns responses of succeeded tasks only
+// and errors of failed tasks joined with errors.Join, see NewWithError.
+// If not all tasks are done, the error includes ErrTaskTimeout, or ErrGroupCanceled, if the group is canceled.
+// In the errgroup mode, see GroupOptions.CancelOnError, the error is the first error of a task.
+func (g *Group[Req, Resp]) WaitErr(ctx context.Context, dest []Resp) ([]Resp, error) {
+	if g.isTransferred() {
+		return dest, ErrGroupTransferred
+	}
+	return g.waitErr(ctx, dest)
+}
+
+func (g *Group[Req, Resp]) waitErr(ctx context.Context, dest []Resp) ([]Resp, error) {
+	var errs []error
+	if atomic.LoadInt32(&g.released) != 0 {
+		return dest, ErrGroupReleased
+	}
+	done := g.receive(ctx, func(v result[Req, Resp]) bool {
+		if v.err != nil {
+			errs = append(errs, v.err)
+		} else if !v.dropped {
+			dest = append(dest, v.resp)
+		}
+		return true
+	})
+	if g.cancelOnError {
+		g.mu.Lock()
+		err := g.err
+		g.mu.Unlock()
+		if err != nil {
+			return dest, err
+		}
+	}
+	if !done {
+		if g.isCanceled() {
+			errs = append(errs, ErrGroupCanceled)
+		} else {
+			errs = append(errs, ErrTaskTimeout)
+		}
+	}
+	return dest, errors.Join(errs...)
+}
+
+// WaitResults waits for all tasks in group to be done or context is done, like Wait.
+// It returns exactly one result per task without received result: if the context is done
+// or the group is canceled, results of not done tasks are filled with TimedOut placeholders.
+func (g *Group[Req, Resp]) WaitResults(ctx context.Context, dest []Result[Req, Resp]) []Result[Req, Resp] {
+	if g.isTransferred() {
+		return dest
+	}
+	return g.waitResults(ctx, dest)
+}
+
+func (g *Group[Req, Resp]) waitResults(ctx context.Context, dest []Result[Req, Resp]) []Result[Req, Resp] {
+	if g.receive(ctx, func(v result[Req, Resp]) bool {
+		dest = append(dest, Result[Req, Resp]{
+			Index:    v.index,
+			Call:     v.call,
+			Req:      v.req,
+			Resp:     v.resp,
+			Dropped:  v.dropped,
+			Attempts: v.attempt,
+			Err:      v.err,
+			Wait:     v.wait,
+			Busy:     v.busy,
+		})
+		return true
+	}) {
+		return dest
+	}
+
+	started := int(atomic.LoadInt64(&g.started))
+	for i := 0; i < started; i++ {
+		if !g.isReceived(i) {
+			dest = append(dest, Result[Req, Resp]{
+				Index:    i,
+				Call:     -1,
+				TimedOut: true,
+				Err:      ErrTaskTimeout,
+			})
+		}
+	}
+
+	return dest
+}
+
+// Results returns an iterator, which yields responses as they are received, until all tasks are done,
+// the context is done or the group is canceled. Unlike Wait, responses are not collected into a slice.
+// Dropped tasks are skipped. If the loop is stopped, remaining results can be received later.
+func (g *Group[Req, Resp]) Results(ctx context.Context) iter.Seq[Resp] {
+	return func(yield func(Resp) bool) {
+		g.wait(ctx, func(v result[Req, Resp]) bool {
+			return v.dropped || yield(v.resp)
+		})
+	}
+}
+
+// ResultChan returns a channel of responses, which are sent as they are received, like Results.
+// The channel is closed when all submitted tasks are done or the group is canceled, so the consumer can select
+// on it together with other channels. Read the channel until it is closed or cancel the group,
+// otherwise the sending goroutine leaks.
+func (g *Group[Req, Resp]) ResultChan() <-chan Resp {
+	ch := make(chan Resp)
+	go func() {
+		defer close(ch)
+		g.wait(context.Background(), func(v result[Req, Resp]) bool {
+			if v.dropped {
+				return true
+			}
+			select {
+			case ch <- v.resp:
+				return true
+			case <-g.cancelCh:
+				return false
+			}
+		})
+	}()
+	return ch
+}
+
+// OnResult sets the callback, which handles responses as tasks complete, instead of collecting them for Wait.
+// Wait is a completion barrier then: it returns when all tasks are done and their callbacks returned,
+// responses passed to the callback are not returned by Wait. The callback is called by workers, calls are serialized,
+// so keep it short. Errors and dropped tasks are not passed, see WaitErr and WaitResults for them.
+// Responses are passed in the completion order, also in ordered groups. Set the callback before submitting tasks.
+func (g *Group[Req, Resp]) OnResult(fn func(Resp)) {
+	g.onResult = fn
+}
+
+// WaitChunks returns an iterator, which yields results in chunks of n, as they are received.
+// The last chunk may be shorter, it is yielded when all tasks are done, the context is done or the group is canceled.
+// Every chunk is a new slice, so it can be retained. If the loop is stopped, remaining results can be received later.
+func (g *Group[Req, Resp]) WaitChunks(ctx context.Context, n int) iter.Seq[[]Resp] {
+	if n < 1 {
+		n = 1
+	}
+
+	return func(yield func([]Resp) bool) {
+		chunk := make([]Resp, 0, n)
+		stopped := false
+
+		g.wait(ctx, func(v result[Req, Resp]) bool {
+			if v.dropped {
+				return true
+			}
+			chunk = append(chunk, v.resp)
+			if len(chunk) < n {
+				return true
+			}
+			if !yield(chunk) {
+				stopped = true
+				return false
+			}
+			chunk = make([]Resp, 0, n)
+			return true
+		})
+
+		if !stopped && len(chunk) > 0 {
+			yield(chunk)
+		}
+	}
+}
+
+// WaitN waits like Wait, but returns after the first n responses are received, e.g. for "best of k" fan-outs.
+// Dropped tasks are not counted. Remaining tasks keep running, their results can be received later,
+// cancel the group to stop them, see Cancel.
+func (g *Group[Req, Resp]) WaitN(ctx context.Context, n int, dest []Resp) []Resp {
+	if n < 1 {
+		return dest
+	}
+	received := 0
+	g.wait(ctx, func(v result[Req, Resp]) bool {
+		if v.dropped {
+			return true
+		}
+		dest = append(dest, v.resp)
+		received++
+		return received < n
+	})
+	return dest
+}
+
+// WaitAny waits for the first response of a succeeded task, e.g. to race redundant backends.
+// Dropped and failed tasks are skipped, see NewWithError. Returns false, if all tasks are done without a response,
+// the context is done or the group is canceled. Remaining tasks keep running, cancel the group to stop them.
+func (g *Group[Req, Resp]) WaitAny(ctx context.Context) (Resp, bool) {
+	var resp Resp
+	ok := false
+	g.wait(ctx, func(v result[Req, Resp]) bool {
+		if v.dropped || v.err != nil {
+			return true
+		}
+		resp, ok = v.resp, true
+		return false
+	})
+	return resp, ok
+}
+
+// WaitUntil waits for results like Wait, until the received results satisfy the predicate.
+// The predicate is called with all received responses after every new one. When it returns true,
+// the group is canceled, see GroupOptions.Deadline, and the received responses are returned.
+// It suits search-style fan-outs, which do not need all results.
+func (g *Group[Req, Resp]) WaitUntil(ctx context.Context, pred func([]Resp) bool) []Resp {
+	var dest []Resp
+	satisfied := false
+
+	g.wait(ctx, func(v result[Req, Resp]) bool {
+		if v.dropped {
+			return true
+		}
+		dest = append(dest, v.resp)
+		satisfied = pred(dest)
+		return !satisfied
+	})
+
+	if satisfied {
+		g.cancel()
+	}
+
+	return dest
+}
+
+// wait receives results until all tasks are done, the context is done, the group is canceled
+// or fn returns false. Returns true, if all tasks are done, and false immediately, if the group is transferred.
+func (g *Group[Req, Resp]) wait(ctx context.Context, fn func(v result[Req, Resp]) bool) bool {
+	if g.isTransferred() {
+		return false
+	}
+	return g.receive(ctx, fn)
+}
+
+// receive receives results like wait, regardless of the group owner, see Transfer
+func (g *Group[Req, Resp]) receive(ctx context.Context, fn func(v result[Req, Resp]) bool) bool {
+	g.mu.Lock()
+	if g.isDone() && g.consumed == len(g.results) {
+		g.mu.Unlock()
+		return true
+	}
+	cursor := g.consumed
+	marked := cursor // results[marked:cursor] are received, but not marked yet
+	wake := g.addWaker()
+	g.mu.Unlock()
+
+	atomic.AddInt32(&g.waiting, 1)
+	defer atomic.AddInt32(&g.waiting, -1)
+
+	// running tasks observe the done wait context
+	if g.ctxCancel != nil {
+		stop := context.AfterFunc(ctx, g.ctxCancel)
+		defer stop()
+	}
+
+	defer func() {
+		g.mu.Lock()
+		g.markReceived(marked, cursor)
+		if cursor > g.consumed {
+			g.consumed = cursor
+		}
+		g.removeWaker(wake)
+		if len(g.wakers) == 0 {
+			g.compact()
+		}
+		g.mu.Unlock()
+	}()
+
+	if g.pool.inlineLastTask {
+		g.pool.inline(g)
+	}
+
+	for {
+		g.mu.Lock()
+		// received results are marked under the lock taken for the next batch, not per result
+		g.markReceived(marked, cursor)
+		marked = cursor
+		// results are only appended while there are waiters, so the batch is stable
+		batch := g.results[cursor:]
+		done := g.isDone()
+		canceled := g.isCanceled()
+		g.mu.Unlock()
+
+		for i, v := range batch {
+			cursor++
+			if !fn(v) {
+				return done && i == len(batch)-1
+			}
+		}
+
+		if done {
+			return true
+		}
+		if canceled {
+			// the group is canceled, already received results are collected
+			return false
+		}
+		if len(batch) > 0 {
+			continue
+		}
+
+		// the canceled group signals waiters, see cancelWith
+		select {
+		case <-ctx.Done():
+			return false
+		case <-wake:
+		}
+	}
+}
+
+// Done returns a channel, which is closed when all submitted tasks are done and no Go or Submit call is in progress,
+// or the group is canceled. Results are still received by Wait. If new tasks are submitted after that,
+// Done returns a new channel for them.
+func (g *Group[Req, Resp]) Done() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.isDone() || g.isCanceled() {
+		return closedCh
+	}
+	if g.completed == nil {
+		g.completed = make(chan struct{})
+	}
+	return g.completed
+}
+
+// Cancel cancels the group: queued tasks are dropped without execution, results of running tasks are discarded,
+// `group.Submit` returns ErrGroupCanceled, `group.Wait` returns already received results and Done is closed.
+// Running tasks are not interrupted, context aware handlers observe the canceled context, see NewWithContext.
+// The canceled group is not reused after ReleaseGroup.
+func (g *Group[Req, Resp]) Cancel() {
+	g.cancel()
+}
+
+// closedCh is a closed channel returned by Done for the done group
+var closedCh = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// complete closes the Done channel, guarded by mu
+func (g *Group[Req, Resp]) complete() {
+	if g.completed != nil {
+		close(g.completed)
+		g.completed = nil
+	}
+}
+
+// settled returns a channel, which is closed when all accepted tasks are done or dropped
+// and no Go or Submit call is in progress. Unlike Done, it is not closed by Cancel before running tasks are finished.
+func (g *Group[Req, Resp]) settled() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.isDone() {
+		return closedCh
+	}
+	if g.settledCh == nil {
+		g.settledCh = make(chan struct{})
+	}
+	return g.settledCh
+}
+
+// settle closes the settled channel, guarded by mu
+func (g *Group[Req, Resp]) settle() {
+	if g.settledCh != nil {
+		close(g.settledCh)
+		g.settledCh = nil
+	}
+}
+
+// drop counts the task of the canceled group, which is dropped without delivery, as done
+func (g *Group[Req, Resp]) drop() {
+	g.mu.Lock()
+	g.pending--
+	if g.isDone() {
+		g.settle()
+	}
+	g.mu.Unlock()
+}
+
+// isDone reports whether all accepted tasks are done and no task is being submitted, guarded by mu
+func (g *Group[Req, Resp]) isDone() bool {
+	return g.pending == 0 && g.submitting == 0
+}
+
+// signal wakes up waiters, guarded by mu
+func (g *Group[Req, Resp]) signal() {
+	for _, ch := range g.wakers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// addWaker registers the wake up channel of the Wait call, guarded by mu
+func (g *Group[Req, Resp]) addWaker() chan struct{} {
+	var ch chan struct{}
+	if n := len(g.spare); n > 0 {
+		ch = g.spare[n-1]
+		g.spare[n-1] = nil
+		g.spare = g.spare[:n-1]
+	} else {
+		ch = make(chan struct{}, 1)
+	}
+	g.wakers = append(g.wakers, ch)
+	return ch
+}
+
+// removeWaker unregisters the wake up channel and keeps it for reuse, guarded by mu
+func (g *Group[Req, Resp]) removeWaker(ch chan struct{}) {
+	for i, v := range g.wakers {
+		if v == ch {
+			last := len(g.wakers) - 1
+			g.wakers[i] = g.wakers[last]
+			g.wakers[last] = nil
+			g.wakers = g.wakers[:last]
+			break
+		}
+	}
+	select {
+	case <-ch:
+	default:
+	}
+	g.spare = append(g.spare, ch)
+}
+
+// compact removes received results, guarded by mu
+func (g *Group[Req, Resp]) compact() {
+	if g.consumed == 0 {
+		return
+	}
+	n := copy(g.results, g.results[g.consumed:])
+	for i := n; i < len(g.results); i++ {
+		g.results[i] = result[Req, Resp]{}
+	}
+	g.results = g.results[:n]
+	g.consumed = 0
+}
+
+// markReceived marks tasks of results[from:to] as received, guarded by mu
+func (g *Group[Req, Resp]) markReceived(from, to int) {
+	for _, r := range g.results[from:to] {
+		if r.index >= 0 {
+			g.setReceived(r.index)
+		}
+	}
+}
+
+// setReceived marks the task index as received, guarded by mu
+func (g *Group[Req, Resp]) setReceived(index int) {
+	idx := index / 64
+	for len(g.received) <= idx {
+		g.received = append(g.received, 0)
+	}
+	g.received[idx] |= 1 << (index % 64)
+}
+
+func (g *Group[Req, Resp]) isReceived(index int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	idx := index / 64
+	return idx < len(g.received) && g.received[idx]&(1<<(index%64)) != 0
+}
+
+// Go runs the task in the group (unblocking).
+// If the group has a rate limit, Go blocks until the task is allowed by the limiter.
+// If the task is not accepted by the pool or the group is canceled, the task is dropped.
+// Use Submit to get the reason.
+func (g *Group[Req, Resp]) Go(req Req) {
+	_ = g.Submit(req)
+}
+
+// Submit runs the task in the group like Go, but returns an error, if the task is not accepted:
+// ErrGroupCanceled, if the group is canceled, ErrSaturated, if the pool is saturated with SaturationReject policy,
+// ErrQueueFull, if the queue is full with OverflowReject policy,
+// DeadlineError, if the task deadline is exceeded, ErrPoolClosed, if the pool is shut down, ErrGroupReleased,
+// if the group is released, or the error returned by TypedOptions.Interceptors or TypedOptions.Prepare.
+func (g *Group[Req, Resp]) Submit(req Req) error {
+	return g.SubmitValue(&req)
+}
+
+// GoValue runs the task like Go, but takes the request by pointer, to avoid copies of large value requests.
+// The request is copied once into the task, so it may be reused after the call, and the task request is passed
+// by pointer up to the handler call. Interceptors, Prepare and the middleware receive it by value.
+func (g *Group[Req, Resp]) GoValue(req *Req) {
+	_ = g.SubmitValue(req)
+}
+
+// SubmitValue runs the task like GoValue, but returns an error like Submit
+func (g *Group[Req, Resp]) SubmitValue(req *Req) error {
+	return g.submit(nil, req, false, nil)
+}
+
+// GoContext runs the task like Go. Values of the context, e.g. the active tracing span,
+// are visible in the task context, see NewWithContext and Options.InvokeHook. The context cancellation is ignored.
+func (g *Group[Req, Resp]) GoContext(ctx context.Context, req Req) {
+	_ = g.submit(ctx, &req, false, nil)
+}
+
+// SubmitContext runs the task like GoContext, but returns an error like Submit
+func (g *Group[Req, Resp]) SubmitContext(ctx context.Context, req Req) error {
+	return g.submit(ctx, &req, false, nil)
+}
+
+// TryGo runs the task in the group like Go, but never blocks: if the task can not be passed to a worker immediately,
+// because of Options.WorkersLimitMax, Options.KindLimits or GroupOptions.RateLimit, it is not queued and TryGo returns false.
+// TryGo returns false for tasks rejected like by Submit too.
+func (g *Group[Req, Resp]) TryGo(req Req) bool {
+	return g.submit(nil, &req, true, nil) == nil
+}
+
+// QueueInfo is the queue position of the submitted task, see SubmitInfo
+type QueueInfo struct {
+	// Queued reports whether the task is queued, instead of being passed to a worker immediately
+	Queued bool
+	// Position is a count of tasks, which are queued before the task at the submission.
+	// Tasks submitted later with higher priority or earlier deadline may move the task back.
+	Position int
+	// ETA is an estimated time until the task starts, based on the average handler time and the workers count
+	ETA time.Duration
+}
+
+// SubmitInfo runs the task like Submit and returns its queue position, e.g. to show the progress expectation
+// to the interactive caller. With SaturationBlock policy without Options.MaxPendingTasks, SubmitInfo returns
+// after a worker takes the queued task, but the position is still calculated at the submission.
+func (g *Group[Req, Resp]) SubmitInfo(req Req) (QueueInfo, error) {
+	var info QueueInfo
+	if err := g.submit(nil, &req, false, &info); err != nil {
+		return QueueInfo{}, err
+	}
+	if info.Queued {
+		info.ETA = g.pool.estimateStart(info.Position)
+	}
+	return info, nil
+}
+
+// submit submits the task and counts its rejection
+func (g *Group[Req, Resp]) submit(ctx context.Context, req *Req, try bool, info *QueueInfo) error {
+	err := g.submitTask(ctx, req, try, info)
+	if err != nil {
+		g.pool.rejections.record(err)
+		g.mu.Lock()
+		g.stats.rejections.record(err)
+		g.mu.Unlock()
+	}
+	return err
+}
+
+func (g *Group[Req, Resp]) submitTask(ctx context.Context, req *Req, try bool, info *QueueInfo) error {
+	call := int(atomic.AddInt64(&g.calls, 1) - 1)
+
+	// the submission is counted, so Wait does not return while the task is not accepted yet
+	g.mu.Lock()
+	g.submitting++
+	g.mu.Unlock()
+
+	defer g.submitted()
+
+	if atomic.LoadInt32(&g.released) != 0 {
+		g.pool.traceDecision(ReasonRejected)
+		return ErrGroupReleased
+	}
+	if g.isTransferred() {
+		g.pool.traceDecision(ReasonRejected)
+		return ErrGroupTransferred
+	}
+	if g.limiter != nil {
+		if !try {
+			g.limiter.wait(g.cancelCh)
+		} else if !g.limiter.take() {
+			g.pool.traceDecision(ReasonRejected)
+			return errRateLimited
+		}
+	}
+	if g.isCanceled() {
+		g.pool.traceDecision(ReasonDropped)
+		return ErrGroupCanceled
+	}
+	// the request is copied once into the task, interceptors and the handler use the task request
+	t := g.pool.acquireTask()
+	t.req = *req
+	if len(g.pool.interceptors) > 0 || g.pool.prepare != nil {
+		err := g.pool.intercept(&t.req)
+		if err == nil && g.pool.prepare != nil {
+			err = g.pool.prepareRequest(&t.req)
+		}
+		if err != nil {
+			g.pool.traceDecision(ReasonRejected)
+			g.pool.releaseTask(t)
+			return err
+		}
+	}
+	t.group = g
+	t.call = call
+	t.ctx = ctx
+	t.attempt = 1
+	t.try = try
+	t.info = info
+	if g.pool.coalescer != nil && !try && info == nil && g.pool.coalesce(t) {
+		return nil
+	}
+	if g.pool.dedup != nil && info == nil && g.pool.join(t) {
+		return nil
+	}
+	return g.pool.task(t)
+}
+
+// submitted ends the submission in progress
+func (g *Group[Req, Resp]) submitted() {
+	g.mu.Lock()
+	g.submitting--
+	if g.isDone() {
+		g.signal()
+		g.complete()
+		g.settle()
+	}
+	g.mu.Unlock()
+}
+
+// accept counts the task in the group and assigns its index
+func (g *Group[Req, Resp]) accept(t *task[Req, Resp]) {
+	t.index = g.acceptIndex()
+	t.accepted = nanotime()
+	if t.dedupKey != "" {
+		g.pool.dedup.inFlight(t)
+	}
+}
+
+// acceptIndex counts a task in the group and returns the task index
+func (g *Group[Req, Resp]) acceptIndex() int {
+	g.mu.Lock()
+	g.pending++
+	g.mu.Unlock()
+	return int(atomic.AddInt64(&g.started, 1) - 1)
+}
+
+// deliver passes the task result to the group without blocking. The result is discarded, if the group is canceled.
+func (g *Group[Req, Resp]) deliver(r result[Req, Resp]) {
+	g.handle(&r)
+	g.mu.Lock()
+	g.pending--
+	if r.shared {
+		g.stats.recordShared(r.dropped, r.err != nil)
+	} else {
+		g.stats.record(r.dropped, r.err != nil, r.attempt, r.wait, r.busy)
+	}
+	canceled := g.isCanceled()
+	if !canceled {
+		g.push(r, true)
+	}
+	failed := g.cancelOnError && r.err != nil && !canceled && g.err == nil
+	if failed {
+		g.err = r.err
+	}
+	g.signal()
+	if g.isDone() {
+		g.complete()
+		g.settle()
+	}
+	g.mu.Unlock()
+
+	if failed {
+		g.cancelWith(groupFailed)
+	}
+
+	// the task is not finished before the group budget is expired
+	if canceled && !r.dropped {
+		g.deadLetter(r.req)
+	}
+}
+
+// handle passes the response to the OnResult callback before the result is delivered, so Wait waits for the callback.
+// The handled result is empty.
+func (g *Group[Req, Resp]) handle(r *result[Req, Resp]) {
+	if g.onResult == nil || r.dropped || r.err != nil || r.empty || g.isCanceled() {
+		return
+	}
+	if g.concurrent {
+		g.onResult(r.resp)
+	} else {
+		g.onResultMu.Lock()
+		g.onResult(r.resp)
+		g.onResultMu.Unlock()
+	}
+	r.empty = true
+}
+
+// push passes the result of the task to the results buffer, guarded by mu.
+// The final result completes the task, it is empty, if the task emitted its results, see NewWithEmit.
+func (g *Group[Req, Resp]) push(r result[Req, Resp], final bool) {
+	if g.discard {
+		return
+	}
+	if g.order.enabled {
+		g.pushOrdered(r, final)
+	} else if !r.empty {
+		g.append(r)
+	}
+}
+
+// append appends the result to the results buffer, guarded by mu
+func (g *Group[Req, Resp]) append(r result[Req, Resp]) {
+	if len(g.results) == cap(g.results) {
+		atomic.AddInt64(&g.pool.counters.bufferGrowths, 1)
+	}
+	g.results = append(g.results, r)
+	g.compactBacklog()
+}
+
+// emit adds the response emitted by the running task, see NewWithEmit. The task stays pending.
+func (g *Group[Req, Resp]) emit(r result[Req, Resp]) {
+	g.handle(&r)
+	g.mu.Lock()
+	if !g.isCanceled() {
+		g.push(r, false)
+	}
+	g.signal()
+	g.mu.Unlock()
+}
+
+const (
+	groupCanceled int32 = 1 // canceled by the owner, see WaitUntil
+	groupExpired  int32 = 2 // canceled at the deadline
+	groupFailed   int32 = 3 // canceled by the first error, see GroupOptions.CancelOnError
+)
+
+// cancel cancels the group and drops its queued tasks
+func (g *Group[Req, Resp]) cancel() {
+	g.cancelWith(groupCanceled)
+}
+
+// expire cancels the group at the deadline, unfinished tasks are passed to TypedOptions.DeadLetter
+func (g *Group[Req, Resp]) expire() {
+	g.cancelWith(groupExpired)
+}
+
+func (g *Group[Req, Resp]) cancelWith(reason int32) {
+	if !atomic.CompareAndSwapInt32(&g.canceled, 0, reason) {
+		return
+	}
+	close(g.cancelCh)
+	if g.ctxCancel != nil {
+		g.ctxCancel()
+	}
+	g.pool.dropQueued(g)
+
+	g.mu.Lock()
+	g.signal()
+	g.complete()
+	g.mu.Unlock()
+}
+
+func (g *Group[Req, Resp]) isCanceled() bool {
+	return atomic.LoadInt32(&g.canceled) != 0
+}
+
+// deadLetter passes the unfinished task of the expired group to TypedOptions.DeadLetter
+func (g *Group[Req, Resp]) deadLetter(req Req) {
+	if g.pool.deadLetter != nil && atomic.LoadInt32(&g.canceled) == groupExpired {
+		g.pool.deadLetter(req, ErrGroupExpired)
+	}
+}
+
+func (g *Group[Req, Resp]) isWaiting() bool {
+	return atomic.LoadInt32(&g.waiting) > 0
+}
@@ -0,0 +1,97 @@
+package wpool
+
+// SetLimit limits the count of the group tasks executed at once, so one group can not take all workers
+// of the shared pool, n <= 0 removes the limit, default no limit. Tasks over the limit wait for a slot of the group,
+// their submitters are blocked like by Options.KindLimits. Set the limit before submitting tasks.
+func (g *Group[Req, Resp]) SetLimit(n int) {
+	g.pool.mu.Lock()
+	g.limit = n
+	g.pool.mu.Unlock()
+}
+
+// waitGroupSlot parks the task until a slot of its group is released, see Group.SetLimit.
+// It must be called under the mutex, the mutex is unlocked.
+func (w *Pool[Req, Resp]) waitGroupSlot(t *task[Req, Resp]) error {
+	if w.saturationPolicy == SaturationReject || t.try {
+		w.mu.Unlock()
+		w.traceDecision(ReasonRejected)
+		w.releaseTask(t)
+		return ErrSaturated
+	}
+
+	t.group.accept(t)
+	dequeued := make(chan struct{})
+	t.dequeued = dequeued
+
+	if w.groupWaiting == nil {
+		w.groupWaiting = make(map[*Group[Req, Resp]]*fifo[*task[Req, Resp]])
+	}
+	q := w.groupWaiting[t.group]
+	if q == nil {
+		q = &fifo[*task[Req, Resp]]{}
+		w.groupWaiting[t.group] = q
+	}
+	q.push(t)
+	w.mu.Unlock()
+
+	w.traceDecision(ReasonGroupLimited)
+	<-dequeued
+
+	return nil
+}
+
+// releaseGroupSlot releases the slot of the group and queues the next task of the group, if any.
+// The next task takes a slot of its kind, or waits for it, see Options.KindLimits.
+func (w *Pool[Req, Resp]) releaseGroupSlot(g *Group[Req, Resp]) {
+	w.mu.Lock()
+	g.running--
+
+	q := w.groupWaiting[g]
+	if q == nil {
+		w.mu.Unlock()
+		return
+	}
+
+	// the task is already accepted, so it is queued regardless of the workers limits
+	t, _ := q.pop()
+	if q.len() == 0 {
+		delete(w.groupWaiting, g)
+	}
+	g.running++
+	t.groupSlot = true
+
+	if limit := w.kindLimits[t.kind]; limit > 0 {
+		if w.kindRunning[t.kind] >= limit {
+			kq := w.kindWaiting[t.kind]
+			if kq == nil {
+				kq = &fifo[*task[Req, Resp]]{}
+				w.kindWaiting[t.kind] = kq
+			}
+			kq.push(t)
+			w.mu.Unlock()
+			return
+		}
+		w.kindRunning[t.kind]++
+		t.kindSlot = true
+	}
+	w.enqueue(t)
+	w.mu.Unlock()
+
+	w.kick()
+}
+
+// dropGroupWaiting removes tasks of the group waiting for its slots. It must be called under the mutex.
+func (w *Pool[Req, Resp]) dropGroupWaiting(g *Group[Req, Resp]) []*task[Req, Resp] {
+	q := w.groupWaiting[g]
+	if q == nil {
+		return nil
+	}
+	delete(w.groupWaiting, g)
+
+	tasks := make([]*task[Req, Resp], 0, q.len())
+	for q.len() > 0 {
+		t, _ := q.pop()
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
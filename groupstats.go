@@ -0,0 +1,196 @@
+package wpool
+
+import (
+	"slices"
+	"time"
+)
+
+// GroupStats is a summary of the group tasks execution
+type GroupStats struct {
+	// Tasks is a count of done tasks, including dropped tasks
+	Tasks int
+	// Dropped is a count of tasks dropped without execution
+	Dropped int
+	// Retries is a count of retried attempts, see TypedOptions.Retry
+	Retries int
+	// Failures is a count of tasks, which handler returned an error, see NewWithError
+	Failures int
+	// Shared is a count of tasks joined to the in-flight task with the same key, see TypedOptions.DedupKey.
+	// They are counted in Tasks, but not in execution times and queue waits.
+	Shared int
+
+	// Busy is a total handler execution time of executed tasks, summed over attempts
+	Busy time.Duration
+	// Avg, P50, P90, P99 and Max are handler execution times of executed tasks.
+	// Percentiles are estimated from a sample of up to 1024 tasks.
+	Avg time.Duration
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+
+	// QueueWait is a total time of executed tasks from the submission to the first attempt
+	QueueWait time.Duration
+	// AvgQueueWait is an average time of executed tasks from the submission to the first attempt
+	AvgQueueWait time.Duration
+	// QueueWaitP50, QueueWaitP90, QueueWaitP99 and MaxQueueWait are queue waits of executed tasks,
+	// percentiles are estimated like the handler execution times
+	QueueWaitP50 time.Duration
+	QueueWaitP90 time.Duration
+	QueueWaitP99 time.Duration
+	MaxQueueWait time.Duration
+
+	// Rejections is a count of tasks rejected at submission by causes, they are not counted in Tasks
+	Rejections RejectionStats
+}
+
+// Stats returns the execution summary of the group tasks, which are done so far.
+// Call it after Wait to get the report of the whole run.
+func (g *Group[Req, Resp]) Stats() GroupStats {
+	g.mu.Lock()
+	s := g.stats.summary()
+	g.mu.Unlock()
+	return s
+}
+
+// statsSamples is a max count of durations samples of the group
+const statsSamples = 1024
+
+// groupStats collects execution statistics of the group, guarded by the group mutex.
+// Durations are sampled with the reservoir sampling, so the memory is bounded for long living groups.
+type groupStats struct {
+	tasks    int
+	dropped  int
+	retries  int
+	failures int
+	shared   int
+	executed int
+	wait     time.Duration
+	busy     time.Duration
+	max      time.Duration
+	maxWait  time.Duration
+	busies   reservoir
+	waits    reservoir
+
+	rejections rejections
+}
+
+func (s *groupStats) record(dropped, failed bool, attempt int, wait, busy time.Duration) {
+	s.tasks++
+	if dropped {
+		s.dropped++
+		return
+	}
+	if failed {
+		s.failures++
+	}
+	if attempt > 1 {
+		s.retries += attempt - 1
+	}
+	s.executed++
+	s.wait += wait
+	s.busy += busy
+	s.max = max(s.max, busy)
+	s.maxWait = max(s.maxWait, wait)
+	s.busies.add(busy)
+	s.waits.add(wait)
+}
+
+// recordShared records the task joined to the in-flight task, its execution is recorded by the in-flight one
+func (s *groupStats) recordShared(dropped, failed bool) {
+	s.tasks++
+	s.shared++
+	if dropped {
+		s.dropped++
+	} else if failed {
+		s.failures++
+	}
+}
+
+func (s *groupStats) reset() {
+	busies, waits := s.busies, s.waits
+	busies.reset()
+	waits.reset()
+	*s = groupStats{busies: busies, waits: waits}
+}
+
+func (s *groupStats) summary() GroupStats {
+	res := GroupStats{
+		Tasks:        s.tasks,
+		Dropped:      s.dropped,
+		Retries:      s.retries,
+		Failures:     s.failures,
+		Shared:       s.shared,
+		Busy:         s.busy,
+		Max:          s.max,
+		QueueWait:    s.wait,
+		MaxQueueWait: s.maxWait,
+		Rejections:   s.rejections.snapshot(),
+	}
+
+	if s.executed == 0 {
+		return res
+	}
+
+	res.Avg = s.busy / time.Duration(s.executed)
+	res.AvgQueueWait = s.wait / time.Duration(s.executed)
+	res.P50, res.P90, res.P99 = s.busies.percentiles()
+	res.QueueWaitP50, res.QueueWaitP90, res.QueueWaitP99 = s.waits.percentiles()
+
+	return res
+}
+
+// reservoir is a uniform sample of up to statsSamples durations
+type reservoir struct {
+	samples []time.Duration
+	count   int
+	rnd     uint64
+}
+
+func (r *reservoir) add(d time.Duration) {
+	r.count++
+	if len(r.samples) < statsSamples {
+		r.samples = append(r.samples, d)
+		return
+	}
+	if i := r.random() % uint64(r.count); i < statsSamples {
+		r.samples[i] = d
+	}
+}
+
+// random is a xorshift generator, good enough for sampling
+func (r *reservoir) random() uint64 {
+	if r.rnd == 0 {
+		r.rnd = 0x9e3779b97f4a7c15
+	}
+	r.rnd ^= r.rnd << 13
+	r.rnd ^= r.rnd >> 7
+	r.rnd ^= r.rnd << 17
+	return r.rnd
+}
+
+func (r *reservoir) reset() {
+	*r = reservoir{samples: r.samples[:0]}
+}
+
+// percentiles returns P50, P90 and P99 of the sample
+func (r *reservoir) percentiles() (p50, p90, p99 time.Duration) {
+	if len(r.samples) == 0 {
+		return 0, 0, 0
+	}
+	sorted := slices.Clone(r.samples)
+	slices.Sort(sorted)
+	return percentile(sorted, 0.5), percentile(sorted, 0.9), percentile(sorted, 0.99)
+}
+
+// percentile returns the nearest rank percentile of the sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
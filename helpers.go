@@ -0,0 +1,48 @@
+package wpool
+
+import "context"
+
+// Map executes the requests in the pool and returns their responses in the order of the requests.
+// Responses of tasks, which are rejected, dropped, failed or not done before the context is done, are zero values.
+// The tasks are executed in the group bound to the context, see Pool.AcquireGroupContext.
+func Map[Req any, Resp any](ctx context.Context, pool *Pool[Req, Resp], reqs []Req) []Resp {
+	g := pool.AcquireGroupContext(ctx)
+	defer pool.ReleaseGroup(g)
+
+	// requests are submitted one by one, so the submission call of the task is the position of its request,
+	// task indexes do not follow the order of requests, if tasks are coalesced, see Options.CoalesceWindow
+	for _, req := range reqs {
+		_ = g.Submit(req)
+	}
+
+	res := make([]Resp, len(reqs))
+	g.receive(ctx, func(r result[Req, Resp]) bool {
+		if r.call >= 0 && r.call < len(res) && r.err == nil && !r.dropped {
+			res[r.call] = r.resp
+		}
+		return true
+	})
+	return res
+}
+
+// ForEach executes the requests in the pool for their side effects and waits for all of them to be done.
+// Responses and errors of tasks are discarded without delivery to the group, like with Pool.Do.
+// It returns the first rejection of a request, see `group.Submit`, or the error of WaitErr,
+// if not all tasks are done before the context is done. The tasks are executed in the group bound to the context.
+func ForEach[Req any, Resp any](ctx context.Context, pool *Pool[Req, Resp], reqs []Req) error {
+	g := pool.AcquireGroupContext(ctx)
+	defer pool.ReleaseGroup(g)
+	g.discard = true
+
+	var err error
+	for _, req := range reqs {
+		if e := g.Submit(req); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	if _, e := g.WaitErr(ctx, nil); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,194 @@
+package wpool
+
+import (
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KindStats is the accounting of executed tasks of the kind, see TypedOptions.KindFunc
+type KindStats struct {
+	// Tasks is a count of executed tasks
+	Tasks int64
+	// Busy is a total handler wall time, summed over attempts
+	Busy time.Duration
+	// CPU is an estimated CPU time, see Options.KindCPUTime.
+	// Go does not measure CPU time per goroutine, so the user CPU time of the process is split between kinds
+	// in proportion to their wall time since the previous Pool.KindStats call. The estimate includes CPU time
+	// outside of the handlers, e.g. of the submitters and GC, so use it for the cost attribution only.
+	CPU time.Duration
+
+	// AllocSamples is a count of tasks sampled for heap allocations, see Options.KindAllocSampling.
+	// AllocBytes and AllocObjects are heap allocations of the sampled tasks, summed over attempts,
+	// e.g. AllocBytes / AllocSamples is an average of bytes allocated per task. Allocations are measured
+	// by process-wide runtime metrics, so they include allocations of concurrent goroutines, and small
+	// allocations are accounted in batches. Use them to compare kinds, not as exact values.
+	AllocSamples int64
+	AllocBytes   int64
+	AllocObjects int64
+}
+
+type kindCounters struct {
+	tasks        int64
+	busy         int64
+	allocSamples int64
+	allocBytes   int64
+	allocObjects int64
+
+	// guarded by the kindStats mutex
+	cpu      time.Duration
+	lastBusy int64
+}
+
+// kindStats accumulates tasks wall time by kinds. Counters are created once per kind and updated atomically.
+type kindStats struct {
+	counters sync.Map // kind -> *kindCounters
+	cpu      bool
+
+	mu      sync.Mutex // guards the CPU estimation
+	lastCPU float64
+	sample  []metrics.Sample
+}
+
+func (k *kindStats) kind(kind string) *kindCounters {
+	v, ok := k.counters.Load(kind)
+	if !ok {
+		v, _ = k.counters.LoadOrStore(kind, &kindCounters{})
+	}
+	return v.(*kindCounters)
+}
+
+func (k *kindStats) record(kind string, busy int64) {
+	c := k.kind(kind)
+	atomic.AddInt64(&c.tasks, 1)
+	atomic.AddInt64(&c.busy, busy)
+}
+
+func (k *kindStats) recordAllocs(kind string, bytes, objects int64) {
+	c := k.kind(kind)
+	atomic.AddInt64(&c.allocSamples, 1)
+	atomic.AddInt64(&c.allocBytes, bytes)
+	atomic.AddInt64(&c.allocObjects, objects)
+}
+
+// KindStats returns the accounting of executed tasks by kinds, see TypedOptions.KindFunc.
+// Returns nil, if the pool has no KindFunc.
+func (w *Pool[Req, Resp]) KindStats() map[string]KindStats {
+	if w.kindFunc == nil {
+		return nil
+	}
+	return w.kinds.snapshot()
+}
+
+func (k *kindStats) snapshot() map[string]KindStats {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	res := map[string]KindStats{}
+	var busyDelta int64
+	k.counters.Range(func(key, v any) bool {
+		c := v.(*kindCounters)
+		busy := atomic.LoadInt64(&c.busy)
+		busyDelta += busy - c.lastBusy
+		res[key.(string)] = KindStats{
+			Tasks:        atomic.LoadInt64(&c.tasks),
+			Busy:         time.Duration(busy),
+			AllocSamples: atomic.LoadInt64(&c.allocSamples),
+			AllocBytes:   atomic.LoadInt64(&c.allocBytes),
+			AllocObjects: atomic.LoadInt64(&c.allocObjects),
+		}
+		return true
+	})
+
+	if !k.cpu {
+		return res
+	}
+
+	// split the process CPU time since the previous call by the kinds wall time
+	cpu := k.userCPU()
+	cpuDelta := cpu - k.lastCPU
+	k.lastCPU = cpu
+	k.counters.Range(func(key, v any) bool {
+		s, ok := res[key.(string)]
+		if !ok {
+			// the kind is added after the wall time is summed
+			return true
+		}
+		c := v.(*kindCounters)
+		if busy := int64(s.Busy); busyDelta > 0 {
+			c.cpu += time.Duration(cpuDelta * float64(busy-c.lastBusy) / float64(busyDelta) * float64(time.Second))
+			c.lastBusy = busy
+		}
+		s.CPU = c.cpu
+		res[key.(string)] = s
+		return true
+	})
+
+	return res
+}
+
+// userCPU returns the user CPU time of the process in seconds
+func (k *kindStats) userCPU() float64 {
+	if k.sample == nil {
+		k.sample = []metrics.Sample{{Name: "/cpu/classes/user:cpu-seconds"}}
+	}
+	metrics.Read(k.sample)
+	if k.sample[0].Value.Kind() != metrics.KindFloat64 {
+		return 0
+	}
+	return k.sample[0].Value.Float64()
+}
+
+// waitKind parks the task until a slot of its kind is released, see Options.KindLimits.
+// It must be called under the mutex, the mutex is unlocked.
+func (w *Pool[Req, Resp]) waitKind(t *task[Req, Resp]) error {
+	if w.saturationPolicy == SaturationReject || t.try {
+		w.mu.Unlock()
+		w.traceDecision(ReasonRejected)
+		w.releaseTask(t)
+		return ErrSaturated
+	}
+
+	t.group.accept(t)
+	dequeued := make(chan struct{})
+	t.dequeued = dequeued
+
+	q := w.kindWaiting[t.kind]
+	if q == nil {
+		q = &fifo[*task[Req, Resp]]{}
+		w.kindWaiting[t.kind] = q
+	}
+	q.push(t)
+	w.mu.Unlock()
+
+	w.traceDecision(ReasonKindLimited)
+	select {
+	case <-dequeued:
+	case <-t.group.cancelCh:
+		// the task stays in the kind queue, it is dropped by the worker
+	}
+
+	return nil
+}
+
+// releaseKind releases the slot of the kind and queues the next task of the kind, if any
+func (w *Pool[Req, Resp]) releaseKind(kind string) {
+	w.mu.Lock()
+	w.kindRunning[kind]--
+
+	q := w.kindWaiting[kind]
+	if q == nil || q.len() == 0 {
+		w.mu.Unlock()
+		return
+	}
+
+	// the task is already accepted, so it is queued regardless of limits
+	t, _ := q.pop()
+	w.kindRunning[kind]++
+	t.kindSlot = true
+	w.enqueue(t)
+	w.mu.Unlock()
+
+	w.kick()
+}
@@ -0,0 +1,56 @@
+package wpool
+
+import (
+	"context"
+)
+
+// Handler is the handler of the task, as seen by Middleware.
+// The context is the task context, see NewWithContext, it is not canceled for handlers without context.
+type Handler[Req any, Resp any] func(ctx context.Context, req Req) (Resp, error)
+
+// Middleware wraps the handler, e.g. to add a timeout, logging or retries around every handler call.
+// The middleware may call the next handler many times, or not call it at all.
+type Middleware[Req any, Resp any] func(next Handler[Req, Resp]) Handler[Req, Resp]
+
+// AcquireGroupWithMiddleware acquires the new group with options, which tasks are executed by the handler
+// wrapped with the middleware. The group middleware is called inside the pool TypedOptions.Middleware,
+// or instead of it, if GroupOptions.OverrideMiddleware is set. The same rules as for AcquireGroup apply.
+func (w *Pool[Req, Resp]) AcquireGroupWithMiddleware(opts *GroupOptions, middleware ...Middleware[Req, Resp]) *Group[Req, Resp] {
+	g := w.AcquireGroupWithOptions(opts)
+	if opts != nil && opts.OverrideMiddleware {
+		g.middleware = middleware
+	} else if len(middleware) > 0 {
+		g.middleware = append(append([]Middleware[Req, Resp](nil), w.middleware...), middleware...)
+	}
+	return g
+}
+
+// invoke calls the handler wrapped with the group middleware.
+// Panics of the middleware are recovered like panics of the handler.
+func (w *Pool[Req, Resp]) invoke(ctx context.Context, t *task[Req, Resp], scratch any, emit func(Resp)) (Resp, error) {
+	chain := t.group.middleware
+	if len(chain) == 0 {
+		return w.handler(ctx, &t.req, t.attempt, scratch, emit)
+	}
+
+	return w.recoverPanics(func(ctx context.Context, req *Req, attempt int, scratch any, emit func(Resp)) (Resp, error) {
+		h := func(ctx context.Context, req Req) (Resp, error) {
+			// the boxed request does not escape to the heap on every call
+			box, _ := w.reqBoxes.Get().(*Req)
+			if box == nil {
+				box = new(Req)
+			}
+			*box = req
+			defer func() {
+				var zero Req
+				*box = zero
+				w.reqBoxes.Put(box)
+			}()
+			return w.handler(ctx, box, attempt, scratch, emit)
+		}
+		for i := len(chain) - 1; i >= 0; i-- {
+			h = chain[i](h)
+		}
+		return h(ctx, *req)
+	})(ctx, &t.req, t.attempt, scratch, emit)
+}
@@ -0,0 +1,67 @@
+package wpool
+
+// ordered releases results of the ordered group in the order of tasks, see GroupOptions.Ordered.
+// It is guarded by the group mutex.
+type ordered[Req any, Resp any] struct {
+	enabled bool
+	next    int                             // index of the next task, which results are released
+	slots   map[int]*orderedSlot[Req, Resp] // results of tasks after the next one
+}
+
+type orderedSlot[Req any, Resp any] struct {
+	results []result[Req, Resp]
+	done    bool // the final result of the task is delivered
+}
+
+// AcquireOrderedGroup acquires the new group, which returns responses in the order of `group.Go` calls,
+// see GroupOptions.Ordered.
+func (w *Pool[Req, Resp]) AcquireOrderedGroup() *Group[Req, Resp] {
+	return w.AcquireGroupWithOptions(&GroupOptions{Ordered: true})
+}
+
+// pushOrdered passes the result to the results buffer, when results of all previous tasks are released.
+// The final result completes the task, other results are emitted by the running task, see NewWithEmit.
+func (g *Group[Req, Resp]) pushOrdered(r result[Req, Resp], final bool) {
+	o := &g.order
+	if r.index != o.next {
+		if o.slots == nil {
+			o.slots = make(map[int]*orderedSlot[Req, Resp])
+		}
+		s := o.slots[r.index]
+		if s == nil {
+			s = &orderedSlot[Req, Resp]{}
+			o.slots[r.index] = s
+		}
+		if !r.empty {
+			s.results = append(s.results, r)
+		}
+		s.done = final
+		return
+	}
+
+	if !r.empty {
+		g.append(r)
+	}
+	if !final {
+		return
+	}
+
+	// release results of the next tasks, the running task keeps its slot to emit results later
+	delete(o.slots, o.next)
+	o.next++
+	for {
+		s := o.slots[o.next]
+		if s == nil {
+			return
+		}
+		for _, v := range s.results {
+			g.append(v)
+		}
+		s.results = nil
+		if !s.done {
+			return
+		}
+		delete(o.slots, o.next)
+		o.next++
+	}
+}
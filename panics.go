@@ -0,0 +1,88 @@
+package wpool
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// panicsHistory is a count of the recent panics retained by the pool
+const panicsHistory = 16
+
+// PanicInfo is a recovered handler panic
+type PanicInfo struct {
+	// Kind is the task kind, see TypedOptions.KindFunc
+	Kind string
+	// Time is the time of the panic
+	Time time.Time
+	// Value is the value passed to panic
+	Value any
+	// Stack is the stack trace of the panicked goroutine
+	Stack []byte
+}
+
+// panics counts recovered panics per task kind and retains the recent ones
+type panics struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	recent [panicsHistory]PanicInfo
+	next   int
+	total  int
+}
+
+func (p *panics) record(info PanicInfo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.counts == nil {
+		p.counts = make(map[string]int64)
+	}
+	p.counts[info.Kind]++
+	p.recent[p.next] = info
+	p.next = (p.next + 1) % panicsHistory
+	p.total++
+}
+
+// recoverPanics returns the handler, which recovers panics of the handler into PanicError
+func (w *Pool[Req, Resp]) recoverPanics(handler handlerFunc[Req, Resp]) handlerFunc[Req, Resp] {
+	return func(ctx context.Context, req *Req, attempt int, scratch any, emit func(Resp)) (resp Resp, err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				pe := &PanicError{Value: v, Stack: debug.Stack()}
+				info := PanicInfo{Time: time.Now(), Value: v, Stack: pe.Stack}
+				if w.kindFunc != nil {
+					info.Kind = w.kindFunc(*req)
+				}
+				w.panics.record(info)
+				err = pe
+			}
+		}()
+		return handler(ctx, req, attempt, scratch, emit)
+	}
+}
+
+// Panics returns counts of recovered handler panics per task kind, see TypedOptions.KindFunc
+func (w *Pool[Req, Resp]) Panics() map[string]int64 {
+	w.panics.mu.Lock()
+	defer w.panics.mu.Unlock()
+
+	res := make(map[string]int64, len(w.panics.counts))
+	for k, v := range w.panics.counts {
+		res[k] = v
+	}
+	return res
+}
+
+// RecentPanics returns up to 16 recent handler panics, the most recent is the last
+func (w *Pool[Req, Resp]) RecentPanics() []PanicInfo {
+	w.panics.mu.Lock()
+	defer w.panics.mu.Unlock()
+
+	n := min(w.panics.total, panicsHistory)
+	res := make([]PanicInfo, 0, n)
+	for i := 0; i < n; i++ {
+		res = append(res, w.panics.recent[(w.panics.next-n+i+panicsHistory)%panicsHistory])
+	}
+	return res
+}
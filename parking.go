@@ -0,0 +1,62 @@
+package wpool
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// defaultPeakWindow is a default window of the busy workers peak, see Options.SpareWorkersRatio
+const defaultPeakWindow = time.Minute
+
+// parking keeps idle workers for the recent peak of busy workers, see Options.SpareWorkersRatio.
+// It is guarded by the pool mutex.
+type parking struct {
+	ratio  float64
+	window time.Duration
+
+	start    time.Time // start of the current window
+	current  int64     // peak of the current window
+	previous int64     // peak of the previous window
+}
+
+// rotate starts a new window, if the current one is over
+func (p *parking) rotate(now time.Time) {
+	elapsed := now.Sub(p.start)
+	if elapsed < p.window {
+		return
+	}
+	p.previous = p.current
+	if elapsed >= 2*p.window {
+		p.previous = 0
+	}
+	p.current = 0
+	p.start = now
+}
+
+// observe records the count of busy workers
+func (p *parking) observe(now time.Time, busy int64) {
+	p.rotate(now)
+	if busy > p.current {
+		p.current = busy
+	}
+}
+
+// keep returns the count of workers to keep: the recent peak of busy workers with spare workers
+func (p *parking) keep(now time.Time) int64 {
+	p.rotate(now)
+	peak := max(p.current, p.previous)
+	return int64(math.Ceil(float64(peak) * (1 + p.ratio)))
+}
+
+// observeBusy records the count of busy workers for the parking policy, it must be called under the mutex
+func (w *Pool[Req, Resp]) observeBusy() {
+	if w.parking != nil {
+		w.parking.observe(time.Now(), atomic.LoadInt64(&w.workersCount)-int64(len(w.idle)))
+	}
+}
+
+// parked reports whether the idle worker must be kept by the parking policy, it must be called under the mutex
+func (w *Pool[Req, Resp]) parked() bool {
+	return w.parking != nil && atomic.LoadInt64(&w.workersCount) <= w.parking.keep(time.Now())
+}
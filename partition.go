@@ -0,0 +1,191 @@
+package wpool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Partition is a set of keyed sub-pools, see Pool.Partition
+type Partition[Req any, Resp any] struct {
+	parent *Pool[Req, Resp]
+	keyFn  func(Req) string
+	perKey func(key string) *Options
+
+	mu    sync.Mutex
+	pools map[string]*Pool[Req, Resp]
+}
+
+// Partition creates a set of sub-pools, which are created on demand per key of the request.
+// Sub-pools run the pool handler and share the pool workers budget: the count of tasks executed at once
+// by the pool and all its sub-pools is limited by the pool WorkersLimitMax.
+// Every sub-pool has its own queue, scheduling and limits from perKey options, which may be nil for defaults,
+// and the typed options of the pool, see TypedOptions.
+// Sub-pools are shut down with the pool.
+func (w *Pool[Req, Resp]) Partition(keyFn func(Req) string, perKey func(key string) *Options) *Partition[Req, Resp] {
+	w.mu.Lock()
+	if w.budget == nil {
+		w.budget = newWorkerBudget(w.workersLimitMax)
+	}
+	w.mu.Unlock()
+
+	p := &Partition[Req, Resp]{
+		parent: w,
+		keyFn:  keyFn,
+		perKey: perKey,
+		pools:  make(map[string]*Pool[Req, Resp]),
+	}
+
+	w.OnShutdown(p.shutdown)
+
+	return p
+}
+
+// Pool returns the sub-pool of the key, the sub-pool is created on the first call
+func (p *Partition[Req, Resp]) Pool(key string) *Pool[Req, Resp] {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if sub, ok := p.pools[key]; ok {
+		return sub
+	}
+
+	var opts *Options
+	if p.perKey != nil {
+		opts = p.perKey(key)
+	}
+
+	sub := newPool(p.parent.baseHandler, p.parent.newScratch, opts, p.parent.typed, p.parent.budget)
+	sub.contextAware = p.parent.contextAware
+	sub.emitting = p.parent.emitting
+	p.pools[key] = sub
+
+	return sub
+}
+
+// For returns the sub-pool of the request key
+func (p *Partition[Req, Resp]) For(req Req) *Pool[Req, Resp] {
+	return p.Pool(p.keyFn(req))
+}
+
+// Keys returns keys of created sub-pools
+func (p *Partition[Req, Resp]) Keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := make([]string, 0, len(p.pools))
+	for k := range p.pools {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (p *Partition[Req, Resp]) shutdown() {
+	p.mu.Lock()
+	pools := make([]*Pool[Req, Resp], 0, len(p.pools))
+	for _, sub := range p.pools {
+		pools = append(pools, sub)
+	}
+	p.mu.Unlock()
+
+	for _, sub := range pools {
+		_ = sub.Shutdown(context.Background())
+	}
+}
+
+// kicker is a pool, which waits for the workers budget
+type kicker interface {
+	kick()
+}
+
+// workerBudget limits the count of tasks executed at once by the pool and its partitions.
+// Busy workers hold a share of the budget, idle workers release it.
+type workerBudget struct {
+	limit int64
+
+	mu       sync.Mutex
+	used     int64
+	starving map[kicker]struct{} // pools, which are denied a share
+}
+
+func newWorkerBudget(limit int64) *workerBudget {
+	return &workerBudget{
+		limit:    limit,
+		starving: make(map[kicker]struct{}),
+	}
+}
+
+// take takes a share of the budget. If the budget is exhausted, the pool is kicked, when a share is released.
+func (b *workerBudget) take(k kicker) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limit <= 0 || b.used < b.limit {
+		b.used++
+		return true
+	}
+	b.starving[k] = struct{}{}
+	return false
+}
+
+// release releases the share and kicks starving pools
+func (b *workerBudget) release() {
+	b.mu.Lock()
+	b.used--
+	var starving []kicker
+	for k := range b.starving {
+		starving = append(starving, k)
+		delete(b.starving, k)
+	}
+	b.mu.Unlock()
+
+	// pools are kicked asynchronously, because the share is released under the mutex of another pool
+	for _, k := range starving {
+		go k.kick()
+	}
+}
+
+// takeBudget takes a share of the budget for a worker, must be called under the mutex
+func (w *Pool[Req, Resp]) takeBudget() bool {
+	return w.budget == nil || w.budget.take(w)
+}
+
+// releaseBudget releases the share of the worker, must be called under the mutex
+func (w *Pool[Req, Resp]) releaseBudget(wk *worker[Req, Resp]) {
+	if wk.budget {
+		wk.budget = false
+		w.budget.release()
+	}
+}
+
+// kick wakes up an idle worker or starts a new one, if there are queued tasks and the budget allows
+func (w *Pool[Req, Resp]) kick() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.queue.len() == 0 && (w.spill == nil || w.spill.len() == 0) {
+		return
+	}
+
+	if w.overLimit(1) {
+		return
+	}
+
+	if n := len(w.idle); n > 0 {
+		if !w.takeBudget() {
+			return
+		}
+		wk := w.idle[n-1]
+		w.idle[n-1] = nil
+		w.idle = w.idle[:n-1]
+		w.storeGauges()
+		wk.budget = true
+		wk.ch <- nil
+		return
+	}
+
+	if (w.workersLimitMax <= 0 || atomic.LoadInt64(&w.workersCount) < w.workersLimitMax) && w.takeBudget() {
+		atomic.AddInt64(&w.workersCount, 1)
+		w.spawnWorker(nil, true)
+	}
+}
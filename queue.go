@@ -0,0 +1,339 @@
+package wpool
+
+// fifo is a simple slice based FIFO queue
+type fifo[T any] struct {
+	items []T
+	head  int
+}
+
+func (q *fifo[T]) len() int {
+	return len(q.items) - q.head
+}
+
+func (q *fifo[T]) push(v T) {
+	// compact the queue, if the most of the items are already popped
+	if q.head > 32 && q.head*2 > len(q.items) {
+		n := copy(q.items, q.items[q.head:])
+		var zero T
+		for i := n; i < len(q.items); i++ {
+			q.items[i] = zero
+		}
+		q.items = q.items[:n]
+		q.head = 0
+	}
+	q.items = append(q.items, v)
+}
+
+func (q *fifo[T]) pop() (T, bool) {
+	var zero T
+	if q.head == len(q.items) {
+		return zero, false
+	}
+	v := q.items[q.head]
+	q.items[q.head] = zero
+	q.head++
+	if q.head == len(q.items) {
+		q.items = q.items[:0]
+		q.head = 0
+	}
+	return v, true
+}
+
+// taskHeap is a binary heap of tasks ordered by taskBefore
+type taskHeap[Req any, Resp any] struct {
+	items []*task[Req, Resp]
+}
+
+func (h *taskHeap[Req, Resp]) len() int {
+	return len(h.items)
+}
+
+func (h *taskHeap[Req, Resp]) peek() *task[Req, Resp] {
+	if len(h.items) == 0 {
+		return nil
+	}
+	return h.items[0]
+}
+
+func (h *taskHeap[Req, Resp]) push(t *task[Req, Resp]) {
+	h.items = append(h.items, t)
+
+	// sift up
+	i := len(h.items) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !taskBefore(h.items[i], h.items[parent]) {
+			break
+		}
+		h.items[i], h.items[parent] = h.items[parent], h.items[i]
+		i = parent
+	}
+}
+
+func (h *taskHeap[Req, Resp]) pop() *task[Req, Resp] {
+	n := len(h.items)
+	if n == 0 {
+		return nil
+	}
+
+	t := h.items[0]
+	h.items[0] = h.items[n-1]
+	h.items[n-1] = nil
+	h.items = h.items[:n-1]
+	h.down(0)
+
+	return t
+}
+
+// down sifts the item at i down
+func (h *taskHeap[Req, Resp]) down(i int) {
+	n := len(h.items)
+	for {
+		left := 2*i + 1
+		if left >= n {
+			break
+		}
+		j := left
+		if right := left + 1; right < n && taskBefore(h.items[right], h.items[left]) {
+			j = right
+		}
+		if !taskBefore(h.items[j], h.items[i]) {
+			break
+		}
+		h.items[i], h.items[j] = h.items[j], h.items[i]
+		i = j
+	}
+}
+
+// filter removes and returns tasks, for which keep returns false
+func (h *taskHeap[Req, Resp]) filter(keep func(t *task[Req, Resp]) bool) []*task[Req, Resp] {
+	var removed []*task[Req, Resp]
+	n := 0
+	for _, t := range h.items {
+		if keep(t) {
+			h.items[n] = t
+			n++
+		} else {
+			removed = append(removed, t)
+		}
+	}
+	for i := n; i < len(h.items); i++ {
+		h.items[i] = nil
+	}
+	h.items = h.items[:n]
+
+	for i := n/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+
+	return removed
+}
+
+// drain removes and returns all tasks in no particular order
+func (h *taskHeap[Req, Resp]) drain() []*task[Req, Resp] {
+	tasks := make([]*task[Req, Resp], len(h.items))
+	copy(tasks, h.items)
+	for i := range h.items {
+		h.items[i] = nil
+	}
+	h.items = h.items[:0]
+	return tasks
+}
+
+// taskBefore reports whether the task a should be executed before the task b: the higher priority first,
+// then the earliest deadline first, see TypedOptions.DeadlineFunc, tasks without deadline after tasks with deadline,
+// then in the queue order. The group deadline does not change the order.
+func taskBefore[Req any, Resp any](a, b *task[Req, Resp]) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	ad, bd := !a.due.IsZero(), !b.due.IsZero()
+	if ad != bd {
+		return ad
+	}
+	if ad && !a.due.Equal(b.due) {
+		return a.due.Before(b.due)
+	}
+	return a.seq < b.seq
+}
+
+// taskQueue is a queue of tasks waiting for a free worker.
+// Tasks are queued per group, the queue picks the group with the first task by taskBefore.
+// With boostWaiting, groups blocked in Wait are picked first.
+// With retryLimit, retried tasks are queued separately and at most retryLimit of them are executed at once.
+type taskQueue[Req any, Resp any] struct {
+	groups       []*Group[Req, Resp] // groups with queued tasks
+	count        int
+	seq          uint64
+	boostWaiting bool
+
+	retries      fifo[*task[Req, Resp]] // retried tasks, see Options.RetryShare
+	retryLimit   int                    // 0, if retried tasks are queued with fresh tasks
+	retryRunning int
+}
+
+func (q *taskQueue[Req, Resp]) len() int {
+	return q.count
+}
+
+func (q *taskQueue[Req, Resp]) push(t *task[Req, Resp]) {
+	q.seq++
+	t.seq = q.seq
+
+	if q.retryLimit > 0 && t.attempt > 1 {
+		q.retries.push(t)
+		q.count++
+		return
+	}
+
+	g := t.group
+	if g.queued.len() == 0 {
+		q.groups = append(q.groups, g)
+	}
+	g.queued.push(t)
+	q.count++
+}
+
+// pop returns the next task, or nil, if the queue is empty or only retried tasks over the limit are queued
+func (q *taskQueue[Req, Resp]) pop() *task[Req, Resp] {
+	if q.count == 0 {
+		return nil
+	}
+
+	if q.retryRunning < q.retryLimit {
+		if t, ok := q.retries.pop(); ok {
+			q.retryRunning++
+			t.retried = true
+			q.count--
+			return t
+		}
+	}
+	if len(q.groups) == 0 {
+		return nil
+	}
+
+	idx := 0
+	for i := 1; i < len(q.groups); i++ {
+		if q.before(q.groups[i], q.groups[idx]) {
+			idx = i
+		}
+	}
+
+	g := q.groups[idx]
+	t := g.queued.pop()
+	q.count--
+
+	if g.queued.len() == 0 {
+		last := len(q.groups) - 1
+		q.groups[idx] = q.groups[last]
+		q.groups[last] = nil
+		q.groups = q.groups[:last]
+	}
+
+	return t
+}
+
+// before reports whether the group a should be picked before the group b
+func (q *taskQueue[Req, Resp]) before(a, b *Group[Req, Resp]) bool {
+	if q.boostWaiting {
+		aw, bw := a.isWaiting(), b.isWaiting()
+		if aw != bw {
+			return aw
+		}
+	}
+	return taskBefore(a.queued.peek(), b.queued.peek())
+}
+
+// ahead returns the count of queued tasks, which are executed before the queued task t, ignoring boostWaiting
+func (q *taskQueue[Req, Resp]) ahead(t *task[Req, Resp]) int {
+	n := 0
+	for _, g := range q.groups {
+		for _, v := range g.queued.items {
+			if taskBefore(v, t) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// remove removes all queued tasks of the group and returns them
+func (q *taskQueue[Req, Resp]) remove(g *Group[Req, Resp]) []*task[Req, Resp] {
+	for i, v := range q.groups {
+		if v != g {
+			continue
+		}
+
+		last := len(q.groups) - 1
+		q.groups[i] = q.groups[last]
+		q.groups[last] = nil
+		q.groups = q.groups[:last]
+
+		tasks := g.queued.drain()
+		q.count -= len(tasks)
+
+		return tasks
+	}
+
+	return nil
+}
+
+// retryDone releases the slot of the retried task after the attempt
+func (q *taskQueue[Req, Resp]) retryDone(t *task[Req, Resp]) {
+	if t.retried {
+		t.retried = false
+		q.retryRunning--
+	}
+}
+
+// removeRetries removes retried tasks of the group and returns them
+func (q *taskQueue[Req, Resp]) removeRetries(g *Group[Req, Resp]) []*task[Req, Resp] {
+	return q.filterRetries(func(t *task[Req, Resp]) bool {
+		return t.group != g
+	})
+}
+
+// filterRetries removes and returns retried tasks, for which keep returns false
+func (q *taskQueue[Req, Resp]) filterRetries(keep func(t *task[Req, Resp]) bool) []*task[Req, Resp] {
+	if q.retries.len() == 0 {
+		return nil
+	}
+	var removed []*task[Req, Resp]
+	var kept fifo[*task[Req, Resp]]
+	for {
+		t, ok := q.retries.pop()
+		if !ok {
+			break
+		}
+		if keep(t) {
+			kept.push(t)
+		} else {
+			removed = append(removed, t)
+		}
+	}
+	q.retries = kept
+	q.count -= len(removed)
+	return removed
+}
+
+// filter removes and returns queued tasks, for which keep returns false
+func (q *taskQueue[Req, Resp]) filter(keep func(t *task[Req, Resp]) bool) []*task[Req, Resp] {
+	removed := q.filterRetries(keep)
+	retried := len(removed)
+
+	n := 0
+	for _, g := range q.groups {
+		removed = append(removed, g.queued.filter(keep)...)
+		if g.queued.len() > 0 {
+			q.groups[n] = g
+			n++
+		}
+	}
+	for i := n; i < len(q.groups); i++ {
+		q.groups[i] = nil
+	}
+	q.groups = q.groups[:n]
+	q.count -= len(removed) - retried
+
+	return removed
+}
@@ -0,0 +1,87 @@
+package wpool
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// errRateLimited is returned by TryGo, if the task is rejected by GroupOptions.RateLimit
+var errRateLimited = fmt.Errorf("%w: group rate limit", ErrSaturated)
+
+// RejectionStats counts tasks rejected at submission by causes, see Stats.Rejections and GroupStats.Rejections
+type RejectionStats struct {
+	// Saturated is a count of tasks rejected by SaturationReject policy, Options.KindLimits or TryGo, see ErrSaturated
+	Saturated int64
+	// RateLimited is a count of tasks rejected by GroupOptions.RateLimit in TryGo
+	RateLimited int64
+	// QueueFull is a count of tasks rejected by OverflowReject policy, see ErrQueueFull
+	QueueFull int64
+	// Deadline is a count of tasks submitted after their deadline, see TypedOptions.DeadlineFunc
+	Deadline int64
+	// Canceled is a count of tasks submitted to the canceled group, see ErrGroupCanceled
+	Canceled int64
+	// Closed is a count of tasks submitted to the closed pool, see ErrPoolClosed
+	Closed int64
+	// Released is a count of tasks submitted to the released or transferred group
+	Released int64
+	// Intercepted is a count of tasks rejected by TypedOptions.Interceptors or TypedOptions.Prepare
+	Intercepted int64
+}
+
+// rejectCause is a cause of the task rejection
+type rejectCause int
+
+const (
+	rejectSaturated rejectCause = iota
+	rejectRateLimited
+	rejectQueueFull
+	rejectDeadline
+	rejectCanceled
+	rejectClosed
+	rejectReleased
+	rejectIntercepted
+
+	rejectCausesCount
+)
+
+// rejectCauseOf classifies the error of the rejected task
+func rejectCauseOf(err error) rejectCause {
+	switch {
+	case errors.Is(err, errRateLimited):
+		return rejectRateLimited
+	case errors.Is(err, ErrSaturated):
+		return rejectSaturated
+	case errors.Is(err, ErrQueueFull):
+		return rejectQueueFull
+	case errors.Is(err, ErrDeadlineExceeded):
+		return rejectDeadline
+	case errors.Is(err, ErrGroupCanceled):
+		return rejectCanceled
+	case errors.Is(err, ErrPoolClosed):
+		return rejectClosed
+	case errors.Is(err, ErrGroupReleased), errors.Is(err, ErrGroupTransferred):
+		return rejectReleased
+	}
+	return rejectIntercepted
+}
+
+// rejections counts rejected tasks by causes
+type rejections [rejectCausesCount]int64
+
+func (r *rejections) record(err error) {
+	atomic.AddInt64(&r[rejectCauseOf(err)], 1)
+}
+
+func (r *rejections) snapshot() RejectionStats {
+	return RejectionStats{
+		Saturated:   atomic.LoadInt64(&r[rejectSaturated]),
+		RateLimited: atomic.LoadInt64(&r[rejectRateLimited]),
+		QueueFull:   atomic.LoadInt64(&r[rejectQueueFull]),
+		Deadline:    atomic.LoadInt64(&r[rejectDeadline]),
+		Canceled:    atomic.LoadInt64(&r[rejectCanceled]),
+		Closed:      atomic.LoadInt64(&r[rejectClosed]),
+		Released:    atomic.LoadInt64(&r[rejectReleased]),
+		Intercepted: atomic.LoadInt64(&r[rejectIntercepted]),
+	}
+}
@@ -0,0 +1,34 @@
+package wpool
+
+import (
+	"context"
+	"runtime/trace"
+	"strconv"
+)
+
+// runtimeTraceType returns the type of runtime/trace tasks of the pool, see Options.RuntimeTrace
+func runtimeTraceType(name string) string {
+	if name == "" {
+		return "wpool"
+	}
+	return "wpool/" + name
+}
+
+// traceRuntime starts the runtime/trace task of the handler invocation with the region of the task kind,
+// and logs the queue wait and the attempt. The returned function ends them.
+func (w *Pool[Req, Resp]) traceRuntime(ctx context.Context, t *task[Req, Resp]) (context.Context, func()) {
+	ctx, task := trace.NewTask(ctx, w.runtimeTraceType)
+	trace.Log(ctx, "wait", strconv.FormatInt(t.wait, 10)+"ns")
+	trace.Log(ctx, "attempt", strconv.Itoa(t.attempt))
+
+	kind := t.kind
+	if kind == "" {
+		kind = "handler"
+	}
+	region := trace.StartRegion(ctx, kind)
+
+	return ctx, func() {
+		region.End()
+		task.End()
+	}
+}
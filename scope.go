@@ -0,0 +1,57 @@
+package wpool
+
+import "context"
+
+// Scope runs fn with the scope of tasks executed in the pool. When Scope returns, all tasks spawned via the scope
+// are done or dropped: if fn returns an error or panics, or the context is done, the scope is canceled,
+// see Group.Cancel, and Scope waits for running tasks to finish, so long handlers should observe the canceled context,
+// see NewWithContext. The panic of fn is propagated after that.
+// Scope returns the error of fn or errors of tasks, which are not received by `scope.Wait`, see Group.WaitErr.
+func Scope[Req any, Resp any](ctx context.Context, pool *Pool[Req, Resp], fn func(s *ScopeGroup[Req, Resp]) error) (err error) {
+	g := pool.AcquireGroupContext(ctx)
+	s := &ScopeGroup[Req, Resp]{g: g, ctx: ctx}
+
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			g.Cancel()
+		}
+		<-g.settled()
+		pool.ReleaseGroup(g)
+	}()
+
+	err = fn(s)
+	panicked = false
+	if err != nil {
+		return err
+	}
+	_, err = g.WaitErr(ctx, nil)
+	return err
+}
+
+// ScopeGroup is the group of tasks spawned within Scope
+type ScopeGroup[Req any, Resp any] struct {
+	g   *Group[Req, Resp]
+	ctx context.Context
+}
+
+// Go runs the task in the scope, see Group.Go
+func (s *ScopeGroup[Req, Resp]) Go(req Req) {
+	s.g.Go(req)
+}
+
+// Submit runs the task in the scope like Go, but returns an error, if the task is rejected, see Group.Submit
+func (s *ScopeGroup[Req, Resp]) Submit(req Req) error {
+	return s.g.Submit(req)
+}
+
+// Wait waits for all tasks spawned so far to be done or the scope context is done
+// and returns responses of succeeded tasks and errors of failed tasks, see Group.WaitErr
+func (s *ScopeGroup[Req, Resp]) Wait(dest []Resp) ([]Resp, error) {
+	return s.g.WaitErr(s.ctx, dest)
+}
+
+// Cancel cancels the scope: queued tasks are dropped, see Group.Cancel. Scope still waits for running tasks.
+func (s *ScopeGroup[Req, Resp]) Cancel() {
+	s.g.Cancel()
+}
@@ -0,0 +1,67 @@
+package wpool
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+// defaultShadowBuffer is a default count of sampled tasks buffered for TypedOptions.ShadowSink
+const defaultShadowBuffer = 1024
+
+// shadowRecord is the completed task copied to the shadow sink
+type shadowRecord[Req any, Resp any] struct {
+	req  Req
+	resp Resp
+	info TaskInfo
+}
+
+// shadow copies a fraction of completed tasks to the sink in its own goroutine, see Options.ShadowRate.
+// Workers never wait for the sink: if the buffer is full, the sampled task is not copied.
+type shadow[Req any, Resp any] struct {
+	rate    float64
+	sink    func(req Req, resp Resp, info TaskInfo)
+	records chan shadowRecord[Req, Resp]
+	dropped int64
+}
+
+func newShadow[Req any, Resp any](rate float64, buffer int, sink func(Req, Resp, TaskInfo)) *shadow[Req, Resp] {
+	if buffer <= 0 {
+		buffer = defaultShadowBuffer
+	}
+	return &shadow[Req, Resp]{
+		rate:    rate,
+		sink:    sink,
+		records: make(chan shadowRecord[Req, Resp], buffer),
+	}
+}
+
+// sample copies the completed task to the buffer, if it is sampled
+func (s *shadow[Req, Resp]) sample(req Req, resp Resp, info TaskInfo) {
+	if s.rate < 1 && rand.Float64() >= s.rate {
+		return
+	}
+	select {
+	case s.records <- shadowRecord[Req, Resp]{req: req, resp: resp, info: info}:
+	default:
+		atomic.AddInt64(&s.dropped, 1)
+	}
+}
+
+// run passes buffered tasks to the sink until the pool is closed and all its tasks are done
+func (s *shadow[Req, Resp]) run(done <-chan struct{}) {
+	for {
+		select {
+		case r := <-s.records:
+			s.sink(r.req, r.resp, r.info)
+		case <-done:
+			for {
+				select {
+				case r := <-s.records:
+					s.sink(r.req, r.resp, r.info)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
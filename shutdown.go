@@ -0,0 +1,173 @@
+package wpool
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Shutdown stops accepting new tasks, `group.Submit` returns ErrPoolClosed, and drains the pool:
+// queued tasks with priority below Options.ShutdownDropBelow are dropped without execution,
+// the remaining queued tasks are executed in the priority order, then all workers are stopped
+// and the OnShutdown hooks are called.
+// If the context is done before the pool is drained, the remaining queued tasks are abandoned and delivered
+// as dropped results, and Shutdown returns *ShutdownError with the count of dropped tasks, wrapping the context error.
+// Running tasks are not interrupted, workers are stopped and hooks are called in background after they are done.
+func (w *Pool[Req, Resp]) Shutdown(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrPoolClosed
+	}
+	w.closed = true
+	w.queue.boostWaiting = false
+
+	dropped := w.queue.filter(func(t *task[Req, Resp]) bool {
+		return t.priority >= w.shutdownDropBelow
+	})
+	for _, t := range dropped {
+		w.queuedBytes -= t.size
+		if t.dequeued != nil {
+			close(t.dequeued)
+			t.dequeued = nil
+		}
+	}
+	// idle workers exit, busy workers exit after the queue is drained, see next
+	w.wakeIdle()
+	w.signalRoom()
+	w.storeGauges()
+
+	drained := make(chan struct{})
+	w.drained = drained
+	w.checkDrained()
+	w.mu.Unlock()
+
+	w.dropShutdown(dropped)
+
+	close(w.stop)
+	go w.watchStuck(drained)
+
+	go func() {
+		<-drained
+		w.closeSpill()
+		w.runShutdownHooks()
+		close(w.done)
+	}()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return &ShutdownError{Dropped: len(dropped) + w.abandon(), Err: ctx.Err()}
+	}
+}
+
+// closeSpill closes and removes the spill file of the drained pool
+func (w *Pool[Req, Resp]) closeSpill() {
+	if w.spill == nil {
+		return
+	}
+	w.spill.close()
+}
+
+// abandon drops all queued, spilled, kind and group limited tasks of the closed pool. Returns the count of dropped tasks.
+func (w *Pool[Req, Resp]) abandon() int {
+	w.mu.Lock()
+	dropped := w.queue.filter(func(*task[Req, Resp]) bool { return false })
+	for _, t := range dropped {
+		w.queuedBytes -= t.size
+	}
+	if w.spill != nil {
+		dropped = append(dropped, w.spill.clear()...)
+	}
+	for kind, q := range w.kindWaiting {
+		for q.len() > 0 {
+			t, _ := q.pop()
+			dropped = append(dropped, t)
+		}
+		delete(w.kindWaiting, kind)
+	}
+	for g := range w.groupWaiting {
+		dropped = append(dropped, w.dropGroupWaiting(g)...)
+	}
+	for _, t := range dropped {
+		if t.dequeued != nil {
+			close(t.dequeued)
+			t.dequeued = nil
+		}
+	}
+	w.signalRoom()
+	w.storeGauges()
+	w.checkDrained()
+	w.mu.Unlock()
+
+	w.dropShutdown(dropped)
+
+	return len(dropped)
+}
+
+// dropShutdown delivers tasks dropped by Shutdown as dropped results
+func (w *Pool[Req, Resp]) dropShutdown(dropped []*task[Req, Resp]) {
+	for _, t := range dropped {
+		w.traceDecision(ReasonDropped)
+		t.deliver(result[Req, Resp]{index: t.index, dropped: true})
+		w.releaseTask(t)
+	}
+}
+
+// Close gracefully stops the pool: it stops accepting new tasks, executes queued and in-flight tasks,
+// then waits for all worker goroutines to exit, including min workers.
+// Unlike Shutdown, Close may be called many times, each call waits for the pool to stop.
+func (w *Pool[Req, Resp]) Close() {
+	_ = w.Shutdown(context.Background())
+	<-w.done
+	w.workers.Wait()
+}
+
+// checkDrained closes the drained channel, if the closed pool has no queued tasks and all workers are idle.
+// It must be called under the mutex, when a worker goes idle or stops.
+func (w *Pool[Req, Resp]) checkDrained() {
+	if w.drained == nil || w.queue.len() > 0 || (w.spill != nil && w.spill.len() > 0) {
+		return
+	}
+	if int64(len(w.idle)) < atomic.LoadInt64(&w.workersCount) {
+		return
+	}
+	close(w.drained)
+	w.drained = nil
+}
+
+// wakeIdle takes all idle workers on shutdown, they exit in next, it must be called under the mutex.
+// Channels of idle workers are empty, so sends do not block.
+func (w *Pool[Req, Resp]) wakeIdle() {
+	for i, wk := range w.idle {
+		w.idle[i] = nil
+		wk.ch <- nil
+	}
+	w.idle = w.idle[:0]
+}
+
+// OnShutdown registers the hook, which is called once after the pool is drained by Shutdown,
+// e.g. to close dependent resources. Hooks are called in the reverse order of registration.
+// If the pool is already torn down, the hook is called immediately.
+func (w *Pool[Req, Resp]) OnShutdown(fn func()) {
+	w.mu.Lock()
+	if !w.tornDown {
+		w.hooks = append(w.hooks, fn)
+		w.mu.Unlock()
+		return
+	}
+	w.mu.Unlock()
+	fn()
+}
+
+func (w *Pool[Req, Resp]) runShutdownHooks() {
+	w.mu.Lock()
+	hooks := w.hooks
+	w.hooks = nil
+	w.tornDown = true
+	w.mu.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
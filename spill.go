@@ -0,0 +1,205 @@
+package wpool
+
+import (
+	"os"
+	"sync"
+)
+
+const (
+	defaultSpillThreshold = 1024
+
+	// defaultSpillSegmentSize is a size of the spill file, after which new requests are written to the next file,
+	// so consumed files are removed under the sustained backlog
+	defaultSpillSegmentSize = 64 << 20
+)
+
+// spill stores encoded requests of queued tasks in temporary files.
+// Tasks themselves stay in memory without requests, so the group accounting is not affected.
+// The order of spilled tasks is guarded by the pool mutex, while requests are encoded, written and read
+// outside of it: the pool mutex only hands off records.
+type spill[Req any, Resp any] struct {
+	codec     Codec[Req]
+	dir       string
+	threshold int
+	segment   int64 // see defaultSpillSegmentSize
+
+	records fifo[*spillRecord[Req, Resp]] // guarded by the pool mutex
+
+	mu    sync.Mutex
+	file  *spillFile   // the file for new records
+	files []*spillFile // open files, including the current one
+}
+
+// spillFile is a segment of the spill, it is removed, when all its records are read
+type spillFile struct {
+	f       *os.File
+	size    int64
+	pending int // count of records written to the file and not read yet
+}
+
+type spillRecord[Req any, Resp any] struct {
+	t      *task[Req, Resp]
+	file   *spillFile
+	offset int64
+	size   int
+	err    error         // the request is not written, it is kept in the task
+	ready  chan struct{} // closed, when the request is written or failed to be written
+}
+
+func newSpill[Req any, Resp any](codec Codec[Req], dir string, threshold int) *spill[Req, Resp] {
+	if threshold <= 0 {
+		threshold = defaultSpillThreshold
+	}
+	return &spill[Req, Resp]{
+		codec:     codec,
+		dir:       dir,
+		threshold: threshold,
+		segment:   defaultSpillSegmentSize,
+	}
+}
+
+// len returns the count of spilled tasks, guarded by the pool mutex
+func (s *spill[Req, Resp]) len() int {
+	return s.records.len()
+}
+
+// push reserves the record for the task, guarded by the pool mutex. The request is written by write after that.
+// While there are spilled tasks, new queued tasks should be spilled too, to keep FIFO order.
+func (s *spill[Req, Resp]) push(t *task[Req, Resp]) *spillRecord[Req, Resp] {
+	r := &spillRecord[Req, Resp]{t: t, ready: make(chan struct{})}
+	s.records.push(r)
+	return r
+}
+
+// write stores the request of the reserved record to the spill file, it is called without the pool mutex.
+// If the request can not be stored, it is kept in memory and the error is returned.
+func (s *spill[Req, Resp]) write(r *spillRecord[Req, Resp]) error {
+	defer close(r.ready)
+
+	data, err := s.codec.Encode(r.t.req)
+	if err == nil {
+		err = s.reserve(r, len(data))
+	}
+	if err == nil {
+		// records do not overlap, so files are written concurrently
+		if _, err = r.file.f.WriteAt(data, r.offset); err != nil {
+			s.release(r.file)
+		}
+	}
+	if err != nil {
+		r.err = err
+		return err
+	}
+
+	var zero Req
+	r.t.req = zero
+	return nil
+}
+
+// reserve places the record to the current file, or to the new one, if the current file is full
+func (s *spill[Req, Resp]) reserve(r *spillRecord[Req, Resp], size int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil || s.file.size >= s.segment {
+		f, err := os.CreateTemp(s.dir, "wpool-spill-*")
+		if err != nil {
+			return err
+		}
+		old := s.file
+		s.file = &spillFile{f: f}
+		s.files = append(s.files, s.file)
+		if old != nil && old.pending == 0 {
+			s.remove(old)
+		}
+	}
+
+	r.file, r.offset, r.size = s.file, s.file.size, size
+	s.file.size += int64(size)
+	s.file.pending++
+	return nil
+}
+
+// pop takes the oldest spilled record, guarded by the pool mutex. The task is restored by restore after that.
+func (s *spill[Req, Resp]) pop() *spillRecord[Req, Resp] {
+	r, _ := s.records.pop()
+	return r
+}
+
+// restore reads the request of the record back to the task, it is called without the pool mutex.
+// If the request can not be decoded, the task is returned with an error.
+func (s *spill[Req, Resp]) restore(r *spillRecord[Req, Resp]) (*task[Req, Resp], error) {
+	<-r.ready
+	if r.err != nil {
+		// the request is kept in memory
+		return r.t, nil
+	}
+
+	data := make([]byte, r.size)
+	_, err := r.file.f.ReadAt(data, r.offset)
+	if err == nil {
+		r.t.req, err = s.codec.Decode(data)
+	}
+	s.release(r.file)
+
+	return r.t, err
+}
+
+// release marks the record of the file as read. The drained file is reused from the beginning,
+// if it is the current one, or removed otherwise.
+func (s *spill[Req, Resp]) release(file *spillFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file.pending--
+	if file.pending > 0 {
+		return
+	}
+	if file != s.file {
+		s.remove(file)
+		return
+	}
+	file.size = 0
+	_ = file.f.Truncate(0)
+}
+
+// remove closes and removes the file, guarded by mu
+func (s *spill[Req, Resp]) remove(file *spillFile) {
+	_ = file.f.Close()
+	_ = os.Remove(file.f.Name())
+	for i, v := range s.files {
+		if v == file {
+			s.files = append(s.files[:i], s.files[i+1:]...)
+			break
+		}
+	}
+}
+
+// clear removes all spilled tasks without restoring requests, guarded by the pool mutex.
+// It waits for requests being written, it is called by Shutdown only.
+func (s *spill[Req, Resp]) clear() []*task[Req, Resp] {
+	var res []*task[Req, Resp]
+	for {
+		r, ok := s.records.pop()
+		if !ok {
+			break
+		}
+		<-r.ready
+		if r.err == nil {
+			s.release(r.file)
+		}
+		res = append(res, r.t)
+	}
+	return res
+}
+
+// close closes and removes spill files, it is called when the pool is drained by Shutdown
+func (s *spill[Req, Resp]) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.files) > 0 {
+		s.remove(s.files[0])
+	}
+	s.file = nil
+}
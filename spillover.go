@@ -0,0 +1,61 @@
+package wpool
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// spillover passes tasks to the secondary tier, when the estimated queue wait exceeds the threshold,
+// see TypedOptions.Spillover
+type spillover[Req any, Resp any] struct {
+	wait time.Duration
+	fn   func(ctx context.Context, req Req) (Resp, error)
+}
+
+// spillOver executes the task in the secondary tier and delivers its result to the group
+func (w *Pool[Req, Resp]) spillOver(t *task[Req, Resp]) {
+	atomic.AddInt64(&w.counters.spilledOver, 1)
+
+	ctx := context.Background()
+	if t.group.ctx != nil {
+		ctx = t.group.ctx
+	}
+	if t.ctx != nil {
+		ctx = valuesContext{Context: ctx, values: t.ctx}
+	}
+
+	start := nanotime()
+	w.taskStarted(t, start)
+	resp, err := w.spillover.fn(ctx, t.req)
+	t.busy = nanotime() - start
+	w.taskDone(t, resp, err)
+
+	t.deliver(t.result(resp, err))
+	w.releaseTask(t)
+}
+
+// SpilloverPool returns the function for TypedOptions.Spillover, which executes tasks in the secondary pool,
+// e.g. the pool with the own workers limit, which is used for bursts only
+func SpilloverPool[Req any, Resp any](pool *Pool[Req, Resp]) func(ctx context.Context, req Req) (Resp, error) {
+	return func(ctx context.Context, req Req) (Resp, error) {
+		g := pool.AcquireGroupContext(ctx)
+		defer pool.ReleaseGroup(g)
+
+		var zero Resp
+		if err := g.Submit(req); err != nil {
+			return zero, err
+		}
+		for _, r := range g.WaitResults(ctx, nil) {
+			switch {
+			case r.Err != nil:
+				return zero, r.Err
+			case r.Dropped:
+				return zero, ErrGroupCanceled
+			default:
+				return r.Resp, nil
+			}
+		}
+		return zero, ErrTaskTimeout
+	}
+}
@@ -0,0 +1,170 @@
+package wpool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the pool statistics, see Pool.Stats
+type Stats struct {
+	// Labels are the pool labels, see Options.Labels
+	Labels map[string]string
+
+	// Workers is a count of running workers, BusyWorkers and IdleWorkers are counts of workers executing tasks and parked.
+	// StuckWorkers is a count of workers stuck after Shutdown, they are excluded from Workers.
+	// WarmingWorkers is a count of workers running Options.WorkerWarmup, they are neither busy nor idle.
+	Workers        int64
+	BusyWorkers    int64
+	IdleWorkers    int64
+	StuckWorkers   int64
+	WarmingWorkers int64
+
+	// Submitted is a count of tasks passed to the pool, including rejected
+	Submitted int64
+	// Rejected is a count of tasks rejected by the pool, see ErrSaturated, ErrQueueFull, ErrDeadlineExceeded and ErrPoolClosed
+	Rejected int64
+	// Rejections is a count of tasks rejected at submission by causes, including rejections by groups
+	Rejections RejectionStats
+	// Completed is a count of executed tasks
+	Completed int64
+	// Dropped is a count of tasks dropped without execution
+	Dropped int64
+
+	// Queued is a count of tasks queued in memory, QueuedBytes is their size, see TypedOptions.SizeFunc
+	Queued      int64
+	QueuedBytes int64
+	// Spilled is a count of tasks spilled to disk, see TypedOptions.SpillCodec
+	Spilled int64
+
+	// HandlerTime is a cumulative handler execution time, summed over attempts
+	HandlerTime time.Duration
+
+	// GroupBufferGrowths is a count of the group results buffer reallocations on delivery,
+	// see Options.GroupResponseChannelSize
+	GroupBufferGrowths int64
+
+	// SpilledOver is a count of tasks passed to the secondary tier, see TypedOptions.Spillover
+	SpilledOver int64
+
+	// Deduplicated is a count of tasks joined to the in-flight task with the same key, see TypedOptions.DedupKey
+	Deduplicated int64
+
+	// ShadowDropped is a count of sampled tasks not passed to TypedOptions.ShadowSink, because its buffer is full
+	ShadowDropped int64
+}
+
+// TaskInfo is the executed task metadata, see TypedOptions.OnTaskDone
+type TaskInfo struct {
+	// Kind is the task kind, see TypedOptions.KindFunc
+	Kind string
+	// Attempts is a count of the task attempts, see TypedOptions.Retry
+	Attempts int
+	// Wait is a time from the submission to the first attempt
+	Wait time.Duration
+	// Busy is a handler execution time, summed over attempts
+	Busy time.Duration
+	// Err is the error returned by the handler, see NewWithError
+	Err error
+}
+
+// counters are pool-wide tasks counters
+type counters struct {
+	submitted     int64
+	rejected      int64
+	dropped       int64
+	bufferGrowths int64
+	deduplicated  int64
+	spilledOver   int64
+}
+
+// Stats returns the snapshot of the pool statistics. It reads only atomic counters,
+// so it may be called often, e.g. by metrics scrapers, without contention with tasks dispatching.
+// Counters are read one by one, so the snapshot is not strictly consistent.
+func (w *Pool[Req, Resp]) Stats() Stats {
+	s := Stats{
+		Workers:            w.WorkersCount(),
+		IdleWorkers:        atomic.LoadInt64(&w.gauges.idle),
+		StuckWorkers:       atomic.LoadInt64(&w.gauges.stuck),
+		WarmingWorkers:     atomic.LoadInt64(&w.gauges.warming),
+		Submitted:          atomic.LoadInt64(&w.counters.submitted),
+		Rejected:           atomic.LoadInt64(&w.counters.rejected),
+		Dropped:            atomic.LoadInt64(&w.counters.dropped),
+		Queued:             atomic.LoadInt64(&w.gauges.queued),
+		QueuedBytes:        atomic.LoadInt64(&w.gauges.queuedBytes),
+		Spilled:            atomic.LoadInt64(&w.gauges.spilled),
+		GroupBufferGrowths: atomic.LoadInt64(&w.counters.bufferGrowths),
+		Rejections:         w.rejections.snapshot(),
+		Deduplicated:       atomic.LoadInt64(&w.counters.deduplicated),
+		SpilledOver:        atomic.LoadInt64(&w.counters.spilledOver),
+	}
+	if w.shadow != nil {
+		s.ShadowDropped = atomic.LoadInt64(&w.shadow.dropped)
+	}
+
+	if len(w.labels) > 0 {
+		s.Labels = w.Labels()
+	}
+
+	if s.BusyWorkers = s.Workers - s.IdleWorkers - s.WarmingWorkers; s.BusyWorkers < 0 {
+		s.BusyWorkers = 0
+	}
+
+	busy, _ := w.UtilizationTimes()
+	completed, callerTime := w.util.completed()
+	s.Completed = completed
+	s.HandlerTime = busy + callerTime
+
+	return s
+}
+
+// estimateStart returns the estimated time until the task with the given queue position starts,
+// based on the average handler time since the pool creation. It is called on the submission path,
+// so it reads the utilization counters only.
+func (w *Pool[Req, Resp]) estimateStart(position int) time.Duration {
+	workers := max(atomic.LoadInt64(&w.workersCount), 1)
+	return w.util.averageTask() * time.Duration(position+1) / time.Duration(workers)
+}
+
+// taskStarted records the task attempt start, calls TypedOptions.OnTaskStart, audits the queue wait
+// and samples allocations before the first attempt
+func (w *Pool[Req, Resp]) taskStarted(t *task[Req, Resp], now int64) {
+	t.started(now)
+	if t.attempt != 1 {
+		return
+	}
+	if w.onTaskStart != nil {
+		w.onTaskStart(t.req)
+	}
+	if w.queueWaitAudit {
+		w.queueWaits.record(t.group.name, time.Duration(t.wait))
+	}
+	w.startAllocs(t)
+}
+
+// taskDone accounts the executed task by its kind, retains it, if it is failed,
+// calls TypedOptions.OnTaskDone and samples it for TypedOptions.ShadowSink
+func (w *Pool[Req, Resp]) taskDone(t *task[Req, Resp], resp Resp, err error) {
+	w.stopAllocs(t)
+	if w.kindFunc != nil {
+		w.kinds.record(t.kind, t.busy)
+	}
+	if err != nil && w.failures != nil {
+		w.failures.record(FailureInfo[Req]{Req: t.req, Err: err, Kind: t.kind, Attempts: t.attempt, Time: time.Now()})
+	}
+	if w.onTaskDone == nil && w.shadow == nil {
+		return
+	}
+	info := TaskInfo{
+		Kind:     t.kind,
+		Attempts: t.attempt,
+		Wait:     time.Duration(t.wait),
+		Busy:     time.Duration(t.busy),
+		Err:      err,
+	}
+	if w.onTaskDone != nil {
+		w.onTaskDone(t.req, resp, info)
+	}
+	if w.shadow != nil {
+		w.shadow.sample(t.req, resp, info)
+	}
+}
@@ -0,0 +1,140 @@
+package wpool
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// StuckWorker is a worker, which failed to exit within StopWorkerTimeout after Shutdown,
+// because the handler is blocked in user code
+type StuckWorker struct {
+	// ID is the worker sequence number
+	ID int64
+	// Busy is the time the worker spent executing the current task, when it was detected as stuck
+	Busy time.Duration
+	// Stack is the stack trace of the worker goroutine, nil if Options.StuckWorkerStacks is disabled
+	Stack []byte
+}
+
+// StuckWorkers returns workers detected as stuck after Shutdown.
+// Stuck workers are excluded from WorkersCount, and Close does not wait for them.
+func (w *Pool[Req, Resp]) StuckWorkers() []StuckWorker {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	res := make([]StuckWorker, len(w.stuck))
+	copy(res, w.stuck)
+	return res
+}
+
+// watchStuck marks workers, which are still busy after StopWorkerTimeout since Shutdown, as stuck
+func (w *Pool[Req, Resp]) watchStuck(drained <-chan struct{}) {
+	timer := time.NewTimer(w.stopWorkerTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-drained:
+		return
+	case <-timer.C:
+	}
+
+	// stacks are collected before the workers are marked, so stuck workers are reported with stacks,
+	// when Shutdown returns
+	var stacks map[int64][]byte
+	if w.stuckStacks {
+		stacks = goroutineStacks()
+	}
+	now := nanotime()
+
+	var stuck []StuckWorker
+	w.mu.Lock()
+	for wk := range w.live {
+		since := atomic.LoadInt64(&wk.busySince)
+		if since == 0 || wk.stuck {
+			continue
+		}
+		wk.stuck = true
+		atomic.AddInt64(&w.workersCount, -1)
+		stuck = append(stuck, StuckWorker{ID: wk.id, Busy: time.Duration(now - since), Stack: stacks[wk.goid]})
+	}
+	w.stuck = append(w.stuck, stuck...)
+	atomic.StoreInt64(&w.gauges.stuck, int64(len(w.stuck)))
+	w.checkDrained()
+	w.mu.Unlock()
+
+	// the stuck workers never call Done, so Close does not wait for them
+	for range stuck {
+		w.workers.Done()
+	}
+
+	if w.onStuckWorker != nil {
+		for _, s := range stuck {
+			w.onStuckWorker(s)
+		}
+	}
+}
+
+// releaseWorker decrements the workers count, when the worker stops, it must be called under the mutex.
+// Stuck workers are already excluded from the count.
+func (w *Pool[Req, Resp]) releaseWorker(wk *worker[Req, Resp]) {
+	if !wk.stuck {
+		atomic.AddInt64(&w.workersCount, -1)
+	}
+}
+
+// exited removes the worker goroutine from the pool
+func (w *Pool[Req, Resp]) exited(wk *worker[Req, Resp]) {
+	w.mu.Lock()
+	delete(w.live, wk)
+	stuck := wk.stuck
+	w.mu.Unlock()
+
+	if !stuck {
+		w.workers.Done()
+	}
+}
+
+// goid returns the id of the current goroutine
+func goid() int64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	id, _ := parseGoid(buf[:n])
+	return id
+}
+
+// parseGoid parses the goroutine id from the header of the goroutine stack trace, e.g. "goroutine 18 [running]:"
+func parseGoid(stack []byte) (int64, bool) {
+	stack, ok := bytes.CutPrefix(stack, []byte("goroutine "))
+	if !ok {
+		return 0, false
+	}
+	if i := bytes.IndexByte(stack, ' '); i > 0 {
+		stack = stack[:i]
+	}
+	id, err := strconv.ParseInt(string(stack), 10, 64)
+	return id, err == nil
+}
+
+// goroutineStacks returns stack traces of all goroutines by ids
+func goroutineStacks() map[int64][]byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+
+	res := map[int64][]byte{}
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if id, ok := parseGoid(stack); ok {
+			res[id] = stack
+		}
+	}
+	return res
+}
@@ -0,0 +1,120 @@
+package wpool
+
+import (
+	"sync/atomic"
+)
+
+// SchedulingReason is a reason of the scheduling decision made for a task
+type SchedulingReason int
+
+const (
+	// ReasonReusedIdle means the task is passed to an idle worker
+	ReasonReusedIdle SchedulingReason = iota
+	// ReasonSpawned means a new worker is started for the task
+	ReasonSpawned
+	// ReasonBlocked means the workers max limit is reached and the submitter waits for a free worker
+	ReasonBlocked
+	// ReasonQueued means the workers max limit is reached and the task is queued without blocking the submitter
+	ReasonQueued
+	// ReasonSpilled means the task is queued and spilled to disk
+	ReasonSpilled
+	// ReasonDropped means the task is dropped without execution
+	ReasonDropped
+	// ReasonRejected means the task is rejected by the saturation policy, the deadline, an interceptor or TypedOptions.Prepare
+	ReasonRejected
+	// ReasonCallerRuns means the task is executed by the submitter, according to the saturation policy
+	ReasonCallerRuns
+	// ReasonRetried means the task is queued again for the next attempt
+	ReasonRetried
+	// ReasonInlined means the last queued task of the group is executed by the goroutine waiting in `group.Wait`
+	ReasonInlined
+	// ReasonKindLimited means the task waits for a slot of its kind, see Options.KindLimits
+	ReasonKindLimited
+	// ReasonAffinity means the task is passed to the idle worker, which served the group last, see Options.GroupAffinity
+	ReasonAffinity
+	// ReasonCoalesced means the task is merged into the held task with the same key, see Options.CoalesceWindow
+	ReasonCoalesced
+	// ReasonGroupLimited means the task waits for a slot of its group, see Group.SetLimit
+	ReasonGroupLimited
+	// ReasonYielded means the queued task is executed inside Yield of the long-running task, see Options.YieldSlice
+	ReasonYielded
+	// ReasonDeduplicated means the task joins the in-flight task with the same key, see TypedOptions.DedupKey
+	ReasonDeduplicated
+	// ReasonSpillover means the task is passed to the secondary tier, see TypedOptions.Spillover
+	ReasonSpillover
+
+	reasonsCount
+)
+
+var reasonNames = [reasonsCount]string{
+	ReasonReusedIdle:   "reused_idle",
+	ReasonSpawned:      "spawned",
+	ReasonBlocked:      "blocked",
+	ReasonQueued:       "queued",
+	ReasonSpilled:      "spilled",
+	ReasonDropped:      "dropped",
+	ReasonRejected:     "rejected",
+	ReasonCallerRuns:   "caller_runs",
+	ReasonRetried:      "retried",
+	ReasonInlined:      "inlined",
+	ReasonKindLimited:  "kind_limited",
+	ReasonAffinity:     "affinity",
+	ReasonCoalesced:    "coalesced",
+	ReasonGroupLimited: "group_limited",
+	ReasonYielded:      "yielded",
+	ReasonDeduplicated: "deduplicated",
+	ReasonSpillover:    "spillover",
+}
+
+func (r SchedulingReason) String() string {
+	if r < 0 || r >= reasonsCount {
+		return "unknown"
+	}
+	return reasonNames[r]
+}
+
+// schedulingTrace counts scheduling decisions per reason
+type schedulingTrace struct {
+	counts     [reasonsCount]int64
+	onDecision func(reason SchedulingReason)
+}
+
+func (s *schedulingTrace) record(reason SchedulingReason) {
+	atomic.AddInt64(&s.counts[reason], 1)
+	if s.onDecision != nil {
+		s.onDecision(reason)
+	}
+}
+
+// SchedulingTrace returns counts of scheduling decisions per reason.
+// Returns nil, if the pool is created without Options.TraceScheduling.
+func (w *Pool[Req, Resp]) SchedulingTrace() map[SchedulingReason]int64 {
+	if w.trace == nil {
+		return nil
+	}
+	res := make(map[SchedulingReason]int64, reasonsCount)
+	for i := range w.trace.counts {
+		res[SchedulingReason(i)] = atomic.LoadInt64(&w.trace.counts[i])
+	}
+	return res
+}
+
+// traceDecision records the scheduling decision. Without Options.TraceScheduling only rejected and dropped tasks
+// are counted, so the check is inlined and other decisions cost nothing.
+func (w *Pool[Req, Resp]) traceDecision(reason SchedulingReason) {
+	if w.trace != nil || reason == ReasonRejected || reason == ReasonDropped {
+		w.recordDecision(reason)
+	}
+}
+
+func (w *Pool[Req, Resp]) recordDecision(reason SchedulingReason) {
+	switch reason {
+	case ReasonRejected:
+		atomic.AddInt64(&w.counters.rejected, 1)
+	case ReasonDropped:
+		atomic.AddInt64(&w.counters.dropped, 1)
+	}
+	if w.trace != nil {
+		w.trace.record(reason)
+	}
+}
@@ -0,0 +1,48 @@
+package wpool
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// GroupHandle is the group transferred to another owner, see Group.Transfer.
+// The owner of the handle waits for results of the group and releases it.
+type GroupHandle[Req any, Resp any] struct {
+	g *Group[Req, Resp]
+}
+
+// Transfer transfers the group to the owner of the returned handle, e.g. to a consumer goroutine, which waits
+// for results, while the producer only submits tasks. After the transfer, the group is barred from the previous owner:
+// Go and Submit drop tasks with ErrGroupTransferred, Wait and its variants return immediately and ReleaseGroup
+// does nothing. Call Transfer after all tasks are submitted. Returns nil, if the group is already transferred.
+func (g *Group[Req, Resp]) Transfer() *GroupHandle[Req, Resp] {
+	if !atomic.CompareAndSwapInt32(&g.transferred, 0, 1) {
+		return nil
+	}
+	return &GroupHandle[Req, Resp]{g: g}
+}
+
+// isTransferred reports whether the group is transferred, see Transfer
+func (g *Group[Req, Resp]) isTransferred() bool {
+	return atomic.LoadInt32(&g.transferred) != 0
+}
+
+// Wait waits for all tasks of the group, see Group.Wait
+func (h *GroupHandle[Req, Resp]) Wait(ctx context.Context, dest []Resp) []Resp {
+	return h.g.waitResps(ctx, dest)
+}
+
+// WaitErr waits for all tasks of the group, see Group.WaitErr
+func (h *GroupHandle[Req, Resp]) WaitErr(ctx context.Context, dest []Resp) ([]Resp, error) {
+	return h.g.waitErr(ctx, dest)
+}
+
+// WaitResults waits for all tasks of the group, see Group.WaitResults
+func (h *GroupHandle[Req, Resp]) WaitResults(ctx context.Context, dest []Result[Req, Resp]) []Result[Req, Resp] {
+	return h.g.waitResults(ctx, dest)
+}
+
+// Release releases the group, like Pool.ReleaseGroup. You must not use the handle after calling Release.
+func (h *GroupHandle[Req, Resp]) Release() {
+	h.g.pool.releaseGroup(h.g)
+}
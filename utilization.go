@@ -0,0 +1,136 @@
+package wpool
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// epoch is a base for monotonic timestamps
+var epoch = time.Now()
+
+// nanotime returns monotonic nanoseconds since the epoch
+func nanotime() int64 {
+	return int64(time.Since(epoch))
+}
+
+// utilization tracks the time workers spend executing tasks and the total workers lifetime.
+// Time of running workers and tasks is calculated as count*now - sum of start times,
+// so counters are updated only at start and stop.
+// Counters are sharded by workers to avoid contention between workers, reads sum all shards.
+type utilization struct {
+	shards []utilShard
+}
+
+// utilShard is a shard of the counters, it takes a cache line of 64 bytes
+type utilShard struct {
+	workers         int64
+	workersStartSum int64
+	workersTime     int64 // total lifetime of stopped workers
+
+	busy         int64
+	busyStartSum int64
+	busyTime     int64 // total time of done tasks
+
+	tasks      int64 // count of executed tasks
+	callerTime int64 // total time of tasks executed outside of workers, see SaturationCallerRuns
+}
+
+func newUtilization() utilization {
+	n := 1
+	for n < runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	return utilization{shards: make([]utilShard, n)}
+}
+
+// shard returns the counters shard for the worker id
+func (u *utilization) shard(id int64) *utilShard {
+	return &u.shards[id&int64(len(u.shards)-1)]
+}
+
+func (u *utilShard) workerStarted(now int64) {
+	atomic.AddInt64(&u.workersStartSum, now)
+	atomic.AddInt64(&u.workers, 1)
+}
+
+func (u *utilShard) workerStopped(start, now int64) {
+	atomic.AddInt64(&u.workersTime, now-start)
+	atomic.AddInt64(&u.workers, -1)
+	atomic.AddInt64(&u.workersStartSum, -start)
+}
+
+func (u *utilShard) taskStarted(now int64) {
+	atomic.AddInt64(&u.busyStartSum, now)
+	atomic.AddInt64(&u.busy, 1)
+}
+
+func (u *utilShard) taskDone(start, now int64) {
+	atomic.AddInt64(&u.busyTime, now-start)
+	atomic.AddInt64(&u.busy, -1)
+	atomic.AddInt64(&u.busyStartSum, -start)
+}
+
+func (u *utilShard) taskCompleted() {
+	atomic.AddInt64(&u.tasks, 1)
+}
+
+// callerTaskDone records the task executed outside of workers
+func (u *utilShard) callerTaskDone(busy int64) {
+	atomic.AddInt64(&u.callerTime, busy)
+	atomic.AddInt64(&u.tasks, 1)
+}
+
+// completed returns the count of executed tasks and the total time of tasks executed outside of workers
+func (u *utilization) completed() (tasks int64, callerTime time.Duration) {
+	for i := range u.shards {
+		tasks += atomic.LoadInt64(&u.shards[i].tasks)
+		callerTime += time.Duration(atomic.LoadInt64(&u.shards[i].callerTime))
+	}
+	return tasks, callerTime
+}
+
+// averageTask returns the average handler time of executed tasks, zero if no task is executed yet
+func (u *utilization) averageTask() time.Duration {
+	var tasks, busy int64
+	for i := range u.shards {
+		s := &u.shards[i]
+		tasks += atomic.LoadInt64(&s.tasks)
+		busy += atomic.LoadInt64(&s.busyTime) + atomic.LoadInt64(&s.callerTime)
+	}
+	if tasks == 0 {
+		return 0
+	}
+	return time.Duration(busy / tasks)
+}
+
+func (u *utilization) times(now int64) (busy, total time.Duration) {
+	for i := range u.shards {
+		s := &u.shards[i]
+		busy += time.Duration(atomic.LoadInt64(&s.busyTime) + atomic.LoadInt64(&s.busy)*now - atomic.LoadInt64(&s.busyStartSum))
+		total += time.Duration(atomic.LoadInt64(&s.workersTime) + atomic.LoadInt64(&s.workers)*now - atomic.LoadInt64(&s.workersStartSum))
+	}
+	if busy < 0 {
+		busy = 0
+	}
+	if busy > total {
+		busy = total
+	}
+	return busy, total
+}
+
+// UtilizationTimes returns the total time spent by workers executing tasks and the total lifetime of workers,
+// including running workers and tasks. The difference of two calls gives utilization over the interval.
+func (w *Pool[Req, Resp]) UtilizationTimes() (busy, total time.Duration) {
+	return w.util.times(nanotime())
+}
+
+// Utilization returns the fraction of the workers lifetime spent executing tasks since the pool creation, from 0 to 1.
+// Value close to 1 means the pool is under-provisioned, close to 0 means most of the workers are idle.
+func (w *Pool[Req, Resp]) Utilization() float64 {
+	busy, total := w.UtilizationTimes()
+	if total <= 0 {
+		return 0
+	}
+	return float64(busy) / float64(total)
+}
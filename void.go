@@ -0,0 +1,76 @@
+package wpool
+
+import "context"
+
+// VoidPool is the pool of tasks without responses, e.g. notifications or writes.
+// Results of its tasks are counted by groups, but never stored, so groups do not buffer responses.
+type VoidPool[Req any] struct {
+	pool *Pool[Req, struct{}]
+}
+
+// NewVoid creates the pool of tasks without responses with the handler, see New
+func NewVoid[Req any](handler func(Req), opts *Options, typed ...*TypedOptions[Req, struct{}]) *VoidPool[Req] {
+	pool := New[Req, struct{}](func(req Req) struct{} {
+		handler(req)
+		return struct{}{}
+	}, opts, typed...)
+	return &VoidPool[Req]{pool: pool}
+}
+
+// Do runs the task without waiting for it, see Pool.Do
+func (p *VoidPool[Req]) Do(req Req) error {
+	return p.pool.Do(req)
+}
+
+// AcquireGroup acquires the new group to wait for completion of its tasks.
+// You should call ReleaseGroup after `group.Wait` is done.
+func (p *VoidPool[Req]) AcquireGroup() *VoidGroup[Req] {
+	g := p.pool.AcquireGroup()
+	g.discard = true
+	return (*VoidGroup[Req])(g)
+}
+
+// ReleaseGroup releases the group. You must not use the group after calling ReleaseGroup.
+func (p *VoidPool[Req]) ReleaseGroup(g *VoidGroup[Req]) {
+	p.pool.ReleaseGroup(g.group())
+}
+
+// Pool returns the underlying pool, e.g. for Stats or Shutdown
+func (p *VoidPool[Req]) Pool() *Pool[Req, struct{}] {
+	return p.pool
+}
+
+// Close closes the pool and waits for all tasks to be done, see Pool.Close
+func (p *VoidPool[Req]) Close() {
+	p.pool.Close()
+}
+
+// VoidGroup is the group of tasks without responses, see VoidPool.AcquireGroup
+type VoidGroup[Req any] Group[Req, struct{}]
+
+func (g *VoidGroup[Req]) group() *Group[Req, struct{}] {
+	return (*Group[Req, struct{}])(g)
+}
+
+// Go runs the task in the group, see Group.Go
+func (g *VoidGroup[Req]) Go(req Req) {
+	g.group().Go(req)
+}
+
+// Submit runs the task in the group like Go, but returns an error, if the task is rejected, see Group.Submit
+func (g *VoidGroup[Req]) Submit(req Req) error {
+	return g.group().Submit(req)
+}
+
+// Wait waits for all submitted tasks to be done or the context is done, see Group.WaitErr.
+// It returns ErrTaskTimeout, if not all tasks are done, ErrGroupCanceled, if the group is canceled,
+// or ErrGroupReleased, if the group is used after ReleaseGroup.
+func (g *VoidGroup[Req]) Wait(ctx context.Context) error {
+	_, err := g.group().WaitErr(ctx, nil)
+	return err
+}
+
+// Cancel cancels the group, see Group.Cancel
+func (g *VoidGroup[Req]) Cancel() {
+	g.group().Cancel()
+}
@@ -2,6 +2,8 @@ package wpool
 
 import (
 	"context"
+	"runtime"
+	"runtime/trace"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -10,187 +12,1677 @@ import (
 const (
 	defaultWorkerTimeout             = time.Second * 5
 	defaultGroupsResponseChannelSize = 32
+
+	// groupSizeClasses is a count of the released groups size classes, by log2 of the results buffer capacity
+	groupSizeClasses = 32
 )
 
 // Pool is a worker pool
 type Pool[Req any, Resp any] struct {
-	handler                  func(Req) Resp
-	tasks                    chan *task[Req, Resp]
-	groupsPool               sync.Pool
+	handler                  handlerFunc[Req, Resp]
+	baseHandler              handlerFunc[Req, Resp] // the handler without chaos injection, for partitions
+	newScratch               func() any
+	disablePooling           bool
+	scratchPool              sync.Pool // scratch objects for tasks executed outside of workers
+	reqBoxes                 sync.Pool // *Req boxes of requests passed by the middleware to the handler
+	retry                    func(req Req, resp Resp, attempt int) bool
+	middleware               []Middleware[Req, Resp]
+	inlineLastTask           bool
+	labels                   map[string]string
+	prepare                  func(req Req) (Req, error)
+	interceptors             []func(req Req) (Req, error)
+	deadLetter               func(req Req, err error)
+	kindFunc                 func(Req) string
+	kindLimits               map[string]int
+	concurrencyFunc          func() int
+	parking                  *parking // the parking policy, see Options.SpareWorkersRatio
+	groupAffinity            bool
+	concurrency              int64 // the current limit of busy workers, see Options.ConcurrencyFunc
+	kinds                    kindStats
+	allocs                   *allocSampler // nil, if allocations are not sampled, see Options.KindAllocSampling
+	queueWaitAudit           bool
+	coalescer                *coalescer[Req, Resp] // nil, if tasks are not coalesced, see Options.CoalesceWindow
+	dedup                    *dedup[Req, Resp]     // nil, if tasks are not deduplicated, see TypedOptions.DedupKey
+	spillover                *spillover[Req, Resp] // nil, if there is no secondary tier, see TypedOptions.Spillover
+	shadow                   *shadow[Req, Resp]    // nil, if tasks are not copied, see TypedOptions.ShadowSink
+	failures                 *failures[Req]        // nil, if failures are not retained, see Options.FailureHistory
+	rejections               rejections
+	deprecations             *deprecations // nil, if no kinds are deprecated, see Options.DeprecatedKinds
+	queueWaits               queueWaits
+	baseCtx                  context.Context
+	traceExtractor           func(Req) context.Context
+	runtimeTraceType         string // empty, if runtime/trace tasks are disabled, see Options.RuntimeTrace
+	yieldSlice               time.Duration
+	invokeHook               func(context.Context, InvokeInfo) (context.Context, func(error))
+	contextAware             bool // the handler receives the task context, groups have contexts
+	emitting                 bool // the handler emits responses, see NewWithEmit
+	panics                   panics
+	prepareMu                sync.Mutex
+	groupsPools              [groupSizeClasses]sync.Pool // released groups by log2 of the results buffer capacity
 	tasksPool                sync.Pool
 	workersCount             int64
 	workersLimitMax          int64
 	workersLimitMin          int64
 	stopWorkerTimeout        time.Duration
+	workersLimitSoft         int64 // see Options.WorkersLimitSoft
+	burstWorkerTimeout       time.Duration
 	groupResponseChannelSize int
-}
+	groupSizeHint            int64 // average tasks count of released groups, see adaptGroupSize
+	onSpillError             func(err error)
+	sizeFunc                 func(Req) int
+	maxQueuedBytes           int
+	maxPending               int
+	overflowPolicy           OverflowPolicy
+	trace                    *schedulingTrace
+	chaos                    *chaos[Req, Resp]
+	util                     utilization
+	gauges                   gauges // copies of the mutex guarded gauges for lock-free reads
+	counters                 counters
+	live                     map[*worker[Req, Resp]]struct{} // running workers, guarded by the mutex
+	stuck                    []StuckWorker                   // workers stuck after shutdown, guarded by the mutex
+	onStuckWorker            func(StuckWorker)
+	stuckStacks              bool // see Options.StuckWorkerStacks
+	onTaskStart              func(Req)
+	onTaskDone               func(Req, Resp, TaskInfo)
+	onWorkerStart            func(id int64)
+	onWorkerStop             func(id int64)
+	workerWarmup             func(id int64)
+	deadlineFunc             func(Req) (time.Time, bool)
+	lockOSThread             bool
+	cpuAffinity              []int
+	onAffinityError          func(err error)
+	workersSeq               int64
+	spinIterations           int
+	saturationPolicy         SaturationPolicy
+	priorityFunc             func(Req) int
+	shutdownDropBelow        int
+	stop                     chan struct{}  // closed by Shutdown to stop background goroutines
+	done                     chan struct{}  // closed by Shutdown after the shutdown hooks are called
+	workers                  sync.WaitGroup // running worker goroutines
+
+	// the group of fire-and-forget tasks, see Do
+	doOnce  sync.Once
+	doGroup *Group[Req, Resp]
+
+	// typed are the typed options of the pool, sub-pools of partitions inherit them
+	typed *TypedOptions[Req, Resp]
 
-// Group is a group of tasks
-type Group[Req any, Resp any] struct {
-	handler         func(t *task[Req, Resp])
-	ch              chan Resp
-	counter         int64
-	acquireTaskFunc func() *task[Req, Resp]
+	mu          sync.Mutex
+	idle        []*worker[Req, Resp]               // idle workers, the most recently used is the last one
+	queue       taskQueue[Req, Resp]               // tasks waiting for a free worker
+	queuedBytes int                                // total size of queued requests, if sizeFunc is set
+	room        chan struct{}                      // closed when the queue has room, see hasRoom
+	spill       *spill[Req, Resp]                  // nil, if spilling is disabled
+	closed      bool                               // set by Shutdown, new tasks are rejected
+	drained     chan struct{}                      // closed when the closed pool has no queued tasks and busy workers
+	hooks       []func()                           // OnShutdown hooks
+	budget      *workerBudget                      // workers budget shared with partitions, nil if the pool is not partitioned
+	kindRunning map[string]int                     // count of tasks holding slots of the kind limits
+	kindWaiting map[string]*fifo[*task[Req, Resp]] // tasks waiting for a slot of the kind
+	tornDown    bool                               // set after the shutdown hooks are called
+
+	// tasks waiting for a slot of the group, see Group.SetLimit
+	groupWaiting map[*Group[Req, Resp]]*fifo[*task[Req, Resp]]
 }
 
 type task[Req any, Resp any] struct {
-	req Req
-	ch  chan<- Resp
+	req   Req
+	group *Group[Req, Resp]
+	index int // index of the task in the group
+	call  int // the submission call of the task in the group, unlike index it is not changed by coalescing
+	seq   uint64
+	// deadline is the task deadline from the TypedOptions.DeadlineFunc bounded by the group deadline,
+	// zero if the task has no deadline
+	deadline time.Time
+	// due is the deadline from the TypedOptions.DeadlineFunc, which orders queued tasks,
+	// the group deadline does not reorder tasks
+	due      time.Time
+	attempt  int
+	priority int
+	kind     string // the task kind, see TypedOptions.KindFunc
+	kindSlot bool   // the task holds a slot of the kind limit
+	// groupSlot is set, if the task holds a slot of the group limit, see Group.SetLimit
+	groupSlot bool
+	ctx       context.Context // the submission context, see group.SubmitContext
+	accepted  int64           // nanotime, when the task is accepted by the group
+	wait      int64           // nanoseconds from the acceptance to the first attempt
+	busy      int64           // nanoseconds of the handler execution, summed over attempts
+	// dequeued is closed when the queued task is taken by a worker, if the submitter waits for it
+	dequeued chan struct{}
+	size     int
+	try      bool       // the task is submitted by TryGo, it is rejected instead of waiting
+	retried  bool       // the task holds a slot of the retry share, see Options.RetryShare
+	info     *QueueInfo // the queue position of the task is reported to, see SubmitInfo
+	nested   bool       // the task is executed inside Yield of another task, see Options.YieldSlice
+
+	// heap allocations at the task start, if the task is sampled, see Options.KindAllocSampling
+	allocSampled bool
+	allocBytes   uint64
+	allocObjects uint64
+
+	// tasks merged into the task, see Options.CoalesceWindow
+	coalesced []coalesced[Req, Resp]
+
+	// dedupKey is the key of the task, joined are tasks joined to the in-flight task, guarded by the dedup mutex,
+	// see TypedOptions.DedupKey
+	dedupKey string
+	joined   []coalesced[Req, Resp]
+}
+
+// started records the queue wait before the first attempt
+func (t *task[Req, Resp]) started(now int64) {
+	if t.attempt == 1 {
+		t.wait = now - t.accepted
+	}
+}
+
+// deliver passes the result to the group of the task and to groups of tasks merged into it
+func (t *task[Req, Resp]) deliver(r result[Req, Resp]) {
+	r.call = t.call
+	t.group.deliver(r)
+	t.deliverCoalesced(r)
+}
+
+// deliverCoalesced passes the result to groups of tasks merged into the task, see Options.CoalesceWindow,
+// and joined to the task, see TypedOptions.DedupKey
+func (t *task[Req, Resp]) deliverCoalesced(r result[Req, Resp]) {
+	for _, m := range t.coalesced {
+		m.deliver(r)
+	}
+	if t.dedupKey != "" {
+		for _, m := range t.group.pool.dedup.finish(t) {
+			m.deliver(r)
+		}
+	}
+}
+
+func (t *task[Req, Resp]) result(resp Resp, err error) result[Req, Resp] {
+	return result[Req, Resp]{
+		req:     t.req,
+		resp:    resp,
+		err:     err,
+		index:   t.index,
+		call:    t.call,
+		attempt: t.attempt,
+		wait:    time.Duration(t.wait),
+		busy:    time.Duration(t.busy),
+	}
+}
+
+// taskResult returns the final result of the task.
+// Responses of NewWithEmit handlers are already emitted, so the final result is empty, unless the handler failed.
+func (w *Pool[Req, Resp]) taskResult(t *task[Req, Resp], resp Resp, err error) result[Req, Resp] {
+	r := t.result(resp, err)
+	r.empty = w.emitting && err == nil
+	return r
+}
+
+type result[Req any, Resp any] struct {
+	req     Req
+	resp    Resp
+	err     error
+	index   int
+	call    int // see task.call
+	attempt int
+	dropped bool
+	empty   bool // the final result of the task, which emitted its responses, see NewWithEmit, or handled by OnResult
+	shared  bool // the result of the task joined to the in-flight task, see TypedOptions.DedupKey
+	wait    time.Duration
+	busy    time.Duration
 }
 
-// Options is a pool options
+type worker[Req any, Resp any] struct {
+	ch      chan *task[Req, Resp] // a task to run, or nil to wake up the worker to take a queued task
+	scratch any                   // nil, if the pool has no scratch factory
+	budget  bool                  // the worker holds a share of the workers budget, guarded by the pool mutex
+	util    *utilShard            // utilization counters of the worker
+
+	id        int64 // the worker sequence number
+	goid      int64 // the worker goroutine id, zero if Options.StuckWorkerStacks is disabled
+	busySince int64 // start time of the current task, 0 if the worker is idle
+	lastDone  int64 // end time of the last task, the idle timeout is counted from it
+	stuck     bool  // the worker failed to exit after Shutdown, guarded by the pool mutex
+	stopped   bool  // the worker exits, because the pool is shut down, set by next
+}
+
+// SaturationPolicy defines how the pool handles tasks, when all workers are busy and the max limit is reached
+type SaturationPolicy int
+
+const (
+	// SaturationBlock queues the task and blocks the submitter until a worker takes it.
+	// If spilling is enabled, the task is queued without blocking.
+	SaturationBlock SaturationPolicy = iota
+	// SaturationReject never queues: the task is rejected immediately, `group.Submit` returns ErrSaturated
+	SaturationReject
+	// SaturationCallerRuns executes the task in the submitter goroutine, which slows down the producer
+	SaturationCallerRuns
+)
+
+// OverflowPolicy defines how the pool handles tasks, when the queue is full, see Options.MaxPendingTasks
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the submitter until the queue has room
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject rejects the task immediately, `group.Submit` returns ErrQueueFull
+	OverflowReject
+	// OverflowDropOldest drops the queued task, which would be executed next, to make room for the new task.
+	// For tasks of the same priority, it is the oldest one. The dropped task is delivered as a dropped result.
+	OverflowDropOldest
+)
+
+// Options is a pool options, see TypedOptions for options, which depend on request and response types
 type Options struct {
+	// Name is the pool name, default empty. It is added to the pool labels as the "name" label.
+	Name string
+
+	// Labels are constant labels of the pool, like component, default nil.
+	// Labels are added to the pool metrics to break them down by pool, if the binary runs many pools.
+	Labels map[string]string
+
 	// WorkersLimitMax is a maximum workers count, default 0 (unlimited)
 	WorkersLimitMax int
 
 	// WorkersLimitMin is a minimum workers count, default 0 (unlimited)
 	WorkersLimitMin int
 
-	// StopWorkerTimeout is a timeout for worker to stop, default 5 seconds
+	// WorkersLimitSoft is a preferred steady-state workers count, default 0 (disabled). The pool still spawns workers
+	// up to WorkersLimitMax for bursts, but idle workers above the soft limit stop after BurstWorkerTimeout,
+	// so the workers count decays back to the soft limit faster than with StopWorkerTimeout.
+	WorkersLimitSoft int
+
+	// BurstWorkerTimeout is an idle timeout of workers above WorkersLimitSoft, default StopWorkerTimeout / 10
+	BurstWorkerTimeout time.Duration
+
+	// StopWorkerTimeout is a timeout for worker to stop, default 5 seconds.
+	// Workers still busy after the timeout since Shutdown are reported as stuck, see Pool.StuckWorkers.
 	StopWorkerTimeout time.Duration
 
-	// GroupResponseChannelSize is the size of group response channel, default 32.
-	// Sized channel is used to receive responses from workers while waiting group.Wait call.
+	// SpareWorkersRatio enables the parking policy, default 0 (disabled): the idle worker stops after StopWorkerTimeout,
+	// only if the workers count exceeds the peak of busy workers over the recent PeakWindow by more than the ratio,
+	// e.g. with 0.25 the pool keeps 25 workers for the peak of 20. It avoids respawning workers under periodic traffic.
+	SpareWorkersRatio float64
+
+	// PeakWindow is a window of the busy workers peak, see SpareWorkersRatio, default 1 minute.
+	// The peak is kept for one to two windows.
+	PeakWindow time.Duration
+
+	// GroupAffinity enables the soft affinity between a group and the worker, which served it last, default false.
+	// The task is passed to that worker, if it is idle, otherwise to any idle worker,
+	// e.g. for handlers, which cache per-caller state in the worker scratch, see NewWithScratch.
+	GroupAffinity bool
+
+	// OnStuckWorker is called for each worker detected as stuck after Shutdown, e.g. to log its stack, see StuckWorkerStacks,
+	// default nil
+	OnStuckWorker func(StuckWorker)
+
+	// StuckWorkerStacks enables stacks of stuck workers, see StuckWorker.Stack, default false.
+	// The worker reads its goroutine id from the runtime stack, when it starts, so it is disabled by default.
+	StuckWorkerStacks bool
+
+	// OnWorkerStart and OnWorkerStop are called in the worker goroutine, when the worker starts and stops,
+	// e.g. to set up per-worker resources, default nil. The id is the worker sequence number.
+	OnWorkerStart func(id int64)
+	OnWorkerStop  func(id int64)
+
+	// WorkerWarmup is called in the worker goroutine after OnWorkerStart, before the worker takes tasks,
+	// e.g. to prime caches or dial connections, default nil. While it runs, the worker is counted as warming,
+	// see Stats.WarmingWorkers, and the task, which the worker is started for, waits for it.
+	WorkerWarmup func(id int64)
+
+	// GroupResponseChannelSize is the initial capacity of the group results buffer, default 32, see GroupOptions.Size.
+	// Workers never block on delivery, results are buffered by the group until group.Wait receives them.
+	// The initial capacity of groups without GroupOptions.Size grows to the average tasks count of released groups,
+	// so the buffer is not reallocated while results are delivered, see Stats.GroupBufferGrowths.
 	GroupResponseChannelSize int
+
+	// SpillThreshold is a maximum count of queued tasks kept in memory, if spilling is enabled, default 1024
+	SpillThreshold int
+
+	// SpillDir is a directory for the spill file, default os.TempDir()
+	SpillDir string
+
+	// OnSpillError is called when the task can not be spilled or restored.
+	// If the task can not be spilled, it is kept in memory. If the task can not be restored, it is dropped.
+	OnSpillError func(err error)
+
+	// MaxQueuedBytes is a maximum total size of requests queued in memory, default 0 (unlimited).
+	// Requires TypedOptions.SizeFunc. When the limit is reached, new queued tasks are spilled to disk if spilling is enabled,
+	// otherwise `group.Go` blocks until the queued size drops below the limit.
+	// A single task is always queued, even if its size is over the limit.
+	MaxQueuedBytes int
+
+	// MaxPendingTasks is a maximum count of tasks queued in memory, default 0 (unlimited).
+	// With the limit, SaturationBlock does not block the submitter until a worker takes the task,
+	// the submitter returns after the task is queued, and OverflowPolicy is applied, when the queue is full.
+	MaxPendingTasks int
+
+	// OverflowPolicy defines what happens with the task, when the queue is full, default OverflowBlock.
+	// It is applied, when MaxPendingTasks or MaxQueuedBytes is reached, and spilling is disabled.
+	OverflowPolicy OverflowPolicy
+
+	// TraceScheduling enables counting of scheduling decisions per reason, see Pool.SchedulingTrace, default false
+	TraceScheduling bool
+
+	// OnSchedulingDecision is called for every scheduling decision, if TraceScheduling is enabled.
+	// It is called synchronously on the dispatch path, so it must be fast.
+	OnSchedulingDecision func(reason SchedulingReason)
+
+	// SaturationPolicy defines what happens with the task, when the WorkersLimitMax is reached
+	// and there is no idle worker, default SaturationBlock
+	SaturationPolicy SaturationPolicy
+
+	// ShutdownDropBelow is a priority, below which queued tasks are dropped by Shutdown without execution,
+	// default 0 (tasks with negative priority are dropped).
+	ShutdownDropBelow int
+
+	// LockOSThread locks every worker to its own OS thread with runtime.LockOSThread, default false.
+	// The thread is not unlocked and terminates with the worker, so the thread state never leaks to other goroutines.
+	// Use it for handlers with thread-sensitive C libraries.
+	LockOSThread bool
+
+	// CPUAffinity is a list of CPUs, workers are pinned to, one CPU per worker in round-robin order, default nil.
+	// Supported on Linux only, enables LockOSThread.
+	CPUAffinity []int
+
+	// OnAffinityError is called, if the worker thread can not be pinned to the CPU.
+	// The worker continues to work without pinning.
+	OnAffinityError func(err error)
+
+	// SpinIterations is a count of attempts an idle worker polls for a new task before parking, default 0 (no spinning).
+	// Spinning lowers the dispatch latency for the cost of CPU time burned by idle workers,
+	// it makes sense for latency critical workloads with spare CPU cores only.
+	SpinIterations int
+
+	// BoostWaitingGroups is a scheduling hint: queued tasks of groups blocked in `group.Wait` are passed to workers
+	// before tasks of groups that do not wait yet, default false (tasks are passed in the queue order).
+	// Spilled tasks are not boosted.
+	BoostWaitingGroups bool
+
+	// InlineLastTask is a scheduling optimization for small groups, default false.
+	// When the pool is saturated, `group.Go` does not block for the first queued task of the group,
+	// and if exactly one task of the group is still queued when `group.Wait` is called, the task is executed
+	// by the waiting goroutine instead of a worker. The inlined task is not interrupted by the Wait context.
+	InlineLastTask bool
+
+	// ConcurrencyFunc returns the limit of busy workers, e.g. the count of healthy connections to the downstream service,
+	// default nil (no limit except WorkersLimitMax). It is called every ConcurrencyInterval, so the pool shrinks,
+	// when the dependency degrades: tasks over the limit are handled by the saturation policy, instead of piling on
+	// the dependency. The limit below 1 is treated as 1, so the pool keeps probing the dependency.
+	ConcurrencyFunc func() int
+
+	// ConcurrencyInterval is an interval of ConcurrencyFunc calls, default 1 second
+	ConcurrencyInterval time.Duration
+
+	// KindLimits are max counts of tasks of the kind executed at once, default nil (no limits).
+	// Kinds are returned by TypedOptions.KindFunc. Tasks over the limit wait for a slot of the kind, their submitters are blocked,
+	// so a slow kind can not crowd out other kinds. With SaturationReject policy, such tasks are rejected.
+	KindLimits map[string]int
+
+	// DeprecatedKinds are kinds returned by TypedOptions.KindFunc, which are deprecated, with their messages, e.g. the replacement,
+	// default nil. Submissions of tasks of deprecated kinds are reported to OnDeprecatedKind with the caller,
+	// at most once per DeprecationInterval per kind, so platform teams can find users of old kinds.
+	DeprecatedKinds map[string]string
+
+	// OnDeprecatedKind is called by the submitter of the task of the deprecated kind, default nil
+	OnDeprecatedKind func(info DeprecationInfo)
+
+	// DeprecationInterval is a min interval of OnDeprecatedKind calls per kind, default 1 minute
+	DeprecationInterval time.Duration
+
+	// ShadowRate is a fraction of completed tasks passed to TypedOptions.ShadowSink, from 0 to 1, default 0
+	ShadowRate float64
+
+	// ShadowBuffer is a count of sampled tasks buffered for TypedOptions.ShadowSink, default 1024
+	ShadowBuffer int
+
+	// SpilloverWait is the estimated queue wait, after which tasks are passed to TypedOptions.Spillover, see SubmitInfo.
+	// The estimation is based on the average handler time, so tasks are not spilled over before some are completed.
+	SpilloverWait time.Duration
+
+	// FailureHistory is a count of recent failed tasks retained with their errors, default 0 (disabled),
+	// so operators can inspect and re-run them without the dead letter persistence, see Pool.RecentFailures.
+	FailureHistory int
+
+	// BaseContext is the parent context of the task contexts, see NewWithContext, default context.Background()
+	BaseContext context.Context
+
+	// InvokeHook is called before each handler invocation, e.g. to start a tracing span, default nil.
+	// It returns the handler context and the function, which is called after the invocation with the handler error.
+	// The context has values of the submission context, see group.SubmitContext.
+	InvokeHook func(ctx context.Context, info InvokeInfo) (context.Context, func(err error))
+
+	// YieldSlice is a time slice of the task, after which Yield executes the next queued task in the handler goroutine,
+	// default 0 (Yield does not execute queued tasks). It is the soft preemption of long-running handlers,
+	// which call Yield at safe points, see Yield. It requires the context aware handler, see NewWithContext.
+	YieldSlice time.Duration
+
+	// RuntimeTrace wraps handler invocations in runtime/trace tasks of the type "wpool/<Name>" with regions
+	// named by the task kind, and logs queue waits and attempts in them, default false.
+	// So `go tool trace` shows the pool activity, queueing gaps and parked workers. It is cheap, while tracing is stopped.
+	RuntimeTrace bool
+
+	// KindCPUTime enables estimation of the CPU time per kind in Pool.KindStats, default false
+	KindCPUTime bool
+
+	// KindAllocSampling enables measuring heap allocations of every n-th task per kind in Pool.KindStats,
+	// default 0 (disabled). Reading runtime metrics costs about a microsecond, so sample the tasks in production.
+	KindAllocSampling int
+
+	// QueueWaitAudit enables accounting of queue waits by group names in Pool.QueueWaits, default false.
+	// Groups are named by GroupOptions.Name, use names of low cardinality, e.g. the tenant or the caller.
+	QueueWaitAudit bool
+
+	// CoalesceWindow enables coalescing of tasks with the same TypedOptions.CoalesceKey, default 0 (disabled).
+	// The first task of the key is held for the window, requests of tasks submitted within the window
+	// are merged into it by TypedOptions.CoalesceMerge, and all merged tasks receive the response of the held task.
+	// It reduces duplicate downstream load of bursty identical lookups at the cost of the window latency.
+	// If the held task is rejected, e.g. with ErrPoolClosed, the error is delivered to all merged tasks.
+	// If the held task is dropped, e.g. its group is canceled, merged tasks are dropped too, even of other groups.
+	// Tasks submitted by TryGo and SubmitInfo are not coalesced, responses emitted by NewWithEmit handlers are not shared.
+	CoalesceWindow time.Duration
+
+	// DisablePooling disables reuse of groups and tasks, default false.
+	// Every task and group is a distinct allocation, so the race detector and leak hunts attribute issues to the task,
+	// instead of being masked by reuse. Use it for diagnostics only.
+	DisablePooling bool
+
+	// RetryShare is a share of WorkersLimitMax for retried tasks, default 0 (retried tasks are queued with fresh tasks).
+	// Retried tasks are queued in a separate FIFO queue, and at most RetryShare * WorkersLimitMax of them, at least one,
+	// are executed at once, so retry storms do not crowd out first attempts. Queued retries are taken before fresh tasks
+	// within the share. It requires WorkersLimitMax.
+	RetryShare float64
 }
 
-// New creates new worker pool
-func New[Req any, Resp any](handler func(Req) Resp, opts *Options) *Pool[Req, Resp] {
+// TypedOptions is a pool options, which depend on request and response types.
+// They are passed to constructors after Options, e.g. New(handler, opts, typedOpts).
+type TypedOptions[Req any, Resp any] struct {
+	// OnTaskStart is called before the first attempt of the task, default nil.
+	// OnTaskDone is called after the task is executed, with all attempts, e.g. to collect latency metrics,
+	// info.Busy is the handler execution time, default nil.
+	// Both are called in the goroutine executing the task, so they should be fast.
+	OnTaskStart func(req Req)
+	OnTaskDone  func(req Req, resp Resp, info TaskInfo)
+
+	// SpillCodec enables spilling of queued tasks to disk, default nil (disabled).
+	// With spilling enabled, `group.Go` does not block when the Options.WorkersLimitMax is reached,
+	// the task is queued instead. Queued tasks over the Options.SpillThreshold are encoded with the codec
+	// and stored in a temporary file until a worker is free.
+	SpillCodec Codec[Req]
+
+	// SizeFunc returns the size of the request in bytes, used with Options.MaxQueuedBytes, default nil
+	SizeFunc func(Req) int
+
+	// Chaos enables fault injection for tests, default nil (disabled)
+	Chaos *Chaos[Req, Resp]
+
+	// DeadlineFunc returns the deadline of the request, if it has one, default nil.
+	// Queued tasks are executed in the earliest deadline first order (spilled tasks are not reordered),
+	// tasks without deadline go after tasks with deadline.
+	// The task with exceeded deadline is rejected by `group.Submit` with DeadlineError,
+	// or dropped without execution, if the deadline is exceeded while the task is queued.
+	DeadlineFunc func(Req) (time.Time, bool)
+
+	// PriorityFunc returns the priority of the request, default nil (all tasks have priority 0).
+	// Queued tasks with higher priority are executed first, then by DeadlineFunc (spilled tasks are not reordered).
+	PriorityFunc func(Req) int
+
+	// DeadLetter is called for unfinished tasks of the group, which budget is expired, default nil.
+	// See GroupOptions.Deadline and GroupOptions.Timeout. The error is ErrGroupExpired.
+	// It is called by workers and the group timer, so it must be safe for concurrent use.
+	DeadLetter func(req Req, err error)
+
+	// ShadowSink receives copies of completed tasks sampled with Options.ShadowRate, e.g. to record them for offline analysis
+	// or to replay them in the shadow pool, default nil. It is called in a separate goroutine, so it never adds
+	// latency to the tasks, and sampled tasks are dropped, if Options.ShadowBuffer is full, see Stats.ShadowDropped.
+	ShadowSink func(req Req, resp Resp, info TaskInfo)
+
+	// Spillover executes tasks in the secondary tier, e.g. the pool for bursts, see SpilloverPool, or the remote pool,
+	// when the pool is saturated and the estimated queue wait of the task exceeds Options.SpilloverWait, default nil.
+	// It is called in a new goroutine with the task context, see NewWithContext, its result is delivered to the group.
+	// Spilled over tasks are not retried, see TypedOptions.Retry, and are counted in Stats.SpilledOver.
+	// OnTaskStart, OnTaskDone, Options.FailureHistory and per-kind stats see them like executed tasks,
+	// but they are not counted in Stats.Completed and Stats.HandlerTime of the pool.
+	Spillover func(ctx context.Context, req Req) (Resp, error)
+
+	// DedupKey returns the key of the expensive computation of the request, default nil (no deduplication).
+	// While the task with the key is queued or running, tasks with the same key, submitted by any group, are not executed:
+	// they join the in-flight task and receive its result in their groups, like singleflight.
+	// Joined tasks are counted in GroupStats.Shared of their groups and in Stats.Deduplicated.
+	// Requests with the empty key are executed as usual. Emitted responses are not shared, see NewWithEmit,
+	// and if the in-flight task is dropped, e.g. its group is canceled, joined tasks are dropped too.
+	DedupKey func(Req) string
+
+	// FailureCodec encodes requests of failed tasks, if they are retained, default nil (requests are retained as is).
+	// Use it for requests, which are reused or changed after the task is done, e.g. pointers to pooled objects.
+	FailureCodec Codec[Req]
+
+	// TraceExtractor returns the context with values of the request, e.g. the remote trace context
+	// restored from message headers, default nil. Values of the returned context are visible in the task context,
+	// its cancellation is ignored.
+	TraceExtractor func(Req) context.Context
+
+	// KindFunc returns the kind of the request, e.g. the request type name, default nil (all tasks have empty kind).
+	// Kinds break down the pool diagnostics, see Pool.Panics and Pool.KindStats.
+	KindFunc func(Req) string
+
+	// CoalesceKey returns the coalescing key of the request, default nil. Requests with the empty key are not coalesced.
+	CoalesceKey func(Req) string
+
+	// CoalesceMerge merges the request into the held one and returns the merged request, default nil (the held request is kept)
+	CoalesceMerge func(held, req Req) Req
+
+	// Interceptors are called in order at submission, before the task is queued, default nil.
+	// An interceptor may mutate, validate or reject the request: the returned request is passed to the next
+	// interceptor, the error rejects the task and is returned by `group.Submit`.
+	// Unlike Prepare, interceptors are called concurrently by submitters.
+	Interceptors []func(req Req) (Req, error)
+
+	// Prepare is a serial preparation step of the task, default nil. It is called at submission under the pool lock,
+	// one call at a time, before the task is passed to the parallel handler, e.g. to deduplicate requests
+	// or to assign the order. It returns the request to execute, or an error to reject the task,
+	// which is returned by `group.Submit`. Keep it cheap, it blocks all submitters of the pool.
+	Prepare func(req Req) (Req, error)
+
+	// Retry reports whether the task should be executed again after the attempt with the response, default nil (no retries).
+	// Attempts are numbered from 1. The retried task is queued again and only its last response is delivered to the group.
+	Retry func(req Req, resp Resp, attempt int) bool
+
+	// Middleware wraps the handler of all groups, default nil. The first middleware is the outermost one.
+	// Groups may extend or override the chain, see AcquireGroupWithMiddleware.
+	Middleware []Middleware[Req, Resp]
+}
+
+// handlerFunc is the internal handler, all handler variants are adapted to it.
+// The request is passed by pointer to the task request, so large value requests are copied only into the user handler.
+// The scratch is the per-worker scratch object, nil if the pool has no scratch factory.
+// The emit passes an extra response of the task, nil if the pool is not created by NewWithEmit.
+type handlerFunc[Req any, Resp any] func(ctx context.Context, req *Req, attempt int, scratch any, emit func(Resp)) (Resp, error)
+
+// New creates new worker pool. The typed options are optional, only the first one is used, see TypedOptions.
+func New[Req any, Resp any](handler func(Req) Resp, opts *Options, typed ...*TypedOptions[Req, Resp]) *Pool[Req, Resp] {
+	return newPool(func(_ context.Context, req *Req, _ int, _ any, _ func(Resp)) (Resp, error) {
+		return handler(*req), nil
+	}, nil, opts, firstTyped(typed), nil)
+}
+
+// NewWithContext creates new worker pool with the handler, which receives the task context.
+// The context is derived from Options.BaseContext and is canceled, when the group is canceled or expired,
+// or the context of `group.Wait` is done while waiting. If the task has a deadline, see TypedOptions.DeadlineFunc,
+// the context has the deadline too.
+func NewWithContext[Req any, Resp any](handler func(ctx context.Context, req Req) Resp, opts *Options, typed ...*TypedOptions[Req, Resp]) *Pool[Req, Resp] {
+	wp := newPool(func(ctx context.Context, req *Req, _ int, _ any, _ func(Resp)) (Resp, error) {
+		return handler(ctx, *req), nil
+	}, nil, opts, firstTyped(typed), nil)
+	wp.contextAware = true
+	return wp
+}
+
+// NewWithError creates new worker pool with the handler, which returns an error.
+// Errors are returned by `group.WaitErr` and in Result.Err by `group.WaitResults`.
+func NewWithError[Req any, Resp any](handler func(Req) (Resp, error), opts *Options, typed ...*TypedOptions[Req, Resp]) *Pool[Req, Resp] {
+	return newPool(func(_ context.Context, req *Req, _ int, _ any, _ func(Resp)) (Resp, error) {
+		return handler(*req)
+	}, nil, opts, firstTyped(typed), nil)
+}
+
+// NewWithContextError creates new worker pool with the handler, which receives the task context like NewWithContext
+// and returns an error like NewWithError, e.g. for groups in the errgroup mode, see GroupOptions.CancelOnError.
+func NewWithContextError[Req any, Resp any](handler func(ctx context.Context, req Req) (Resp, error), opts *Options, typed ...*TypedOptions[Req, Resp]) *Pool[Req, Resp] {
+	wp := newPool(func(ctx context.Context, req *Req, _ int, _ any, _ func(Resp)) (Resp, error) {
+		return handler(ctx, *req)
+	}, nil, opts, firstTyped(typed), nil)
+	wp.contextAware = true
+	return wp
+}
+
+// NewWithAttempt creates new worker pool with the handler, which receives the attempt number, starting from 1.
+// See TypedOptions.Retry.
+func NewWithAttempt[Req any, Resp any](handler func(req Req, attempt int) Resp, opts *Options, typed ...*TypedOptions[Req, Resp]) *Pool[Req, Resp] {
+	return newPool(func(_ context.Context, req *Req, attempt int, _ any, _ func(Resp)) (Resp, error) {
+		return handler(*req, attempt), nil
+	}, nil, opts, firstTyped(typed), nil)
+}
+
+// NewWithScratch creates new worker pool with the handler, which receives the scratch object of the worker.
+// The scratch object is created by newScratch once per worker and reused for all tasks of the worker,
+// e.g. a large temporary buffer for encoding or compression. The handler must not retain the scratch.
+// Tasks executed outside of workers, see SaturationCallerRuns and Options.InlineLastTask, use scratch objects from a sync.Pool.
+func NewWithScratch[Req any, Resp any, S any](newScratch func() S, handler func(req Req, scratch S) Resp, opts *Options, typed ...*TypedOptions[Req, Resp]) *Pool[Req, Resp] {
+	return newPool(func(_ context.Context, req *Req, _ int, scratch any, _ func(Resp)) (Resp, error) {
+		return handler(*req, scratch.(S)), nil
+	}, func() any {
+		return newScratch()
+	}, opts, firstTyped(typed), nil)
+}
+
+// NewWithEmit creates new worker pool with the handler, which emits any number of responses per request.
+// Every emitted response is received by `group.Wait` like a response of a separate task, e.g. 3 emitted responses
+// for 2 requests give 3 responses, and `group.WaitResults` returns a result per emitted response.
+// The emit must not be called after the handler returns. If the task is retried, see TypedOptions.Retry,
+// responses emitted by failed attempts are not withdrawn.
+func NewWithEmit[Req any, Resp any](handler func(req Req, emit func(Resp)), opts *Options, typed ...*TypedOptions[Req, Resp]) *Pool[Req, Resp] {
+	wp := newPool(func(_ context.Context, req *Req, _ int, _ any, emit func(Resp)) (resp Resp, _ error) {
+		handler(*req, emit)
+		return resp, nil
+	}, nil, opts, firstTyped(typed), nil)
+	wp.emitting = true
+	return wp
+}
+
+// firstTyped returns the typed options passed to the constructor, nil if there are none
+func firstTyped[Req any, Resp any](typed []*TypedOptions[Req, Resp]) *TypedOptions[Req, Resp] {
+	if len(typed) == 0 {
+		return nil
+	}
+	return typed[0]
+}
+
+// newPool creates the pool, the budget is not nil for partitions
+func newPool[Req any, Resp any](handler handlerFunc[Req, Resp], newScratch func() any, opts *Options, typed *TypedOptions[Req, Resp], budget *workerBudget) *Pool[Req, Resp] {
 	wp := &Pool[Req, Resp]{
 		handler:                  handler,
-		tasks:                    make(chan *task[Req, Resp]),
+		baseHandler:              handler,
+		budget:                   budget,
+		newScratch:               newScratch,
 		stopWorkerTimeout:        defaultWorkerTimeout,
 		groupResponseChannelSize: defaultGroupsResponseChannelSize,
+		stop:                     make(chan struct{}),
+		util:                     newUtilization(),
+		live:                     make(map[*worker[Req, Resp]]struct{}),
+		done:                     make(chan struct{}),
+		baseCtx:                  context.Background(),
 	}
+	wp.scratchPool.New = newScratch
 
-	if opts != nil {
-		if opts.WorkersLimitMax > 0 {
-			wp.workersLimitMax = int64(opts.WorkersLimitMax)
+	if opts == nil {
+		opts = &Options{}
+	}
+	if typed == nil {
+		typed = &TypedOptions[Req, Resp]{}
+	}
+	wp.typed = typed
+
+	if opts.WorkersLimitMax > 0 {
+		wp.workersLimitMax = int64(opts.WorkersLimitMax)
+	}
+	if opts.StopWorkerTimeout > 0 {
+		wp.stopWorkerTimeout = opts.StopWorkerTimeout
+	}
+	if opts.WorkersLimitSoft > 0 {
+		wp.workersLimitSoft = int64(opts.WorkersLimitSoft)
+		wp.burstWorkerTimeout = opts.BurstWorkerTimeout
+		if wp.burstWorkerTimeout <= 0 {
+			wp.burstWorkerTimeout = wp.stopWorkerTimeout / 10
 		}
-		if opts.StopWorkerTimeout > 0 {
-			wp.stopWorkerTimeout = opts.StopWorkerTimeout
+	}
+	wp.groupAffinity = opts.GroupAffinity
+	if opts.SpareWorkersRatio > 0 {
+		wp.parking = &parking{ratio: opts.SpareWorkersRatio, window: opts.PeakWindow, start: time.Now()}
+		if wp.parking.window <= 0 {
+			wp.parking.window = defaultPeakWindow
 		}
-		if opts.GroupResponseChannelSize > 0 {
-			wp.groupResponseChannelSize = opts.GroupResponseChannelSize
+	}
+	wp.onStuckWorker = opts.OnStuckWorker
+	wp.stuckStacks = opts.StuckWorkerStacks
+	wp.onTaskStart = typed.OnTaskStart
+	wp.onTaskDone = typed.OnTaskDone
+	wp.onWorkerStart = opts.OnWorkerStart
+	wp.onWorkerStop = opts.OnWorkerStop
+	wp.workerWarmup = opts.WorkerWarmup
+	if opts.GroupResponseChannelSize > 0 {
+		wp.groupResponseChannelSize = opts.GroupResponseChannelSize
+	}
+	wp.queue.boostWaiting = opts.BoostWaitingGroups
+	if opts.RetryShare > 0 && opts.WorkersLimitMax > 0 {
+		wp.queue.retryLimit = max(1, int(opts.RetryShare*float64(opts.WorkersLimitMax)))
+	}
+	wp.saturationPolicy = opts.SaturationPolicy
+	wp.deadlineFunc = typed.DeadlineFunc
+	wp.lockOSThread = opts.LockOSThread || len(opts.CPUAffinity) > 0
+	wp.cpuAffinity = opts.CPUAffinity
+	wp.onAffinityError = opts.OnAffinityError
+	wp.spinIterations = opts.SpinIterations
+	wp.retry = typed.Retry
+	wp.middleware = typed.Middleware
+	wp.inlineLastTask = opts.InlineLastTask
+	wp.labels = newLabels(opts.Name, opts.Labels)
+	if opts.RuntimeTrace {
+		wp.runtimeTraceType = runtimeTraceType(opts.Name)
+	}
+	wp.yieldSlice = opts.YieldSlice
+	wp.prepare = typed.Prepare
+	wp.interceptors = typed.Interceptors
+	wp.deadLetter = typed.DeadLetter
+	wp.kindFunc = typed.KindFunc
+	wp.queueWaitAudit = opts.QueueWaitAudit
+	if opts.CoalesceWindow > 0 && typed.CoalesceKey != nil {
+		wp.coalescer = &coalescer[Req, Resp]{
+			window: opts.CoalesceWindow,
+			key:    typed.CoalesceKey,
+			merge:  typed.CoalesceMerge,
+			held:   map[string]*task[Req, Resp]{},
 		}
-		if opts.WorkersLimitMin > 0 {
-			wp.workersLimitMin = int64(opts.WorkersLimitMin)
-			atomic.AddInt64(&wp.workersCount, int64(opts.WorkersLimitMin))
-			for i := 0; i < opts.WorkersLimitMin; i++ {
-				go wp.newWorker(nil)
-			}
+	}
+	if opts.ConcurrencyFunc != nil {
+		wp.concurrencyFunc = opts.ConcurrencyFunc
+		wp.concurrency = wp.concurrencyLimit()
+		interval := opts.ConcurrencyInterval
+		if interval <= 0 {
+			interval = defaultConcurrencyInterval
+		}
+		go wp.watchConcurrency(interval)
+	}
+	if typed.KindFunc != nil && opts.KindAllocSampling > 0 {
+		wp.allocs = newAllocSampler(opts.KindAllocSampling)
+	}
+	if opts.KindCPUTime {
+		wp.kinds.cpu = true
+		wp.kinds.lastCPU = wp.kinds.userCPU()
+	}
+	if typed.KindFunc != nil && len(opts.DeprecatedKinds) > 0 && opts.OnDeprecatedKind != nil {
+		wp.deprecations = newDeprecations(opts.DeprecatedKinds, opts.DeprecationInterval, opts.OnDeprecatedKind)
+	}
+	if typed.Spillover != nil {
+		wp.spillover = &spillover[Req, Resp]{wait: opts.SpilloverWait, fn: typed.Spillover}
+	}
+	if typed.DedupKey != nil {
+		wp.dedup = &dedup[Req, Resp]{key: typed.DedupKey, inflight: map[string]*task[Req, Resp]{}}
+	}
+	if opts.FailureHistory > 0 {
+		wp.failures = newFailures(opts.FailureHistory, typed.FailureCodec)
+	}
+	if typed.ShadowSink != nil && opts.ShadowRate > 0 {
+		wp.shadow = newShadow(opts.ShadowRate, opts.ShadowBuffer, typed.ShadowSink)
+		go wp.shadow.run(wp.done)
+	}
+	if typed.KindFunc != nil && len(opts.KindLimits) > 0 {
+		wp.kindLimits = make(map[string]int, len(opts.KindLimits))
+		for k, v := range opts.KindLimits {
+			wp.kindLimits[k] = v
+		}
+		wp.kindRunning = make(map[string]int)
+		wp.kindWaiting = make(map[string]*fifo[*task[Req, Resp]])
+	}
+	if opts.BaseContext != nil {
+		wp.baseCtx = opts.BaseContext
+	}
+	wp.traceExtractor = typed.TraceExtractor
+	wp.invokeHook = opts.InvokeHook
+	wp.priorityFunc = typed.PriorityFunc
+	wp.disablePooling = opts.DisablePooling
+	wp.shutdownDropBelow = opts.ShutdownDropBelow
+	if typed.Chaos != nil {
+		wp.chaos = newChaos(*typed.Chaos)
+		wp.handler = wp.chaos.wrap(handler)
+	}
+	if opts.TraceScheduling {
+		wp.trace = &schedulingTrace{
+			onDecision: opts.OnSchedulingDecision,
 		}
 	}
+	if typed.SizeFunc != nil && opts.MaxQueuedBytes > 0 {
+		wp.sizeFunc = typed.SizeFunc
+		wp.maxQueuedBytes = opts.MaxQueuedBytes
+	}
+	wp.maxPending = opts.MaxPendingTasks
+	wp.overflowPolicy = opts.OverflowPolicy
+	if typed.SpillCodec != nil {
+		wp.spill = newSpill[Req, Resp](typed.SpillCodec, opts.SpillDir, opts.SpillThreshold)
+		wp.onSpillError = opts.OnSpillError
+	}
+	if opts.WorkersLimitMin > 0 {
+		wp.workersLimitMin = int64(opts.WorkersLimitMin)
+		atomic.AddInt64(&wp.workersCount, int64(opts.WorkersLimitMin))
+		for i := 0; i < opts.WorkersLimitMin; i++ {
+			wp.spawnWorker(nil, false)
+		}
+	}
+
+	wp.handler = wp.recoverPanics(wp.handler)
 
 	return wp
 }
 
-// AcquireGroup acquires the new group.
-// Use `group.Wait` to wait for all tasks in group to be done.
-// You should call ReleaseGroup after `group.Wait` is done.
-// You must not use the group after calling ReleaseGroup.
-func (w *Pool[Req, Resp]) AcquireGroup() *Group[Req, Resp] {
-	g := w.groupsPool.Get()
-	if g == nil {
-		return &Group[Req, Resp]{
-			handler:         w.task,
-			ch:              make(chan Resp, w.groupResponseChannelSize),
-			acquireTaskFunc: w.acquireTask,
-		}
-	}
-	gg := g.(*Group[Req, Resp])
-	return gg
+// WorkersCount returns current workers count
+func (w *Pool[Req, Resp]) WorkersCount() int64 {
+	return atomic.LoadInt64(&w.workersCount)
 }
 
-// ReleaseGroup releases group
-// You must not use group after calling ReleaseGroup.
-func (w *Pool[Req, Resp]) ReleaseGroup(g *Group[Req, Resp]) {
-	// if the group is busy, let GC collect it later
-	if atomic.LoadInt64(&g.counter) == 0 {
-		w.groupsPool.Put(g)
+// Labels returns a copy of the pool labels, including the "name" label, if the pool name is set
+func (w *Pool[Req, Resp]) Labels() map[string]string {
+	res := make(map[string]string, len(w.labels))
+	for k, v := range w.labels {
+		res[k] = v
 	}
+	return res
 }
 
-// WorkersCount returns current workers count
-func (w *Pool[Req, Resp]) WorkersCount() int64 {
-	return atomic.LoadInt64(&w.workersCount)
+// Name returns the pool name
+func (w *Pool[Req, Resp]) Name() string {
+	return w.labels["name"]
+}
+
+func newLabels(name string, labels map[string]string) map[string]string {
+	if name == "" && len(labels) == 0 {
+		return nil
+	}
+	res := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		res[k] = v
+	}
+	if name != "" {
+		res["name"] = name
+	}
+	return res
 }
 
-// Wait waits for all tasks in group to be done or context is done.
-func (g *Group[Req, Resp]) Wait(ctx context.Context, dest []Resp) []Resp {
-	if atomic.LoadInt64(&g.counter) == 0 {
-		return dest
+// task passes the task to a worker or queues it, according to the limits and the saturation policy.
+// The task is accepted by the group right before it becomes visible to workers.
+// Returns an error, if the task is rejected.
+func (w *Pool[Req, Resp]) task(t *task[Req, Resp]) error {
+	atomic.AddInt64(&w.counters.submitted, 1)
+
+	if w.sizeFunc != nil {
+		t.size = w.sizeFunc(t.req)
+	}
+
+	var deadline time.Time
+	if w.deadlineFunc != nil {
+		if d, ok := w.deadlineFunc(t.req); ok {
+			deadline = d
+		}
 	}
+	t.due = deadline
+	if deadline = t.group.taskDeadline(deadline); !deadline.IsZero() {
+		if !deadline.After(time.Now()) {
+			w.traceDecision(ReasonRejected)
+			w.releaseTask(t)
+			return &DeadlineError{Deadline: deadline}
+		}
+		t.deadline = deadline
+	}
+
+	if w.priorityFunc != nil {
+		t.priority = w.priorityFunc(t.req)
+	}
+
+	if w.kindFunc != nil {
+		t.kind = w.kindFunc(t.req)
+		if w.deprecations != nil {
+			w.deprecations.check(t.kind)
+		}
+	}
+
+	// the task is accepted before waiting for the queue room, so it is counted by the group while waiting
+	accepted := false
+	spilloverChecked := false
+
+	w.mu.Lock()
+
+	if w.closed {
+		w.mu.Unlock()
+		w.traceDecision(ReasonRejected)
+		w.releaseTask(t)
+		return ErrPoolClosed
+	}
+
+	if limit := t.group.limit; limit > 0 {
+		if t.group.running >= limit {
+			return w.waitGroupSlot(t)
+		}
+		t.group.running++
+		t.groupSlot = true
+	}
+
+	if limit := w.kindLimits[t.kind]; limit > 0 {
+		if w.kindRunning[t.kind] >= limit {
+			return w.waitKind(t)
+		}
+		w.kindRunning[t.kind]++
+		t.kindSlot = true
+	}
+
 	for {
-		select {
-		case <-ctx.Done():
-			return dest
-		case v := <-g.ch:
-			dest = append(dest, v)
-			if atomic.AddInt64(&g.counter, -1) == 0 {
-				return dest
+		// if there is an idle worker, then pass the task to it
+		if n := len(w.idle); n > 0 && !w.overLimit(1) && w.takeBudget() {
+			reason := ReasonReusedIdle
+			i := n - 1
+			if w.groupAffinity {
+				if j := w.idleIndex(t.group.lastWorker.Load()); j >= 0 {
+					reason, i = ReasonAffinity, j
+				}
+			}
+			wk := w.idle[i]
+			copy(w.idle[i:], w.idle[i+1:])
+			w.idle[n-1] = nil
+			w.idle = w.idle[:n-1]
+			w.storeGauges()
+			w.observeBusy()
+			wk.budget = w.budget != nil
+			w.mu.Unlock()
+			w.traceDecision(reason)
+			if !accepted {
+				t.group.accept(t)
+			}
+			wk.ch <- t
+			return nil
+		}
+
+		// if the worker max limit is not set, or we did not exceed it, then create a new worker
+		if (w.workersLimitMax <= 0 || atomic.LoadInt64(&w.workersCount) < w.workersLimitMax) && !w.overLimit(1) && w.takeBudget() {
+			atomic.AddInt64(&w.workersCount, 1)
+			w.observeBusy()
+			w.mu.Unlock()
+			w.traceDecision(ReasonSpawned)
+			if !accepted {
+				t.group.accept(t)
 			}
+			w.spawnWorker(t, w.budget != nil)
+			return nil
 		}
+
+		// if the worker max limit is set, and we exceeded it, then apply the saturation policy
+		if w.saturationPolicy == SaturationReject || t.try {
+			w.mu.Unlock()
+			w.traceDecision(ReasonRejected)
+			w.releaseTask(t)
+			return ErrSaturated
+		}
+
+		if w.saturationPolicy == SaturationCallerRuns {
+			w.mu.Unlock()
+			w.traceDecision(ReasonCallerRuns)
+			t.group.accept(t)
+			w.callerRun(t)
+			return nil
+		}
+
+		// pass the task to the secondary tier, if it would wait in the queue too long,
+		// the estimation reads counters without the mutex, and the state is checked again after it
+		if w.spillover != nil && !spilloverChecked {
+			spilloverChecked = true
+			position := w.queue.len()
+			w.mu.Unlock()
+			if w.estimateStart(position) > w.spillover.wait {
+				w.traceDecision(ReasonSpillover)
+				if !accepted {
+					t.group.accept(t)
+				}
+				go w.spillOver(t)
+				return nil
+			}
+			w.mu.Lock()
+			continue
+		}
+
+		// queue the task
+		if w.spill != nil {
+			t.group.accept(t)
+			var record *spillRecord[Req, Resp]
+			if w.spill.len() > 0 || w.queue.len() >= w.spill.threshold || !w.hasRoom(t.size) {
+				// the request is written outside of the pool mutex, the worker restoring it waits for that
+				record = w.spill.push(t)
+				w.storeGauges()
+				if t.info != nil {
+					// spilled tasks are restored after the queued ones
+					*t.info = QueueInfo{Queued: true, Position: w.queue.len() + w.spill.len() - 1}
+					t.info = nil
+				}
+			} else {
+				w.enqueue(t)
+			}
+			w.mu.Unlock()
+			if record == nil {
+				w.traceDecision(ReasonQueued)
+				return nil
+			}
+			// the task may be already restored and released after the write, so the record is not used after it
+			if err := w.spill.write(record); err != nil {
+				// the request is kept in memory, the task is executed in the order of spilled tasks
+				if w.onSpillError != nil {
+					w.onSpillError(err)
+				}
+				w.traceDecision(ReasonQueued)
+				return nil
+			}
+			w.traceDecision(ReasonSpilled)
+			return nil
+		}
+
+		if w.hasRoom(t.size) {
+			break
+		}
+
+		// the queue is full, apply the overflow policy
+		if w.overflowPolicy == OverflowReject {
+			w.mu.Unlock()
+			w.traceDecision(ReasonRejected)
+			w.releaseTask(t)
+			return ErrQueueFull
+		}
+		if w.overflowPolicy == OverflowDropOldest {
+			if old := w.dequeue(); old != nil {
+				if old.dequeued != nil {
+					close(old.dequeued)
+					old.dequeued = nil
+				}
+				w.mu.Unlock()
+				w.dropOverflow(old)
+				w.mu.Lock()
+				continue
+			}
+		}
+
+		// wait until the queued size drops below the limit and try again
+		if !accepted {
+			t.group.accept(t)
+			accepted = true
+		}
+		if w.room == nil {
+			w.room = make(chan struct{})
+		}
+		room := w.room
+		w.mu.Unlock()
+		select {
+		case <-room:
+		case <-t.group.cancelCh:
+			// the accepted task is dropped like queued tasks of the canceled group
+			w.traceDecision(ReasonDropped)
+			t.group.deadLetter(t.req)
+			t.deliverCoalesced(result[Req, Resp]{dropped: true})
+			t.group.drop()
+			w.releaseTask(t)
+			return nil
+		}
+		w.mu.Lock()
+	}
+
+	if !accepted {
+		t.group.accept(t)
 	}
+
+	// the only queued task of the group may be executed by the group waiter, so do not wait for it,
+	// and with the bounded queue the submitter waits only for the room
+	if w.maxPending > 0 || (w.inlineLastTask && t.group.queued.len() == 0) {
+		w.enqueue(t)
+		w.mu.Unlock()
+		w.traceDecision(ReasonQueued)
+		return nil
+	}
+
+	// and wait for free worker
+	dequeued := make(chan struct{})
+	t.dequeued = dequeued
+	w.enqueue(t)
+	w.mu.Unlock()
+	w.traceDecision(ReasonBlocked)
+	<-dequeued
+
+	return nil
 }
 
-// Go runs the task in the group (unblocking)
-func (g *Group[Req, Resp]) Go(req Req) {
-	atomic.AddInt64(&g.counter, 1)
-	t := g.acquireTaskFunc()
-	t.ch = g.ch
-	t.req = req
-	g.handler(t)
+// callerRun executes the task in the submitter goroutine.
+func (w *Pool[Req, Resp]) callerRun(t *task[Req, Resp]) {
+	t.deliver(w.execute(t))
+	w.releaseTask(t)
 }
 
-func (w *Pool[Req, Resp]) task(t *task[Req, Resp]) {
-	select {
-	case w.tasks <- t:
-	default:
-		count := atomic.AddInt64(&w.workersCount, 1)
+// intercept calls the TypedOptions.Interceptors in order and updates the request in place
+func (w *Pool[Req, Resp]) intercept(req *Req) error {
+	for _, fn := range w.interceptors {
+		v, err := fn(*req)
+		if err != nil {
+			return err
+		}
+		*req = v
+	}
+	return nil
+}
 
-		// if the worker max limit is not set, or we did not exceed it, then create a new worker
-		if w.workersLimitMax <= 0 || count <= w.workersLimitMax {
-			go w.newWorker(t)
-			return
+// prepareRequest calls the TypedOptions.Prepare serially and updates the request in place
+func (w *Pool[Req, Resp]) prepareRequest(req *Req) error {
+	w.prepareMu.Lock()
+	defer w.prepareMu.Unlock()
+	v, err := w.prepare(*req)
+	if err != nil {
+		return err
+	}
+	*req = v
+	return nil
+}
+
+// call calls the handler with the task context
+func (w *Pool[Req, Resp]) call(t *task[Req, Resp], scratch any) (Resp, error) {
+	ctx := context.Background()
+	if t.group.ctx != nil {
+		ctx = t.group.ctx
+		if !t.deadline.IsZero() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, t.deadline)
+			defer cancel()
+		}
+	}
+	if t.ctx != nil {
+		ctx = valuesContext{Context: ctx, values: t.ctx}
+	}
+	if w.traceExtractor != nil {
+		if values := w.traceExtractor(t.req); values != nil {
+			ctx = valuesContext{Context: ctx, values: values}
+		}
+	}
+	if w.yieldSlice > 0 && !t.nested {
+		ctx = context.WithValue(ctx, yieldKey{}, &taskYielder[Req, Resp]{w: w, t: t, slice: nanotime()})
+	}
+	if w.runtimeTraceType != "" && trace.IsEnabled() {
+		var end func()
+		ctx, end = w.traceRuntime(ctx, t)
+		defer end()
+	}
+	var emit func(Resp)
+	if w.emitting {
+		emit = func(resp Resp) {
+			t.group.emit(t.result(resp, nil))
+		}
+	}
+	if w.invokeHook == nil {
+		return w.invoke(ctx, t, scratch, emit)
+	}
+
+	ctx, done := w.invokeHook(ctx, InvokeInfo{Kind: t.kind, Attempt: t.attempt, Wait: time.Duration(t.wait), Labels: w.labels})
+	resp, err := w.invoke(ctx, t, scratch, emit)
+	done(err)
+	return resp, err
+}
+
+// InvokeInfo is the handler invocation metadata, see Options.InvokeHook
+type InvokeInfo struct {
+	// Kind is the task kind, see TypedOptions.KindFunc
+	Kind string
+	// Attempt is the attempt number, starting from 1, see TypedOptions.Retry
+	Attempt int
+	// Wait is a time of the task from the submission to the first attempt
+	Wait time.Duration
+	// Labels are the pool labels, including the "name" label, see Pool.Labels. The map is shared, do not modify it.
+	Labels map[string]string
+}
+
+// valuesContext is the task context with values of the request context, see TypedOptions.TraceExtractor
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key any) any {
+	if v := c.values.Value(key); v != nil {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+// execute executes the task in the current goroutine with retries and returns the result
+func (w *Pool[Req, Resp]) execute(t *task[Req, Resp]) result[Req, Resp] {
+	r, busy := w.executeTask(t)
+	w.util.shard(0).callerTaskDone(busy)
+	return r
+}
+
+// executeTask runs the task with all attempts and returns its result and the handler time
+func (w *Pool[Req, Resp]) executeTask(t *task[Req, Resp]) (result[Req, Resp], int64) {
+	var scratch any
+	if w.newScratch != nil {
+		scratch = w.scratchPool.Get()
+		defer w.scratchPool.Put(scratch)
+	}
+
+	start := nanotime()
+	w.taskStarted(t, start)
+	resp, err := w.call(t, scratch)
+	for w.retry != nil && w.retry(t.req, resp, t.attempt) {
+		w.traceDecision(ReasonRetried)
+		t.attempt++
+		resp, err = w.call(t, scratch)
+	}
+	busy := nanotime() - start
+	t.busy += busy
+	w.taskDone(t, resp, err)
+
+	return w.taskResult(t, resp, err), busy
+}
+
+// inline executes the only queued task of the group in the group waiter goroutine.
+// Does nothing, if the group has no queued task or more than one.
+func (w *Pool[Req, Resp]) inline(g *Group[Req, Resp]) {
+	w.mu.Lock()
+	if g.queued.len() != 1 {
+		w.mu.Unlock()
+		return
+	}
+	t := w.queue.remove(g)[0]
+	w.queuedBytes -= t.size
+	if t.dequeued != nil {
+		close(t.dequeued)
+		t.dequeued = nil
+	}
+	w.signalRoom()
+	w.storeGauges()
+	w.mu.Unlock()
+
+	var r result[Req, Resp]
+	if now := time.Now(); !t.deadline.IsZero() && !t.deadline.After(now) {
+		w.traceDecision(ReasonDropped)
+		t.group.expireOverdue(now)
+		t.group.deadLetter(t.req)
+		r = result[Req, Resp]{index: t.index, dropped: true}
+	} else {
+		w.traceDecision(ReasonInlined)
+		r = w.execute(t)
+	}
+	t.deliver(r)
+	w.releaseTask(t)
+}
+
+// idleIndex returns the index of the idle worker, or -1, if the worker is not idle. It must be called under the mutex.
+func (w *Pool[Req, Resp]) idleIndex(wk *worker[Req, Resp]) int {
+	if wk == nil {
+		return -1
+	}
+	for i, v := range w.idle {
+		if v == wk {
+			return i
 		}
+	}
+	return -1
+}
+
+// hasRoom reports whether the task with the given size can be queued in memory
+func (w *Pool[Req, Resp]) hasRoom(size int) bool {
+	if w.maxPending > 0 && w.queue.len() >= w.maxPending {
+		return false
+	}
+	return w.maxQueuedBytes <= 0 || w.queuedBytes == 0 || w.queuedBytes+size <= w.maxQueuedBytes
+}
 
-		// if the worker max limit is set, and we exceeded it, then wait for free worker
-		atomic.AddInt64(&w.workersCount, -1)
-		w.tasks <- t
+func (w *Pool[Req, Resp]) enqueue(t *task[Req, Resp]) {
+	w.queue.push(t)
+	if t.info != nil {
+		*t.info = QueueInfo{Queued: true, Position: w.queue.ahead(t)}
+		t.info = nil
+	}
+	w.queuedBytes += t.size
+	w.storeGauges()
+}
+
+// dropOverflow delivers the queued task dropped by OverflowDropOldest as a dropped result
+func (w *Pool[Req, Resp]) dropOverflow(t *task[Req, Resp]) {
+	w.traceDecision(ReasonDropped)
+	t.deliver(result[Req, Resp]{req: t.req, index: t.index, dropped: true})
+	w.releaseTask(t)
+}
+
+// signalRoom wakes up submitters waiting for the queued size or count to drop below the limit
+func (w *Pool[Req, Resp]) signalRoom() {
+	if w.room == nil || (w.maxPending > 0 && w.queue.len() >= w.maxPending) {
 		return
 	}
+	if w.maxQueuedBytes <= 0 || w.queuedBytes < w.maxQueuedBytes {
+		close(w.room)
+		w.room = nil
+	}
 }
 
-func (w *Pool[Req, Resp]) newWorker(t *task[Req, Resp]) {
-	defer atomic.AddInt64(&w.workersCount, -1)
+// gauges are copies of the mutex guarded gauges, so observability reads never contend with dispatching
+type gauges struct {
+	idle        int64
+	queued      int64
+	queuedBytes int64
+	spilled     int64
+	stuck       int64
+	warming     int64 // updated by workers directly, see Options.WorkerWarmup
+}
 
-	if t != nil {
-		resp := w.handler(t.req)
-		t.ch <- resp
-		w.releaseTask(t)
+// storeGauges copies the gauges for lock-free reads, it must be called under the mutex after the change
+func (w *Pool[Req, Resp]) storeGauges() {
+	storeGauge(&w.gauges.idle, int64(len(w.idle)))
+	storeGauge(&w.gauges.queued, int64(w.queue.len()))
+	storeGauge(&w.gauges.queuedBytes, int64(w.queuedBytes))
+	if w.spill != nil {
+		storeGauge(&w.gauges.spilled, int64(w.spill.len()))
+	}
+}
+
+// storeGauge stores the changed gauge only, gauges are written under the mutex, so the check is not racy
+func storeGauge(p *int64, v int64) {
+	if atomic.LoadInt64(p) != v {
+		atomic.StoreInt64(p, v)
+	}
+}
+
+func (w *Pool[Req, Resp]) dequeue() *task[Req, Resp] {
+	t := w.queue.pop()
+	if t == nil {
+		return nil
+	}
+	w.queuedBytes -= t.size
+	w.signalRoom()
+	w.storeGauges()
+	return t
+}
+
+// spawnWorker starts the worker goroutine, the goroutine is tracked for Close
+func (w *Pool[Req, Resp]) spawnWorker(t *task[Req, Resp], budgeted bool) {
+	w.workers.Add(1)
+	go w.newWorker(t, budgeted)
+}
+
+// newWorker runs the worker. If budgeted, the worker holds a share of the workers budget, see Partition.
+func (w *Pool[Req, Resp]) newWorker(t *task[Req, Resp], budgeted bool) {
+	wk := &worker[Req, Resp]{
+		ch:     make(chan *task[Req, Resp], 1),
+		budget: budgeted,
+		id:     atomic.AddInt64(&w.workersSeq, 1) - 1,
 	}
+	if w.stuckStacks {
+		wk.goid = goid()
+	}
+
+	w.mu.Lock()
+	w.live[wk] = struct{}{}
+	w.mu.Unlock()
+	defer w.exited(wk)
+
+	if w.newScratch != nil {
+		wk.scratch = w.newScratch()
+	}
+
+	id := wk.id
+
+	if w.lockOSThread {
+		// the thread is never unlocked, it terminates with the worker goroutine
+		runtime.LockOSThread()
+
+		if len(w.cpuAffinity) > 0 {
+			cpu := w.cpuAffinity[id%int64(len(w.cpuAffinity))]
+			if err := setAffinity(cpu); err != nil && w.onAffinityError != nil {
+				w.onAffinityError(err)
+			}
+		}
+	}
+
+	wk.util = w.util.shard(id)
 
-	timer := time.NewTimer(w.stopWorkerTimeout)
+	start := nanotime()
+	wk.util.workerStarted(start)
+	defer func() {
+		wk.util.workerStopped(start, nanotime())
+	}()
+
+	if w.onWorkerStart != nil {
+		w.onWorkerStart(id)
+	}
+	if w.onWorkerStop != nil {
+		defer w.onWorkerStop(id)
+	}
+	if w.workerWarmup != nil {
+		atomic.AddInt64(&w.gauges.warming, 1)
+		w.workerWarmup(id)
+		atomic.AddInt64(&w.gauges.warming, -1)
+	}
+
+	wk.lastDone = start
+	if !w.work(wk, t) {
+		return
+	}
+
+	// the timer is not reset after every task: when it fires, the worker stops, if it is idle long enough,
+	// otherwise the timer is set to the rest of the idle timeout
+	timer := time.NewTimer(w.idleTimeout())
 	defer timer.Stop()
 
 	for {
 		select {
-		case t = <-w.tasks:
-			resp := w.handler(t.req)
-			t.ch <- resp
-			w.releaseTask(t)
-			timer.Reset(w.stopWorkerTimeout)
+		case t = <-wk.ch:
+			if !w.work(wk, t) {
+				return
+			}
 		case <-timer.C:
-			if atomic.LoadInt64(&w.workersCount) > w.workersLimitMin {
+			timeout := w.idleTimeout()
+			if idle := time.Duration(nanotime() - wk.lastDone); idle < timeout {
+				timer.Reset(timeout - idle)
+				continue
+			}
+			if w.stopWorker(wk, timeout) {
 				return
 			}
-			timer.Reset(w.stopWorkerTimeout)
+			timer.Reset(timeout)
+		}
+	}
+}
+
+// work runs the task, then spins for new tasks before parking, if spinning is enabled.
+// Returns false, if the worker must stop.
+func (w *Pool[Req, Resp]) work(wk *worker[Req, Resp], t *task[Req, Resp]) bool {
+	for {
+		if !w.run(wk, t) {
+			return false
+		}
+		var ok bool
+		if t, ok = w.spin(wk); !ok {
+			return true
+		}
+	}
+}
+
+// spin polls the idle worker channel for a new task, yielding the processor between attempts.
+// Returns false, if the worker is not woken up.
+func (w *Pool[Req, Resp]) spin(wk *worker[Req, Resp]) (*task[Req, Resp], bool) {
+	for i := 0; i < w.spinIterations; i++ {
+		select {
+		case t := <-wk.ch:
+			return t, true
+		default:
+			runtime.Gosched()
+		}
+	}
+	return nil, false
+}
+
+// run executes the task and all queued tasks, then puts the worker to the idle list.
+// Returns false, if the worker must stop: it is crashed by the chaos injection or the pool is shut down.
+func (w *Pool[Req, Resp]) run(wk *worker[Req, Resp], t *task[Req, Resp]) bool {
+	if t == nil {
+		t = w.next(wk)
+	}
+	for t != nil {
+		if w.chaos != nil && w.chaos.crash() {
+			w.crashWorker(wk, t)
+			return false
+		}
+
+		if t.group.isCanceled() {
+			w.traceDecision(ReasonDropped)
+			t.group.deadLetter(t.req)
+			// tasks merged into the task are dropped with it, even of other groups, see Options.CoalesceWindow
+			t.deliverCoalesced(result[Req, Resp]{dropped: true})
+			t.group.drop()
+		} else {
+			start := nanotime()
+			wk.util.taskStarted(start)
+			atomic.StoreInt64(&wk.busySince, start)
+			if w.groupAffinity {
+				t.group.lastWorker.Store(wk)
+			}
+			w.taskStarted(t, start)
+			resp, err := w.call(t, wk.scratch)
+			end := nanotime()
+			wk.lastDone = end
+			atomic.StoreInt64(&wk.busySince, 0)
+			wk.util.taskDone(start, end)
+			t.busy += end - start
+
+			if w.retry != nil && w.retry(t.req, resp, t.attempt) {
+				w.requeue(t)
+				t = w.next(wk)
+				continue
+			}
+
+			wk.util.taskCompleted()
+			w.taskDone(t, resp, err)
+			t.deliver(w.taskResult(t, resp, err))
+		}
+		w.releaseTask(t)
+
+		t = w.next(wk)
+	}
+	return !wk.stopped
+}
+
+// requeue queues the task for the next attempt. The task is already accepted by the group,
+// so it is queued regardless of limits, to not block the worker.
+func (w *Pool[Req, Resp]) requeue(t *task[Req, Resp]) {
+	w.traceDecision(ReasonRetried)
+	t.attempt++
+
+	w.mu.Lock()
+	w.queue.retryDone(t)
+	w.enqueue(t)
+	w.mu.Unlock()
+}
+
+// next returns the next queued task, or puts the worker to the idle list and returns nil.
+// After Shutdown the worker is stopped instead.
+func (w *Pool[Req, Resp]) next(wk *worker[Req, Resp]) *task[Req, Resp] {
+	for {
+		var err error
+		var t *task[Req, Resp]
+		var record *spillRecord[Req, Resp]
+
+		w.mu.Lock()
+		// the worker takes queued tasks within the concurrency limit, and without a budget share, only if the budget allows
+		if !w.overLimit(0) && (w.budget == nil || wk.budget || w.takeBudget()) {
+			wk.budget = w.budget != nil
+			t = w.dequeue()
+			if t == nil && w.spill != nil {
+				if record = w.spill.pop(); record != nil {
+					t = record.t
+				}
+				w.storeGauges()
+			}
+		}
+		if t == nil {
+			if w.closed {
+				// the pool is shut down, the worker exits instead of going idle
+				wk.stopped = true
+				w.releaseWorker(wk)
+			} else {
+				w.idle = append(w.idle, wk)
+				w.storeGauges()
+			}
+			w.releaseBudget(wk)
+			w.checkDrained()
+			w.mu.Unlock()
+			return nil
 		}
+		if t.dequeued != nil {
+			close(t.dequeued)
+			t.dequeued = nil
+		}
+		w.mu.Unlock()
+
+		if record != nil {
+			// the request is read outside of the pool mutex
+			t, err = w.spill.restore(record)
+		}
+
+		if err != nil {
+			// the spilled task can not be restored, drop it
+			if w.onSpillError != nil {
+				w.onSpillError(err)
+			}
+		} else if now := time.Now(); !t.deadline.IsZero() && !t.deadline.After(now) {
+			// the task deadline is exceeded while the task was queued, drop it
+			t.group.expireOverdue(now)
+			t.group.deadLetter(t.req)
+		} else {
+			return t
+		}
+
+		w.traceDecision(ReasonDropped)
+		t.deliver(result[Req, Resp]{index: t.index, dropped: true})
+		w.releaseTask(t)
+	}
+}
+
+// idleTimeout returns the time after which the idle worker stops, it is shorter above the soft limit
+func (w *Pool[Req, Resp]) idleTimeout() time.Duration {
+	if w.workersLimitSoft > 0 && atomic.LoadInt64(&w.workersCount) > w.workersLimitSoft {
+		return w.burstWorkerTimeout
+	}
+	return w.stopWorkerTimeout
+}
+
+// stopWorker removes the idle worker from the pool, if the workers count is over the min limit,
+// or over the soft limit, if the worker is idle for the burst timeout only.
+// Returns false, if the worker should continue to work.
+func (w *Pool[Req, Resp]) stopWorker(wk *worker[Req, Resp], idle time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	count := atomic.LoadInt64(&w.workersCount)
+	if count <= w.workersLimitMin || w.parked() {
+		return false
+	}
+	if idle < w.stopWorkerTimeout && count <= w.workersLimitSoft {
+		return false
+	}
+
+	for i, v := range w.idle {
+		if v == wk {
+			copy(w.idle[i:], w.idle[i+1:])
+			w.idle[len(w.idle)-1] = nil
+			w.idle = w.idle[:len(w.idle)-1]
+			w.storeGauges()
+			w.releaseWorker(wk)
+			w.checkDrained()
+			return true
+		}
+	}
+
+	// the worker is already taken by a new task
+	return false
+}
+
+// dropQueued removes queued tasks of the group from the queue
+func (w *Pool[Req, Resp]) dropQueued(g *Group[Req, Resp]) {
+	w.mu.Lock()
+	tasks := append(w.queue.remove(g), w.queue.removeRetries(g)...)
+	for _, t := range tasks {
+		w.queuedBytes -= t.size
+	}
+	tasks = append(tasks, w.dropGroupWaiting(g)...)
+	for _, t := range tasks {
+		if t.dequeued != nil {
+			close(t.dequeued)
+			t.dequeued = nil
+		}
+	}
+	w.signalRoom()
+	w.storeGauges()
+	w.mu.Unlock()
+
+	for _, t := range tasks {
+		w.traceDecision(ReasonDropped)
+		g.deadLetter(t.req)
+		t.deliverCoalesced(result[Req, Resp]{dropped: true})
+		g.drop()
+		w.releaseTask(t)
 	}
 }
 
 func (w *Pool[Req, Resp]) acquireTask() *task[Req, Resp] {
+	if w.disablePooling {
+		return &task[Req, Resp]{}
+	}
 	t := w.tasksPool.Get()
 	if t == nil {
 		return &task[Req, Resp]{}
@@ -199,5 +1691,41 @@ func (w *Pool[Req, Resp]) acquireTask() *task[Req, Resp] {
 }
 
 func (w *Pool[Req, Resp]) releaseTask(t *task[Req, Resp]) {
-	w.tasksPool.Put(t)
+	if t.kindSlot {
+		t.kindSlot = false
+		w.releaseKind(t.kind)
+	}
+	if t.groupSlot {
+		t.groupSlot = false
+		w.releaseGroupSlot(t.group)
+	}
+	if t.retried {
+		w.mu.Lock()
+		w.queue.retryDone(t)
+		w.mu.Unlock()
+	}
+	if t.dedupKey != "" {
+		// the task is rejected before it is accepted, or dropped without delivery
+		for _, m := range w.dedup.finish(t) {
+			m.deliver(result[Req, Resp]{dropped: true})
+		}
+	}
+	t.group = nil
+	t.call = 0
+	t.ctx = nil
+	t.deadline = time.Time{}
+	t.due = time.Time{}
+	t.attempt = 0
+	t.priority = 0
+	t.wait = 0
+	t.busy = 0
+	t.try = false
+	t.info = nil
+	t.allocSampled = false
+	t.nested = false
+	clear(t.coalesced)
+	t.coalesced = t.coalesced[:0]
+	if !w.disablePooling {
+		w.tasksPool.Put(t)
+	}
 }
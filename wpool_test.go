@@ -1,7 +1,18 @@
 package wpool
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"runtime/trace"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -311,3 +322,3983 @@ func TestStopWorkersByTimeout(t *testing.T) {
 		t.Fatalf("workers count must be 0, got %d", count)
 	}
 }
+
+func TestGroupRateLimit(t *testing.T) {
+	handler := func(r int) int {
+		return r * 2
+	}
+
+	wp := New[int, int](handler, nil)
+
+	g := wp.AcquireGroupWithOptions(&GroupOptions{
+		RateLimit: 20,
+	})
+	defer wp.ReleaseGroup(g)
+
+	free := wp.AcquireGroup()
+	defer wp.ReleaseGroup(free)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		g.Go(i)
+	}
+	if end := time.Since(start); end < time.Millisecond*190 {
+		t.Fatalf("rate limit is not applied, elapsed %s", end)
+	}
+
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		free.Go(i)
+	}
+	if end := time.Since(start); end > time.Millisecond*10 {
+		t.Fatalf("group without rate limit is too slow, elapsed %s", end)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	if resp := g.Wait(ctx, nil); len(resp) != 5 {
+		t.Fatalf("expect 5 responses, got %d", len(resp))
+	}
+	if resp := free.Wait(ctx, nil); len(resp) != 5 {
+		t.Fatalf("expect 5 responses, got %d", len(resp))
+	}
+}
+
+func TestSpill(t *testing.T) {
+	release := make(chan struct{})
+
+	handler := func(r int) int {
+		<-release
+		return r * 2
+	}
+
+	dir := t.TempDir()
+	wp := New[int, int](handler, &Options{
+		WorkersLimitMax:          1,
+		SpillThreshold:           10,
+		SpillDir:                 dir,
+		GroupResponseChannelSize: 100,
+	}, &TypedOptions[int, int]{
+		SpillCodec: GobCodec[int]{},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		g.Go(i)
+	}
+	if end := time.Since(start); end > time.Millisecond*50 {
+		t.Fatalf("go must not block with spilling enabled, elapsed %s", end)
+	}
+
+	wp.mu.Lock()
+	queued, spilled := wp.queue.len(), wp.spill.len()
+	wp.mu.Unlock()
+
+	if queued != 10 {
+		t.Fatalf("expect 10 tasks in memory, got %d", queued)
+	}
+	if spilled != 89 {
+		t.Fatalf("expect 89 spilled tasks, got %d", spilled)
+	}
+
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	resp := g.Wait(ctx, nil)
+	if len(resp) != 100 {
+		t.Fatalf("expect 100 responses, got %d", len(resp))
+	}
+
+	for i, r := range resp {
+		if r != i*2 {
+			t.Fatalf("unexpected response %d at %d", r, i)
+		}
+	}
+
+	wp.Close()
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("expect the spill file is removed after Close, got %d files", len(files))
+	}
+}
+
+func TestSpillSegments(t *testing.T) {
+	release := make(chan struct{})
+	dir := t.TempDir()
+	wp := New[int, int](func(r int) int {
+		<-release
+		return r
+	}, &Options{
+		WorkersLimitMax: 1,
+		SpillThreshold:  1,
+		SpillDir:        dir,
+	}, &TypedOptions[int, int]{
+		SpillCodec: GobCodec[int]{},
+	})
+	defer wp.Close()
+	wp.spill.segment = 64
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	for i := 0; i < 100; i++ {
+		g.Go(i)
+	}
+	if files, _ := os.ReadDir(dir); len(files) < 2 {
+		t.Fatalf("expect requests are written to several files, got %d files", len(files))
+	}
+
+	close(release)
+	if resp := g.Wait(context.Background(), nil); len(resp) != 100 {
+		t.Fatalf("expect 100 responses, got %d", len(resp))
+	}
+
+	// consumed files are removed, the current one is reused
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("expect 1 spill file, got %d", len(files))
+	}
+	if info, err := files[0].Info(); err != nil || info.Size() != 0 {
+		t.Fatalf("expect the empty spill file, got %v, %v", info, err)
+	}
+}
+
+func TestMaxQueuedBytes(t *testing.T) {
+	release := make(chan struct{})
+
+	handler := func(r string) int {
+		<-release
+		return len(r)
+	}
+
+	wp := New[string, int](handler, &Options{
+		WorkersLimitMax: 1,
+		MaxQueuedBytes:  10,
+	}, &TypedOptions[string, int]{
+		SizeFunc: func(r string) int { return len(r) },
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	for i := 0; i < 5; i++ {
+		go g.Go("foobar")
+	}
+
+	// pause for tasks queueing
+	time.Sleep(time.Millisecond * 50)
+
+	wp.mu.Lock()
+	queued, queuedBytes := wp.queue.len(), wp.queuedBytes
+	wp.mu.Unlock()
+
+	if queued != 1 {
+		t.Fatalf("expect 1 queued task, got %d", queued)
+	}
+	if queuedBytes != 6 {
+		t.Fatalf("expect 6 queued bytes, got %d", queuedBytes)
+	}
+
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if resp := g.Wait(ctx, nil); len(resp) != 5 {
+		t.Fatalf("expect 5 responses, got %d", len(resp))
+	}
+}
+
+func TestMaxQueuedBytesSpill(t *testing.T) {
+	release := make(chan struct{})
+
+	handler := func(r string) int {
+		<-release
+		return len(r)
+	}
+
+	wp := New[string, int](handler, &Options{
+		WorkersLimitMax: 1,
+		MaxQueuedBytes:  10,
+		SpillDir:        t.TempDir(),
+	}, &TypedOptions[string, int]{
+		SizeFunc:   func(r string) int { return len(r) },
+		SpillCodec: GobCodec[string]{},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	for i := 0; i < 10; i++ {
+		g.Go("abcd")
+	}
+
+	wp.mu.Lock()
+	queued, spilled := wp.queue.len(), wp.spill.len()
+	wp.mu.Unlock()
+
+	if queued != 2 {
+		t.Fatalf("expect 2 tasks in memory, got %d", queued)
+	}
+	if spilled != 7 {
+		t.Fatalf("expect 7 spilled tasks, got %d", spilled)
+	}
+
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if resp := g.Wait(ctx, nil); len(resp) != 10 {
+		t.Fatalf("expect 10 responses, got %d", len(resp))
+	}
+}
+
+func TestSchedulingTrace(t *testing.T) {
+	release := make(chan struct{})
+
+	handler := func(r int) int {
+		if r < 3 {
+			<-release
+		}
+		return r * 2
+	}
+
+	var decisions int64
+
+	wp := New[int, int](handler, &Options{
+		WorkersLimitMax: 2,
+		TraceScheduling: true,
+		OnSchedulingDecision: func(reason SchedulingReason) {
+			atomic.AddInt64(&decisions, 1)
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go(1)
+	g.Go(2)
+	go g.Go(3)
+
+	// pause for blocking on the limit
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	time.Sleep(time.Millisecond * 50)
+
+	g.Go(4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if resp := g.Wait(ctx, nil); len(resp) != 4 {
+		t.Fatalf("expect 4 responses, got %d", len(resp))
+	}
+
+	trace := wp.SchedulingTrace()
+	if trace[ReasonSpawned] != 2 {
+		t.Fatalf("expect 2 spawned, got %d", trace[ReasonSpawned])
+	}
+	if trace[ReasonBlocked] != 1 {
+		t.Fatalf("expect 1 blocked, got %d", trace[ReasonBlocked])
+	}
+	if trace[ReasonReusedIdle] != 1 {
+		t.Fatalf("expect 1 reused idle, got %d", trace[ReasonReusedIdle])
+	}
+	if n := atomic.LoadInt64(&decisions); n != 4 {
+		t.Fatalf("expect 4 decisions, got %d", n)
+	}
+}
+
+func TestChaos(t *testing.T) {
+	handler := func(r int) int {
+		return r * 2
+	}
+
+	wp := New[int, int](handler, nil, &TypedOptions[int, int]{
+		Chaos: &Chaos[int, int]{
+			FailureRate: 1,
+			Failure:     func(r int) int { return -1 },
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	for i := 0; i < 4; i++ {
+		g.Go(i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	resp := g.Wait(ctx, nil)
+	if len(resp) != 4 {
+		t.Fatalf("expect 4 responses, got %d", len(resp))
+	}
+	for _, r := range resp {
+		if r != -1 {
+			t.Fatalf("expect failure response, got %d", r)
+		}
+	}
+}
+
+func TestChaosCrash(t *testing.T) {
+	handler := func(r int) int {
+		return r * 2
+	}
+
+	wp := New[int, int](handler, nil, &TypedOptions[int, int]{
+		Chaos: &Chaos[int, int]{
+			CrashRate: 1,
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	for i := 0; i < 4; i++ {
+		g.Go(i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	start := time.Now()
+	resp := g.Wait(ctx, nil)
+	end := time.Since(start)
+
+	if end > time.Millisecond*10 {
+		t.Fatal("too slow")
+	}
+	if len(resp) != 0 {
+		t.Fatalf("expect no responses, got %d", len(resp))
+	}
+	if count := wp.WorkersCount(); count != 0 {
+		t.Fatalf("workers count must be 0, got %d", count)
+	}
+}
+
+func TestBoostWaitingGroups(t *testing.T) {
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	var order []int
+
+	handler := func(r int) int {
+		if r == 0 {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, r)
+		mu.Unlock()
+		return r
+	}
+
+	wp := New[int, int](handler, &Options{
+		WorkersLimitMax:    1,
+		BoostWaitingGroups: true,
+	})
+
+	busy := wp.AcquireGroup()
+	busy.Go(0)
+
+	background := wp.AcquireGroup()
+	for i := 1; i <= 3; i++ {
+		go background.Go(i)
+	}
+
+	// pause for tasks queueing
+	time.Sleep(time.Millisecond * 20)
+
+	interactive := wp.AcquireGroup()
+	go interactive.Go(100)
+
+	time.Sleep(time.Millisecond * 20)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	done := make(chan []int)
+	go func() {
+		done <- interactive.Wait(ctx, nil)
+	}()
+
+	// pause for waiting
+	time.Sleep(time.Millisecond * 20)
+	close(release)
+
+	if resp := <-done; len(resp) != 1 {
+		t.Fatalf("expect 1 response, got %d", len(resp))
+	}
+	if resp := background.Wait(ctx, nil); len(resp) != 3 {
+		t.Fatalf("expect 3 responses, got %d", len(resp))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(order) != 5 || order[1] != 100 {
+		t.Fatalf("waiting group task must be executed first, got order %v", order)
+	}
+}
+
+func TestGroupDeadline(t *testing.T) {
+	release := make(chan struct{})
+
+	handler := func(r int) int {
+		if r == 0 {
+			<-release
+		}
+		return r * 2
+	}
+
+	wp := New[int, int](handler, &Options{
+		WorkersLimitMax: 1,
+	})
+	defer close(release)
+
+	busy := wp.AcquireGroup()
+	busy.Go(0)
+
+	g := wp.AcquireGroupWithDeadline(time.Now().Add(time.Millisecond * 50))
+
+	var submitted sync.WaitGroup
+	for i := 1; i <= 3; i++ {
+		submitted.Add(1)
+		go func(i int) {
+			defer submitted.Done()
+			g.Go(i)
+		}(i)
+	}
+
+	// queued tasks are dropped and submitters are unblocked at the deadline
+	submitted.Wait()
+
+	wp.mu.Lock()
+	queued := wp.queue.len()
+	wp.mu.Unlock()
+
+	if queued != 0 {
+		t.Fatalf("expect no queued tasks, got %d", queued)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	resp := g.Wait(ctx, nil)
+	end := time.Since(start)
+
+	if end > time.Millisecond*10 {
+		t.Fatal("too slow")
+	}
+	if len(resp) != 0 {
+		t.Fatalf("expect no responses, got %d", len(resp))
+	}
+}
+
+func TestWaitResultsPlaceholders(t *testing.T) {
+	handler := func(r int) int {
+		if r == 2 {
+			time.Sleep(time.Millisecond * 200)
+		}
+		return r * 2
+	}
+
+	wp := New[int, int](handler, nil)
+
+	g := wp.AcquireGroup()
+
+	g.Go(1)
+	g.Go(2)
+	g.Go(3)
+	g.Go(4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	resp := g.WaitResults(ctx, nil)
+	if len(resp) != 4 {
+		t.Fatalf("expect 4 results, got %d", len(resp))
+	}
+
+	for _, r := range resp {
+		if r.Index == 1 {
+			if !r.TimedOut {
+				t.Fatal("expect timed out placeholder for the task 1")
+			}
+			continue
+		}
+		if r.TimedOut || r.Resp != r.Req*2 || r.Req != r.Index+1 {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+}
+
+func TestUtilization(t *testing.T) {
+	handler := func(r int) int {
+		time.Sleep(time.Millisecond * 50)
+		return r * 2
+	}
+
+	wp := New[int, int](handler, &Options{
+		WorkersLimitMin: 1,
+		WorkersLimitMax: 1,
+	})
+
+	if u := wp.Utilization(); u != 0 {
+		t.Fatalf("expect zero utilization, got %f", u)
+	}
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	g.Wait(ctx, nil)
+	time.Sleep(time.Millisecond * 50)
+
+	if u := wp.Utilization(); u < 0.35 || u > 0.65 {
+		t.Fatalf("expect utilization about 0.5, got %f", u)
+	}
+}
+
+func TestSaturationReject(t *testing.T) {
+	release := make(chan struct{})
+
+	handler := func(r int) int {
+		<-release
+		return r * 2
+	}
+
+	wp := New[int, int](handler, &Options{
+		WorkersLimitMax:  2,
+		SaturationPolicy: SaturationReject,
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	if err := g.Submit(1); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := g.Submit(2); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	start := time.Now()
+	err := g.Submit(3)
+	if !errors.Is(err, ErrSaturated) {
+		t.Fatalf("expect ErrSaturated, got %v", err)
+	}
+	if end := time.Since(start); end > time.Millisecond {
+		t.Fatalf("rejection must be immediate, elapsed %s", end)
+	}
+
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if resp := g.Wait(ctx, nil); len(resp) != 2 {
+		t.Fatalf("expect 2 responses, got %d", len(resp))
+	}
+}
+
+func TestSaturationCallerRuns(t *testing.T) {
+	release := make(chan struct{})
+
+	handler := func(r int) int {
+		if r == 0 {
+			<-release
+		}
+		time.Sleep(time.Millisecond * 10)
+		return r * 2
+	}
+
+	wp := New[int, int](handler, &Options{
+		WorkersLimitMax:          1,
+		SaturationPolicy:         SaturationCallerRuns,
+		GroupResponseChannelSize: 1,
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go(0)
+
+	start := time.Now()
+	for i := 1; i <= 5; i++ {
+		g.Go(i)
+	}
+	if end := time.Since(start); end < time.Millisecond*50 {
+		t.Fatalf("tasks must be executed by the caller, elapsed %s", end)
+	}
+
+	if count := wp.WorkersCount(); count != 1 {
+		t.Fatalf("workers count must be 1, got %d", count)
+	}
+
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if resp := g.Wait(ctx, nil); len(resp) != 6 {
+		t.Fatalf("expect 6 responses, got %d", len(resp))
+	}
+}
+
+func TestDeadlineFunc(t *testing.T) {
+	type request struct {
+		id       int
+		deadline time.Time
+	}
+
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	var order []int
+
+	handler := func(r request) int {
+		if r.id == 0 {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, r.id)
+		mu.Unlock()
+		return r.id
+	}
+
+	wp := New[request, int](handler, &Options{
+		WorkersLimitMax: 1,
+	}, &TypedOptions[request, int]{
+		DeadlineFunc: func(r request) (time.Time, bool) {
+			return r.deadline, !r.deadline.IsZero()
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go(request{id: 0})
+
+	if err := g.Submit(request{id: 100, deadline: time.Now().Add(-time.Second)}); !errors.Is(err, ErrDeadlineExceeded) {
+		t.Fatalf("expect ErrDeadlineExceeded, got %v", err)
+	}
+
+	now := time.Now()
+	go g.Go(request{id: 4})
+	go g.Go(request{id: 3, deadline: now.Add(time.Second * 3)})
+	go g.Go(request{id: 2, deadline: now.Add(time.Second * 2)})
+	go g.Go(request{id: 1, deadline: now.Add(time.Second)})
+	go g.Go(request{id: 5, deadline: now.Add(time.Millisecond * 20)})
+
+	// pause for tasks queueing and the deadline of the task 5
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if resp := g.Wait(ctx, nil); len(resp) != 5 {
+		t.Fatalf("expect 5 responses, got %d", len(resp))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i, id := range order {
+		if id != i {
+			t.Fatalf("expect earliest deadline first order, got %v", order)
+		}
+	}
+}
+
+func TestWaitChunks(t *testing.T) {
+	handler := func(r int) int {
+		return r * 2
+	}
+
+	wp := New[int, int](handler, nil)
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	for i := 0; i < 10; i++ {
+		g.Go(i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var sizes []int
+	total := 0
+	for chunk := range g.WaitChunks(ctx, 3) {
+		sizes = append(sizes, len(chunk))
+		total += len(chunk)
+	}
+
+	if total != 10 {
+		t.Fatalf("expect 10 responses, got %d", total)
+	}
+	if len(sizes) != 4 || sizes[0] != 3 || sizes[3] != 1 {
+		t.Fatalf("unexpected chunks sizes %v", sizes)
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	handler := func(r int, attempt int) int {
+		if attempt < 3 {
+			return -1
+		}
+		return r * 2
+	}
+
+	wp := NewWithAttempt[int, int](handler, &Options{
+		WorkersLimitMax: 2,
+		TraceScheduling: true,
+	}, &TypedOptions[int, int]{
+		Retry: func(_ int, resp int, _ int) bool {
+			return resp < 0
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	for i := 0; i < 5; i++ {
+		g.Go(i)
+	}
+
+	resp := g.WaitResults(context.Background(), nil)
+	if len(resp) != 5 {
+		t.Fatalf("expect 5 results, got %d", len(resp))
+	}
+
+	for _, r := range resp {
+		if r.Attempts != 3 || r.Resp != r.Req*2 {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+
+	if n := wp.SchedulingTrace()[ReasonRetried]; n != 10 {
+		t.Fatalf("expect 10 retries, got %d", n)
+	}
+}
+
+func TestInlineLastTask(t *testing.T) {
+	release := make(chan struct{})
+	handler := func(r int) int {
+		if r == 0 {
+			<-release
+		}
+		return r * 2
+	}
+
+	wp := New[int, int](handler, &Options{
+		WorkersLimitMax: 1,
+		TraceScheduling: true,
+		InlineLastTask:  true,
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go(0)
+	g.Go(1) // queued without blocking
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		close(release)
+	}()
+
+	resp := g.Wait(ctx, nil)
+	if len(resp) != 2 {
+		t.Fatalf("expect 2 responses, got %v", resp)
+	}
+
+	// the inlined task is done before the running one
+	if resp[0] != 2 || resp[1] != 0 {
+		t.Fatalf("expect inlined response first, got %v", resp)
+	}
+
+	if n := wp.SchedulingTrace()[ReasonInlined]; n != 1 {
+		t.Fatalf("expect 1 inlined task, got %d", n)
+	}
+}
+
+func TestLabels(t *testing.T) {
+	labels := map[string]string{"component": "api"}
+
+	wp := New[int, int](func(r int) int { return r }, &Options{
+		Name:   "images",
+		Labels: labels,
+	})
+
+	labels["component"] = "changed"
+
+	res := wp.Labels()
+	if len(res) != 2 || res["name"] != "images" || res["component"] != "api" {
+		t.Fatalf("unexpected labels %v", res)
+	}
+	if wp.Name() != "images" {
+		t.Fatalf("unexpected name %q", wp.Name())
+	}
+
+	res["name"] = "changed"
+	if wp.Name() != "images" {
+		t.Fatal("expect labels copy")
+	}
+
+	if len(New[int, int](func(r int) int { return r }, nil).Labels()) != 0 {
+		t.Fatal("expect no labels")
+	}
+}
+
+var expvarSeq int64
+
+func TestPublishExpvar(t *testing.T) {
+	wp := New[int, int](func(r int) int { return r }, &Options{
+		Name:            "expvar",
+		TraceScheduling: true,
+	})
+
+	g := wp.AcquireGroup()
+	g.Go(1)
+	g.Wait(context.Background(), nil)
+	wp.ReleaseGroup(g)
+
+	// expvar names are global, so every run publishes a new name, e.g. with -count
+	name := fmt.Sprintf("wpool_test_%d", atomic.AddInt64(&expvarSeq, 1))
+	wp.PublishExpvar(name)
+
+	v := expvar.Get(name)
+	if v == nil {
+		t.Fatal("expect published variable")
+	}
+
+	var res struct {
+		Workers    int64             `json:"workers"`
+		Submitted  int64             `json:"submitted"`
+		Completed  int64             `json:"completed"`
+		Labels     map[string]string `json:"labels"`
+		Scheduling map[string]int64  `json:"scheduling"`
+	}
+	if err := json.Unmarshal([]byte(v.String()), &res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Workers != 1 || res.Submitted != 1 || res.Completed != 1 || res.Labels["name"] != "expvar" || res.Scheduling["spawned"] != 1 {
+		t.Fatalf("unexpected variable %s", v.String())
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	type req struct {
+		key string
+		seq int
+	}
+
+	errDuplicate := errors.New("duplicate")
+
+	seen := map[string]bool{}
+	seq := 0
+
+	wp := New[req, int](func(r req) int {
+		time.Sleep(time.Millisecond * 5)
+		return r.seq
+	}, nil, &TypedOptions[req, int]{
+		// no lock around seen and seq, the pool calls Prepare serially
+		Prepare: func(r req) (req, error) {
+			if seen[r.key] {
+				return r, errDuplicate
+			}
+			seen[r.key] = true
+			seq++
+			r.seq = seq
+			return r, nil
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	var duplicates int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 10; k++ {
+				err := g.Submit(req{key: string(rune('a' + k))})
+				if errors.Is(err, errDuplicate) {
+					atomic.AddInt64(&duplicates, 1)
+				} else if err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	resp := g.Wait(context.Background(), nil)
+	if len(resp) != 10 || duplicates != 30 {
+		t.Fatalf("expect 10 responses and 30 duplicates, got %d and %d", len(resp), duplicates)
+	}
+
+	got := map[int]bool{}
+	for _, r := range resp {
+		got[r] = true
+	}
+	for i := 1; i <= 10; i++ {
+		if !got[i] {
+			t.Fatalf("expect sequence %d in %v", i, resp)
+		}
+	}
+}
+
+func TestGroupConcurrentSubmit(t *testing.T) {
+	wp := New[int, int](func(r int) int { return r }, &Options{
+		WorkersLimitMax: 4,
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	const producers, tasks = 8, 200
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < tasks; i++ {
+				g.Go(p*tasks + i)
+			}
+		}(p)
+	}
+
+	// Wait may return between submissions, so wait until all results are received
+	seen := make(map[int]bool, producers*tasks)
+	stop := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stop)
+	}()
+
+	var resp []int
+	for {
+		resp = g.Wait(context.Background(), resp[:0])
+		for _, r := range resp {
+			if seen[r] {
+				t.Fatalf("duplicate result %d", r)
+			}
+			seen[r] = true
+		}
+		select {
+		case <-stop:
+			resp = g.Wait(context.Background(), resp[:0])
+			for _, r := range resp {
+				seen[r] = true
+			}
+			if len(seen) != producers*tasks {
+				t.Fatalf("expect %d results, got %d", producers*tasks, len(seen))
+			}
+			return
+		default:
+		}
+	}
+}
+
+func TestWaitInProgressSubmit(t *testing.T) {
+	wp := New[int, int](func(r int) int { return r }, nil)
+
+	g := wp.AcquireGroupWithOptions(&GroupOptions{RateLimit: 10})
+	defer wp.ReleaseGroup(g)
+
+	g.Go(1)
+
+	go g.Go(2) // blocks in the rate limiter
+	time.Sleep(time.Millisecond * 20)
+
+	resp := g.Wait(context.Background(), nil)
+	if len(resp) != 2 {
+		t.Fatalf("expect Wait to wait for the submission in progress, got %v", resp)
+	}
+}
+
+func TestGroupMultipleWaiters(t *testing.T) {
+	release := make(chan struct{})
+	wp := New[int, int](func(r int) int {
+		<-release
+		return r
+	}, nil)
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	for i := 0; i < 10; i++ {
+		g.Go(i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res := make([][]int, 3)
+	var wg sync.WaitGroup
+	for i := range res {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res[i] = g.Wait(ctx, nil)
+		}(i)
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	close(release)
+	wg.Wait()
+
+	for i, r := range res {
+		if len(r) != 10 {
+			t.Fatalf("expect all results for the waiter %d, got %v", i, r)
+		}
+	}
+
+	// results are received, so the next Wait returns nothing
+	if r := g.Wait(ctx, nil); len(r) != 0 {
+		t.Fatalf("expect no results, got %v", r)
+	}
+}
+
+func TestGroupDone(t *testing.T) {
+	release := make(chan struct{})
+	wp := New[int, int](func(r int) int {
+		<-release
+		return r
+	}, nil)
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	select {
+	case <-g.Done():
+	default:
+		t.Fatal("expect the empty group done")
+	}
+
+	g.Go(1)
+	g.Go(2)
+
+	done := g.Done()
+	select {
+	case <-done:
+		t.Fatal("expect the group not done")
+	case <-time.After(time.Millisecond * 20):
+	}
+
+	close(release)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect the group done")
+	}
+
+	if resp := g.Wait(context.Background(), nil); len(resp) != 2 {
+		t.Fatalf("expect 2 responses, got %v", resp)
+	}
+}
+
+func TestWaitUntil(t *testing.T) {
+	var executed int64
+	wp := New[int, int](func(r int) int {
+		atomic.AddInt64(&executed, 1)
+		time.Sleep(time.Millisecond * 10)
+		return r
+	}, &Options{
+		WorkersLimitMax: 2,
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	go func() {
+		for i := 0; i < 100; i++ {
+			if g.Submit(i) != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(time.Millisecond * 5)
+
+	resp := g.WaitUntil(context.Background(), func(resp []int) bool {
+		return len(resp) >= 3
+	})
+	if len(resp) != 3 {
+		t.Fatalf("expect 3 responses, got %v", resp)
+	}
+
+	time.Sleep(time.Millisecond * 50)
+	if n := atomic.LoadInt64(&executed); n > 10 {
+		t.Fatalf("expect remaining tasks canceled, executed %d", n)
+	}
+
+	if err := g.Submit(1); !errors.Is(err, ErrGroupCanceled) {
+		t.Fatalf("expect ErrGroupCanceled, got %v", err)
+	}
+}
+
+func TestShutdownPriority(t *testing.T) {
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	var order []int
+
+	wp := New[int, int](func(r int) int {
+		if r == 100 {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, r)
+		mu.Unlock()
+		return r
+	}, &Options{
+		WorkersLimitMax:   1,
+		ShutdownDropBelow: 1,
+	}, &TypedOptions[int, int]{
+		PriorityFunc: func(r int) int {
+			return r
+		},
+	})
+
+	g := wp.AcquireGroup()
+
+	g.Go(100) // blocks the only worker
+
+	// queued tasks block their submitters, so submit them concurrently
+	for _, r := range []int{2, -1, 5, 0, 3} {
+		go g.Go(r)
+	}
+	time.Sleep(time.Millisecond * 50)
+
+	done := make(chan error)
+	go func() {
+		done <- wp.Shutdown(context.Background())
+	}()
+	time.Sleep(time.Millisecond * 20)
+
+	if err := g.Submit(1); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expect ErrPoolClosed, got %v", err)
+	}
+
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	res := g.WaitResults(context.Background(), nil)
+	if len(res) != 6 {
+		t.Fatalf("expect 6 results, got %d", len(res))
+	}
+	dropped := 0
+	for _, r := range res {
+		if r.Dropped {
+			dropped++
+		}
+	}
+	if dropped != 2 {
+		t.Fatalf("expect 2 dropped tasks, got %d", dropped)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 4 || order[0] != 100 || order[1] != 5 || order[2] != 3 || order[3] != 2 {
+		t.Fatalf("expect priority order, got %v", order)
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	if n := wp.WorkersCount(); n != 0 {
+		t.Fatalf("expect workers stopped, got %d", n)
+	}
+}
+
+func TestShutdownContext(t *testing.T) {
+	release := make(chan struct{})
+	wp := New[int, int](func(r int) int {
+		<-release
+		return r
+	}, &Options{
+		WorkersLimitMax: 1,
+	})
+
+	g := wp.AcquireGroup()
+	g.Go(1)
+
+	// queued tasks block their submitters, so submit them concurrently
+	for i := 2; i <= 4; i++ {
+		go g.Go(i)
+	}
+	time.Sleep(time.Millisecond * 20)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	err := wp.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+	var se *ShutdownError
+	if !errors.As(err, &se) || se.Dropped != 3 {
+		t.Fatalf("expect 3 dropped tasks, got %v", err)
+	}
+
+	close(release)
+
+	res := g.WaitResults(context.Background(), nil)
+	if len(res) != 4 {
+		t.Fatalf("expect 4 results, got %d", len(res))
+	}
+	dropped := 0
+	for _, r := range res {
+		if r.Dropped {
+			dropped++
+		} else if r.Req != 1 {
+			t.Fatalf("expect only the running task done, got %d", r.Req)
+		}
+	}
+	if dropped != 3 {
+		t.Fatalf("expect 3 dropped results, got %d", dropped)
+	}
+}
+
+func TestScratch(t *testing.T) {
+	var created int64
+
+	wp := NewWithScratch[int, int, *[]byte](func() *[]byte {
+		atomic.AddInt64(&created, 1)
+		b := make([]byte, 0, 1024)
+		return &b
+	}, func(r int, buf *[]byte) int {
+		*buf = append((*buf)[:0], make([]byte, r)...)
+		return len(*buf)
+	}, &Options{
+		WorkersLimitMax: 2,
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	for i := 0; i < 100; i++ {
+		g.Go(i)
+	}
+
+	resp := g.Wait(context.Background(), nil)
+	if len(resp) != 100 {
+		t.Fatalf("expect 100 responses, got %d", len(resp))
+	}
+
+	if n := atomic.LoadInt64(&created); n != 2 {
+		t.Fatalf("expect a scratch per worker, got %d", n)
+	}
+}
+
+func TestDisablePooling(t *testing.T) {
+	wp := New[int, int](func(r int) int { return r }, &Options{
+		DisablePooling: true,
+	})
+
+	g1 := wp.AcquireGroup()
+	g1.Go(1)
+	g1.Wait(context.Background(), nil)
+	wp.ReleaseGroup(g1)
+
+	g2 := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g2)
+	if g1 == g2 {
+		t.Fatal("expect a new group")
+	}
+
+	if wp.acquireTask() == wp.acquireTask() {
+		t.Fatal("expect new tasks")
+	}
+}
+
+func TestOnShutdown(t *testing.T) {
+	wp := New[int, int](func(r int) int { return r }, &Options{
+		WorkersLimitMin: 2,
+	})
+
+	var order []int
+	wp.OnShutdown(func() { order = append(order, 1) })
+	wp.OnShutdown(func() { order = append(order, 2) })
+
+	if err := wp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.Shutdown(context.Background()); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expect ErrPoolClosed, got %v", err)
+	}
+
+	wp.OnShutdown(func() { order = append(order, 3) })
+
+	if len(order) != 3 || order[0] != 2 || order[1] != 1 || order[2] != 3 {
+		t.Fatalf("expect hooks called once in reverse order, got %v", order)
+	}
+}
+
+func TestGroupStats(t *testing.T) {
+	wp := NewWithAttempt[int, int](func(r int, attempt int) int {
+		time.Sleep(time.Millisecond * time.Duration(r))
+		if r == 1 && attempt == 1 {
+			return -1
+		}
+		return r
+	}, &Options{
+		WorkersLimitMax: 1,
+	}, &TypedOptions[int, int]{
+		Retry: func(_ int, resp int, _ int) bool {
+			return resp < 0
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	go g.Go(10)
+	go g.Go(1)
+	go g.Go(20)
+
+	time.Sleep(time.Millisecond * 5)
+	g.Wait(context.Background(), nil)
+
+	s := g.Stats()
+	if s.Tasks != 3 || s.Dropped != 0 || s.Retries != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if s.Max < time.Millisecond*20 || s.P50 < time.Millisecond*10 || s.Busy < time.Millisecond*32 {
+		t.Fatalf("unexpected durations %+v", s)
+	}
+	if s.QueueWait <= 0 || s.MaxQueueWait < s.QueueWaitP50 || s.QueueWaitP99 != s.MaxQueueWait {
+		t.Fatalf("expect queue wait, got %+v", s)
+	}
+}
+
+func TestQueueWaits(t *testing.T) {
+	wp := New[int, int](func(r int) int {
+		time.Sleep(time.Millisecond * 5)
+		return r
+	}, &Options{WorkersLimitMax: 1, QueueWaitAudit: true})
+
+	victim := wp.AcquireGroupWithOptions(&GroupOptions{Name: "victim"})
+	defer wp.ReleaseGroup(victim)
+	bulk := wp.AcquireGroupWithOptions(&GroupOptions{Name: "bulk"})
+	defer wp.ReleaseGroup(bulk)
+
+	for i := 0; i < 4; i++ {
+		bulk.Go(i)
+	}
+	victim.Go(0)
+	victim.Wait(context.Background(), nil)
+	bulk.Wait(context.Background(), nil)
+
+	waits := wp.QueueWaits()
+	if len(waits) != 2 || waits["bulk"].Tasks != 4 || waits["victim"].Tasks != 1 {
+		t.Fatalf("unexpected queue waits %+v", waits)
+	}
+	if v := waits["victim"]; v.P50 < time.Millisecond*5 || v.Max != v.P99 || v.Avg != v.Max {
+		t.Fatalf("expect the victim wait, got %+v", v)
+	}
+
+	if New[int, int](func(r int) int { return r }, nil).QueueWaits() != nil {
+		t.Fatal("expect nil without the audit")
+	}
+}
+
+func TestPartition(t *testing.T) {
+	var mu sync.Mutex
+	running := map[string]int{}
+	maxRunning := map[string]int{}
+	total, maxTotal := 0, 0
+
+	type req struct {
+		key string
+		id  int
+	}
+
+	wp := New[req, int](func(r req) int {
+		mu.Lock()
+		running[r.key]++
+		total++
+		maxRunning[r.key] = max(maxRunning[r.key], running[r.key])
+		maxTotal = max(maxTotal, total)
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond * 10)
+
+		mu.Lock()
+		running[r.key]--
+		total--
+		mu.Unlock()
+		return r.id
+	}, &Options{
+		WorkersLimitMax: 3,
+	})
+
+	part := wp.Partition(func(r req) string {
+		return r.key
+	}, func(key string) *Options {
+		if key == "a" {
+			return &Options{WorkersLimitMax: 1}
+		}
+		return nil
+	})
+
+	if part.For(req{key: "a"}) != part.Pool("a") {
+		t.Fatal("expect the same sub-pool for the key")
+	}
+
+	var wg sync.WaitGroup
+	for _, key := range []string{"a", "b", "c"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			sub := part.Pool(key)
+			g := sub.AcquireGroup()
+			defer sub.ReleaseGroup(g)
+			for i := 0; i < 10; i++ {
+				g.Go(req{key: key, id: i})
+			}
+			if resp := g.Wait(context.Background(), nil); len(resp) != 10 {
+				t.Errorf("expect 10 responses for %q, got %d", key, len(resp))
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	if maxRunning["a"] != 1 {
+		t.Fatalf("expect the sub-pool limit 1, got %d", maxRunning["a"])
+	}
+	if maxTotal > 3 {
+		t.Fatalf("expect the shared limit 3, got %d", maxTotal)
+	}
+	if len(part.Keys()) != 3 {
+		t.Fatalf("expect 3 sub-pools, got %v", part.Keys())
+	}
+
+	if err := wp.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := part.Pool("a").AcquireGroup().Submit(req{}); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expect sub-pools closed, got %v", err)
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	errNegative := errors.New("negative")
+
+	wp := New[int, int](func(r int) int { return r }, nil, &TypedOptions[int, int]{
+		Interceptors: []func(int) (int, error){
+			func(r int) (int, error) {
+				if r < 0 {
+					return r, errNegative
+				}
+				return r, nil
+			},
+			func(r int) (int, error) {
+				if r == 0 {
+					return 100, nil // default value
+				}
+				return r, nil
+			},
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	if err := g.Submit(-1); !errors.Is(err, errNegative) {
+		t.Fatalf("expect errNegative, got %v", err)
+	}
+	if err := g.Submit(0); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := g.Wait(context.Background(), nil)
+	if len(resp) != 1 || resp[0] != 100 {
+		t.Fatalf("expect the intercepted request, got %v", resp)
+	}
+}
+
+func TestGroupTimeoutDeadLetter(t *testing.T) {
+	var mu sync.Mutex
+	var dead []int
+
+	wp := New[int, int](func(r int) int {
+		time.Sleep(time.Millisecond * 30)
+		return r
+	}, &Options{
+		WorkersLimitMax: 1,
+	}, &TypedOptions[int, int]{
+		DeadLetter: func(r int, err error) {
+			if !errors.Is(err, ErrGroupExpired) {
+				t.Errorf("expect ErrGroupExpired, got %v", err)
+			}
+			mu.Lock()
+			dead = append(dead, r)
+			mu.Unlock()
+		},
+	})
+
+	g := wp.AcquireGroupWithOptions(&GroupOptions{Timeout: time.Millisecond * 45})
+	defer wp.ReleaseGroup(g)
+
+	for i := 0; i < 5; i++ {
+		go g.Go(i)
+		time.Sleep(time.Millisecond)
+	}
+
+	resp := g.Wait(context.Background(), nil)
+	if len(resp) != 1 {
+		t.Fatalf("expect 1 response before the timeout, got %v", resp)
+	}
+
+	// the running task is passed to the dead letter, when it is done
+	time.Sleep(time.Millisecond * 50)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dead) != 4 {
+		t.Fatalf("expect 4 dead letters, got %v", dead)
+	}
+}
+
+func TestNewWithError(t *testing.T) {
+	errOdd := errors.New("odd")
+
+	wp := NewWithError[int, int](func(r int) (int, error) {
+		if r%2 == 1 {
+			return 0, errOdd
+		}
+		return r, nil
+	}, nil)
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	for i := 0; i < 4; i++ {
+		g.Go(i)
+	}
+
+	resp, err := g.WaitErr(context.Background(), nil)
+	if len(resp) != 2 || !errors.Is(err, errOdd) {
+		t.Fatalf("expect 2 responses and errOdd, got %v, %v", resp, err)
+	}
+	if s := g.Stats(); s.Failures != 2 {
+		t.Fatalf("expect 2 failures, got %d", s.Failures)
+	}
+
+	g.Go(1)
+	res := g.WaitResults(context.Background(), nil)
+	if len(res) != 1 || !errors.Is(res[0].Err, errOdd) {
+		t.Fatalf("expect the error in the result, got %+v", res)
+	}
+}
+
+func TestPanics(t *testing.T) {
+	wp := New[int, int](func(r int) int {
+		if r < 0 {
+			panic("negative")
+		}
+		return r
+	}, nil, &TypedOptions[int, int]{
+		KindFunc: func(r int) string {
+			if r%2 == 0 {
+				return "even"
+			}
+			return "odd"
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go(1)
+	g.Go(-1)
+	g.Go(-2)
+	g.Go(-3)
+
+	res := g.WaitResults(context.Background(), nil)
+	if len(res) != 4 {
+		t.Fatalf("expect 4 results, got %d", len(res))
+	}
+	for _, r := range res {
+		var pe *PanicError
+		if r.Req < 0 && (!errors.As(r.Err, &pe) || pe.Value != "negative" || len(pe.Stack) == 0) {
+			t.Fatalf("expect PanicError, got %v", r.Err)
+		}
+	}
+
+	p := wp.Panics()
+	if p["odd"] != 2 || p["even"] != 1 {
+		t.Fatalf("unexpected panics counts %v", p)
+	}
+	if recent := wp.RecentPanics(); len(recent) != 3 || recent[0].Value != "negative" {
+		t.Fatalf("unexpected recent panics %v", recent)
+	}
+}
+
+func TestNewWithContext(t *testing.T) {
+	canceled := make(chan int, 3)
+
+	wp := NewWithContext[int, int](func(ctx context.Context, r int) int {
+		select {
+		case <-ctx.Done():
+			canceled <- r
+		case <-time.After(time.Second):
+		}
+		return r
+	}, nil, &TypedOptions[int, int]{
+		DeadlineFunc: func(r int) (time.Time, bool) {
+			return time.Now().Add(time.Millisecond * 20), r == 3
+		},
+	})
+
+	// the Wait context
+	g := wp.AcquireGroup()
+	g.Go(1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	g.Wait(ctx, nil)
+	cancel()
+
+	// the group deadline
+	g2 := wp.AcquireGroupWithDeadline(time.Now().Add(time.Millisecond * 20))
+	g2.Go(2)
+
+	// the task deadline
+	g3 := wp.AcquireGroup()
+	g3.Go(3)
+
+	got := map[int]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-canceled:
+			got[r] = true
+		case <-time.After(time.Millisecond * 500):
+			t.Fatalf("expect running tasks canceled, got %v", got)
+		}
+	}
+
+	wp.ReleaseGroup(g)
+	wp.ReleaseGroup(g2)
+	wp.ReleaseGroup(g3)
+}
+
+func TestKindLimits(t *testing.T) {
+	var running, maxRunning int64
+
+	wp := New[int, int](func(r int) int {
+		if r < 0 {
+			n := atomic.AddInt64(&running, 1)
+			for {
+				m := atomic.LoadInt64(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt64(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond * 10)
+			atomic.AddInt64(&running, -1)
+		}
+		return r
+	}, &Options{
+		WorkersLimitMax: 8,
+		KindLimits:      map[string]int{"slow": 1},
+	}, &TypedOptions[int, int]{
+		KindFunc: func(r int) string {
+			if r < 0 {
+				return "slow"
+			}
+			return "fast"
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Go(-i)
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		g.Go(i)
+	}
+	wg.Wait()
+
+	res := g.WaitResults(context.Background(), nil)
+	if len(res) != 14 {
+		t.Fatalf("expect 14 results, got %d", len(res))
+	}
+	if m := atomic.LoadInt64(&maxRunning); m != 1 {
+		t.Fatalf("expect max 1 slow task at once, got %d", m)
+	}
+}
+
+func TestClose(t *testing.T) {
+	var executed int64
+
+	wp := New[int, int](func(r int) int {
+		time.Sleep(time.Millisecond * 5)
+		atomic.AddInt64(&executed, 1)
+		return r
+	}, &Options{
+		WorkersLimitMin: 2,
+		WorkersLimitMax: 2,
+	})
+
+	g := wp.AcquireGroup()
+	for i := 0; i < 6; i++ {
+		g.Go(i)
+	}
+
+	wp.Close()
+	wp.Close()
+
+	if n := atomic.LoadInt64(&executed); n != 6 {
+		t.Fatalf("expect 6 executed tasks, got %d", n)
+	}
+	if n := wp.WorkersCount(); n != 0 {
+		t.Fatalf("expect no workers, got %d", n)
+	}
+	if err := g.Submit(1); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expect ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestStuckWorkers(t *testing.T) {
+	block := make(chan struct{})
+	blocked := make(chan struct{})
+	reported := make(chan StuckWorker, 1)
+
+	wp := New[int, int](func(r int) int {
+		if r == 1 {
+			close(blocked)
+			<-block
+		}
+		return r
+	}, &Options{
+		StopWorkerTimeout: time.Millisecond * 50,
+		StuckWorkerStacks: true,
+		OnStuckWorker: func(s StuckWorker) {
+			reported <- s
+		},
+	})
+
+	g := wp.AcquireGroup()
+	g.Go(1)
+	g.Go(2)
+	<-blocked
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := wp.Shutdown(ctx); err != nil {
+		t.Fatalf("expect the pool drained without the stuck worker, got %v", err)
+	}
+
+	stuck := wp.StuckWorkers()
+	if len(stuck) != 1 || stuck[0].Busy < time.Millisecond*50 || !strings.Contains(string(stuck[0].Stack), "TestStuckWorkers") {
+		t.Fatalf("unexpected stuck workers %v", stuck)
+	}
+	if s := <-reported; s.ID != stuck[0].ID {
+		t.Fatalf("expect reported worker %d, got %d", stuck[0].ID, s.ID)
+	}
+	if n := wp.WorkersCount(); n != 0 {
+		t.Fatalf("expect stuck worker excluded, got %d workers", n)
+	}
+
+	// Close does not wait for the stuck worker
+	wp.Close()
+	close(block)
+}
+
+func TestTraceExtractor(t *testing.T) {
+	type traceKey struct{}
+	type baseKey struct{}
+
+	wp := NewWithContext[string, string](func(ctx context.Context, r string) string {
+		trace, _ := ctx.Value(traceKey{}).(string)
+		base, _ := ctx.Value(baseKey{}).(string)
+		return trace + "/" + base
+	}, &Options{
+		BaseContext: context.WithValue(context.Background(), baseKey{}, "base"),
+	}, &TypedOptions[string, string]{
+		TraceExtractor: func(r string) context.Context {
+			if r == "" {
+				return nil
+			}
+			return context.WithValue(context.Background(), traceKey{}, "trace-"+r)
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go("1")
+	g.Go("")
+
+	res := g.WaitResults(context.Background(), nil)
+	if len(res) != 2 {
+		t.Fatalf("expect 2 results, got %d", len(res))
+	}
+	for _, r := range res {
+		expect := "trace-" + r.Req + "/base"
+		if r.Req == "" {
+			expect = "/base"
+		}
+		if r.Resp != expect {
+			t.Fatalf("expect %q, got %q", expect, r.Resp)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	wp := New[int, int](func(r int) int {
+		time.Sleep(time.Millisecond * 5)
+		return r
+	}, &Options{
+		Labels:           map[string]string{"app": "test"},
+		WorkersLimitMax:  1,
+		SaturationPolicy: SaturationReject,
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go(1)
+	if err := g.Submit(2); !errors.Is(err, ErrSaturated) {
+		t.Fatalf("expect ErrSaturated, got %v", err)
+	}
+
+	s := wp.Stats()
+	if s.Workers != 1 || s.BusyWorkers != 1 || s.IdleWorkers != 0 {
+		t.Fatalf("expect 1 busy worker, got %+v", s)
+	}
+
+	g.Wait(context.Background(), nil)
+	time.Sleep(time.Millisecond * 10)
+
+	s = wp.Stats()
+	if s.Submitted != 2 || s.Rejected != 1 || s.Completed != 1 || s.Dropped != 0 || s.Queued != 0 {
+		t.Fatalf("unexpected tasks counts %+v", s)
+	}
+	if s.IdleWorkers != 1 || s.BusyWorkers != 0 || s.HandlerTime < time.Millisecond*5 || s.Labels["app"] != "test" {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestAcquireGroupSized(t *testing.T) {
+	wp := New[int, int](func(r int) int { return r }, nil)
+
+	large := wp.AcquireGroupSized(1000)
+	if c := cap(large.results); c < 1000 {
+		t.Fatalf("expect results capacity at least 1000, got %d", c)
+	}
+	for i := 0; i < 1000; i++ {
+		large.Go(i)
+	}
+	if res := large.Wait(context.Background(), nil); len(res) != 1000 {
+		t.Fatalf("expect 1000 results, got %d", len(res))
+	}
+	wp.ReleaseGroup(large)
+
+	// the large group is not reused for small groups
+	small := wp.AcquireGroupSized(3)
+	defer wp.ReleaseGroup(small)
+	if c := cap(small.results); c < 3 || c >= 1000 {
+		t.Fatalf("expect small results capacity, got %d", c)
+	}
+}
+
+func TestInvokeHook(t *testing.T) {
+	type spanKey struct{}
+
+	var mu sync.Mutex
+	var spans []string
+
+	wp := NewWithContext[string, string](func(ctx context.Context, r string) string {
+		if r == "fail" {
+			panic("failed")
+		}
+		span, _ := ctx.Value(spanKey{}).(string)
+		return span
+	}, &Options{
+		InvokeHook: func(ctx context.Context, info InvokeInfo) (context.Context, func(error)) {
+			parent, _ := ctx.Value(spanKey{}).(string)
+			span := parent + "/task"
+			return context.WithValue(ctx, spanKey{}, span), func(err error) {
+				mu.Lock()
+				spans = append(spans, fmt.Sprintf("%s attempt=%d err=%v", span, info.Attempt, err))
+				mu.Unlock()
+			}
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.GoContext(context.WithValue(context.Background(), spanKey{}, "root"), "ok")
+	if err := g.SubmitContext(context.Background(), "fail"); err != nil {
+		t.Fatal(err)
+	}
+
+	res := g.WaitResults(context.Background(), nil)
+	if len(res) != 2 {
+		t.Fatalf("expect 2 results, got %d", len(res))
+	}
+	for _, r := range res {
+		if r.Req == "ok" && r.Resp != "root/task" {
+			t.Fatalf("expect the span of the submission context, got %q", r.Resp)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(spans)
+	if len(spans) != 2 || spans[0] != "/task attempt=1 err=wpool: handler panic: failed" || spans[1] != "root/task attempt=1 err=<nil>" {
+		t.Fatalf("unexpected spans %v", spans)
+	}
+}
+
+func TestKindStats(t *testing.T) {
+	wp := New[int, int](func(r int) int {
+		if r < 0 {
+			time.Sleep(time.Millisecond * 10)
+		}
+		return r
+	}, &Options{
+		KindCPUTime: true,
+	}, &TypedOptions[int, int]{
+		KindFunc: func(r int) string {
+			if r < 0 {
+				return "slow"
+			}
+			return "fast"
+		},
+	})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go(1)
+	g.Go(2)
+	g.Go(-1)
+	g.Wait(context.Background(), nil)
+
+	s := wp.KindStats()
+	if s["fast"].Tasks != 2 || s["slow"].Tasks != 1 {
+		t.Fatalf("unexpected tasks counts %v", s)
+	}
+	if s["slow"].Busy < time.Millisecond*10 || s["fast"].Busy >= s["slow"].Busy {
+		t.Fatalf("unexpected busy times %v", s)
+	}
+	if s["slow"].CPU < 0 || s["fast"].CPU < 0 {
+		t.Fatalf("unexpected CPU times %v", s)
+	}
+
+	if New[int, int](func(r int) int { return r }, nil).KindStats() != nil {
+		t.Fatal("expect nil stats without KindFunc")
+	}
+}
+
+func TestConcurrencyFunc(t *testing.T) {
+	var running, maxRunning int64
+	limit := int64(2)
+
+	wp := New[int, int](func(r int) int {
+		n := atomic.AddInt64(&running, 1)
+		for {
+			m := atomic.LoadInt64(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt64(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 20)
+		atomic.AddInt64(&running, -1)
+		return r
+	}, &Options{
+		WorkersLimitMax:     8,
+		ConcurrencyFunc:     func() int { return int(atomic.LoadInt64(&limit)) },
+		ConcurrencyInterval: time.Millisecond * 5,
+	})
+	defer wp.Close()
+
+	if n := wp.ConcurrencyLimit(); n != 2 {
+		t.Fatalf("expect limit 2, got %d", n)
+	}
+
+	run := func(n int) {
+		g := wp.AcquireGroup()
+		defer wp.ReleaseGroup(g)
+
+		// queued tasks block their submitters, so submit them concurrently
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				g.Go(i)
+			}()
+		}
+		wg.Wait()
+
+		if res := g.Wait(context.Background(), nil); len(res) != n {
+			t.Fatalf("expect %d results, got %d", n, len(res))
+		}
+	}
+
+	run(6)
+	if m := atomic.LoadInt64(&maxRunning); m != 2 {
+		t.Fatalf("expect max 2 running tasks, got %d", m)
+	}
+
+	atomic.StoreInt64(&limit, 4)
+	time.Sleep(time.Millisecond * 20)
+	atomic.StoreInt64(&maxRunning, 0)
+
+	run(8)
+	if m := atomic.LoadInt64(&maxRunning); m != 4 {
+		t.Fatalf("expect max 4 running tasks, got %d", m)
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(format string, args ...any) {
+		mu.Lock()
+		events = append(events, fmt.Sprintf(format, args...))
+		mu.Unlock()
+	}
+
+	wp := New[int, int](func(r int) int {
+		return r * 2
+	}, &Options{
+		WorkersLimitMax: 1,
+		OnWorkerStart:   func(id int64) { record("worker start %d", id) },
+		OnWorkerStop:    func(id int64) { record("worker stop %d", id) },
+	}, &TypedOptions[int, int]{
+		OnTaskStart: func(req int) { record("task start %d", req) },
+		OnTaskDone: func(req int, resp int, info TaskInfo) {
+			record("task done %d %d %d", req, resp, info.Attempts)
+		},
+	})
+
+	g := wp.AcquireGroup()
+	g.Go(1)
+	g.Wait(context.Background(), nil)
+	wp.ReleaseGroup(g)
+	wp.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expect := []string{"worker start 0", "task start 1", "task done 1 2 1", "worker stop 0"}
+	if strings.Join(events, ",") != strings.Join(expect, ",") {
+		t.Fatalf("expect events %v, got %v", expect, events)
+	}
+}
+
+func TestNewWithEmit(t *testing.T) {
+	wp := NewWithEmit[int, int](func(r int, emit func(int)) {
+		for i := 0; i < r; i++ {
+			emit(r*10 + i)
+		}
+	}, nil)
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go(0)
+	g.Go(1)
+	g.Go(3)
+
+	resp := g.Wait(context.Background(), nil)
+	sort.Ints(resp)
+	if fmt.Sprint(resp) != "[10 30 31 32]" {
+		t.Fatalf("unexpected responses %v", resp)
+	}
+
+	g.Go(2)
+	results := g.WaitResults(context.Background(), nil)
+	if len(results) != 2 || results[0].Index != 3 || results[1].Index != 3 {
+		t.Fatalf("unexpected results %+v", results)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	wp := NewWithError[int, int](func(r int) (int, error) {
+		time.Sleep(time.Duration(r) * time.Millisecond)
+		return r, nil
+	}, nil, &TypedOptions[int, int]{
+		DeadlineFunc: func(r int) (time.Time, bool) {
+			return time.Now().Add(-time.Second), r < 0
+		},
+	})
+
+	g := wp.AcquireGroup()
+
+	var de *DeadlineError
+	if err := g.Submit(-1); !errors.Is(err, ErrDeadlineExceeded) || !errors.As(err, &de) || de.Deadline.IsZero() {
+		t.Fatalf("expect DeadlineError, got %v", err)
+	}
+
+	g.Go(500)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	_, err := g.WaitErr(ctx, nil)
+	cancel()
+	if !errors.Is(err, ErrTaskTimeout) {
+		t.Fatalf("expect ErrTaskTimeout, got %v", err)
+	}
+
+	results := g.WaitResults(context.Background(), nil)
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	wp.ReleaseGroup(g)
+	if err := g.Submit(1); !errors.Is(err, ErrGroupReleased) {
+		t.Fatalf("expect ErrGroupReleased, got %v", err)
+	}
+	if _, err := g.WaitErr(context.Background(), nil); !errors.Is(err, ErrGroupReleased) {
+		t.Fatalf("expect ErrGroupReleased, got %v", err)
+	}
+
+	wp.Close()
+	if err := wp.AcquireGroup().Submit(1); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expect ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestGroupCancel(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+
+	wp := New[int, int](func(r int) int {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return r
+	}, &Options{WorkersLimitMax: 1})
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	g.Go(1)
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go g.Go(2)
+	go g.Go(3)
+	for wp.Stats().Queued < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	g.Cancel()
+	<-g.Done()
+	if resp := g.Wait(context.Background(), nil); len(resp) != 0 {
+		t.Fatalf("unexpected responses %v", resp)
+	}
+	if err := g.Submit(4); !errors.Is(err, ErrGroupCanceled) {
+		t.Fatalf("expect ErrGroupCanceled, got %v", err)
+	}
+
+	close(release)
+	wp.Close()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expect 1 call, got %d", n)
+	}
+}
+
+func TestWorkerWarmup(t *testing.T) {
+	warm := make(chan struct{})
+	var warmed int32
+
+	wp := New[int, int](func(r int) int {
+		if atomic.LoadInt32(&warmed) < 2 {
+			t.Error("the task is executed by the cold worker")
+		}
+		return r
+	}, &Options{
+		WorkersLimitMin: 2,
+		WorkerWarmup: func(int64) {
+			<-warm
+			atomic.AddInt32(&warmed, 1)
+		},
+	})
+	defer wp.Close()
+
+	for wp.Stats().WarmingWorkers != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if s := wp.Stats(); s.BusyWorkers != 0 || s.IdleWorkers != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	close(warm)
+	for wp.Stats().IdleWorkers != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if s := wp.Stats(); s.WarmingWorkers != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	g.Go(1)
+	g.Go(2)
+	if resp := g.Wait(context.Background(), nil); len(resp) != 2 {
+		t.Fatalf("unexpected responses %v", resp)
+	}
+}
+
+func TestAdaptiveGroupSize(t *testing.T) {
+	wp := New[int, int](func(r int) int { return r }, &Options{DisablePooling: true})
+
+	round := func() {
+		g := wp.AcquireGroup()
+		for i := 0; i < 200; i++ {
+			g.Go(i)
+		}
+		if res := g.Wait(context.Background(), nil); len(res) != 200 {
+			t.Fatalf("expect 200 results, got %d", len(res))
+		}
+		wp.ReleaseGroup(g)
+	}
+
+	round()
+	if n := wp.Stats().GroupBufferGrowths; n == 0 {
+		t.Fatal("expect buffer growths")
+	}
+
+	for i := 0; i < 50; i++ {
+		round()
+	}
+	growths := wp.Stats().GroupBufferGrowths
+	round()
+	if n := wp.Stats().GroupBufferGrowths; n != growths {
+		t.Fatalf("expect no buffer growths, got %d", n-growths)
+	}
+}
+
+func TestTryGo(t *testing.T) {
+	release := make(chan struct{})
+
+	wp := New[int, int](func(r int) int {
+		<-release
+		return r
+	}, &Options{WorkersLimitMax: 1})
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	if !g.TryGo(1) {
+		t.Fatal("expect the task is accepted")
+	}
+	if g.TryGo(2) {
+		t.Fatal("expect the task is rejected")
+	}
+	close(release)
+	if resp := g.Wait(context.Background(), nil); len(resp) != 1 || resp[0] != 1 {
+		t.Fatalf("unexpected responses %v", resp)
+	}
+
+	for wp.Stats().IdleWorkers != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	limited := wp.AcquireGroupWithOptions(&GroupOptions{RateLimit: 1})
+	defer wp.ReleaseGroup(limited)
+	if !limited.TryGo(3) {
+		t.Fatal("expect the task is accepted")
+	}
+	if limited.TryGo(4) {
+		t.Fatal("expect the rate limited task is rejected")
+	}
+	limited.Wait(context.Background(), nil)
+}
+
+func TestMaxPendingTasksCanceled(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	wp := New[int, int](func(r int) int {
+		started <- struct{}{}
+		<-release
+		return r
+	}, &Options{WorkersLimitMax: 1, MaxPendingTasks: 1})
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	g.Go(1)
+	<-started
+	g.Go(2)
+
+	// the third task is accepted and waits for the room
+	submitted := make(chan error, 1)
+	go func() {
+		submitted <- g.Submit(3)
+	}()
+	for {
+		g.mu.Lock()
+		pending := g.pending
+		g.mu.Unlock()
+		if pending == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	g.Cancel()
+	if err := <-submitted; err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	close(release)
+
+	select {
+	case <-g.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expect the canceled group is done")
+	}
+	select {
+	case <-g.settled():
+	case <-time.After(time.Second):
+		t.Fatal("expect the canceled group is settled")
+	}
+}
+
+func TestMaxPendingTasks(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowReject, OverflowDropOldest} {
+		release := make(chan struct{})
+		started := make(chan struct{}, 1)
+
+		wp := New[int, int](func(r int) int {
+			started <- struct{}{}
+			<-release
+			return r
+		}, &Options{
+			WorkersLimitMax: 1,
+			MaxPendingTasks: 2,
+			OverflowPolicy:  policy,
+		})
+
+		g := wp.AcquireGroup()
+		g.Go(1)
+		<-started
+
+		// queued without blocking
+		g.Go(2)
+		g.Go(3)
+		if q := wp.Stats().Queued; q != 2 {
+			t.Fatalf("policy %d: expect 2 queued tasks, got %d", policy, q)
+		}
+
+		submitted := make(chan error, 1)
+		go func() {
+			submitted <- g.Submit(4)
+		}()
+
+		switch policy {
+		case OverflowBlock:
+			select {
+			case <-submitted:
+				t.Fatalf("policy %d: expect the submitter is blocked", policy)
+			case <-time.After(time.Millisecond * 20):
+			}
+		case OverflowReject:
+			if err := <-submitted; !errors.Is(err, ErrQueueFull) {
+				t.Fatalf("policy %d: expect ErrQueueFull, got %v", policy, err)
+			}
+		case OverflowDropOldest:
+			if err := <-submitted; err != nil {
+				t.Fatalf("policy %d: unexpected error %v", policy, err)
+			}
+		}
+
+		go func() {
+			for range started {
+			}
+		}()
+		close(release)
+
+		results := g.WaitResults(context.Background(), nil)
+		var resp, dropped []int
+		for _, r := range results {
+			if r.Dropped {
+				dropped = append(dropped, r.Req)
+			} else {
+				resp = append(resp, r.Resp)
+			}
+		}
+		sort.Ints(resp)
+
+		expect := map[OverflowPolicy]string{
+			OverflowBlock:      "[1 2 3 4] []",
+			OverflowReject:     "[1 2 3] []",
+			OverflowDropOldest: "[1 3 4] [2]",
+		}[policy]
+		if s := fmt.Sprint(resp, dropped); s != expect {
+			t.Fatalf("policy %d: expect %s, got %s", policy, expect, s)
+		}
+
+		wp.ReleaseGroup(g)
+		wp.Close()
+		close(started)
+	}
+}
+
+func TestSubmitInfo(t *testing.T) {
+	release := make(chan struct{})
+
+	wp := New[int, int](func(r int) int {
+		if r > 0 {
+			<-release
+		}
+		return r
+	}, &Options{
+		WorkersLimitMax: 1,
+		MaxPendingTasks: 10,
+	}, &TypedOptions[int, int]{
+		PriorityFunc: func(r int) int { return r },
+	})
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	// the completed task for the ETA estimation
+	if info, err := g.SubmitInfo(0); err != nil || info.Queued {
+		t.Fatalf("unexpected info %+v, error %v", info, err)
+	}
+	g.Wait(context.Background(), nil)
+	for wp.Stats().IdleWorkers != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	g.Go(1)
+	for _, c := range []struct {
+		req      int
+		position int
+	}{{1, 0}, {1, 1}, {2, 0}, {1, 3}} {
+		info, err := g.SubmitInfo(c.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Queued || info.Position != c.position {
+			t.Fatalf("request %d: expect position %d, got %+v", c.req, c.position, info)
+		}
+	}
+
+	close(release)
+	if resp := g.Wait(context.Background(), nil); len(resp) != 5 {
+		t.Fatalf("unexpected responses %v", resp)
+	}
+}
+
+func TestSpareWorkersRatio(t *testing.T) {
+	release := make(chan struct{})
+
+	wp := New[int, int](func(r int) int {
+		<-release
+		return r
+	}, &Options{
+		StopWorkerTimeout: time.Millisecond * 10,
+		SpareWorkersRatio: 0.5,
+		PeakWindow:        time.Millisecond * 200,
+	})
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	for i := 0; i < 4; i++ {
+		g.Go(i)
+	}
+	close(release)
+	g.Wait(context.Background(), nil)
+
+	// the workers are kept for the recent peak
+	time.Sleep(time.Millisecond * 100)
+	if n := wp.WorkersCount(); n != 4 {
+		t.Fatalf("expect 4 workers, got %d", n)
+	}
+
+	// the peak is expired
+	deadline := time.Now().Add(time.Second * 2)
+	for wp.WorkersCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect no workers, got %d", wp.WorkersCount())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestGroupAffinity(t *testing.T) {
+	var ids int32
+	var started sync.WaitGroup
+	started.Add(2)
+
+	wp := NewWithScratch[bool, int32](func() *int32 {
+		id := atomic.AddInt32(&ids, 1)
+		return &id
+	}, func(first bool, id *int32) int32 {
+		if first {
+			// both first tasks run concurrently on different workers
+			started.Done()
+			started.Wait()
+		}
+		return *id
+	}, &Options{GroupAffinity: true, TraceScheduling: true})
+	defer wp.Close()
+
+	a := wp.AcquireGroup()
+	defer wp.ReleaseGroup(a)
+	b := wp.AcquireGroup()
+	defer wp.ReleaseGroup(b)
+
+	a.Go(true)
+	b.Go(true)
+	workerA := a.Wait(context.Background(), nil)[0]
+	workerB := b.Wait(context.Background(), nil)[0]
+	if workerA == workerB {
+		t.Fatal("expect different workers")
+	}
+	// the result is delivered before the worker becomes idle, so wait for both workers before the next task
+	waitIdle := func() {
+		for wp.Stats().IdleWorkers != 2 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitIdle()
+
+	for i := 0; i < 5; i++ {
+		a.Go(false)
+		if w := a.Wait(context.Background(), nil)[0]; w != workerA {
+			t.Fatalf("expect the worker %d for the group a, got %d", workerA, w)
+		}
+		waitIdle()
+		b.Go(false)
+		if w := b.Wait(context.Background(), nil)[0]; w != workerB {
+			t.Fatalf("expect the worker %d for the group b, got %d", workerB, w)
+		}
+		waitIdle()
+	}
+
+	if n := wp.SchedulingTrace()[ReasonAffinity]; n != 10 {
+		t.Fatalf("expect 10 affinity decisions, got %d", n)
+	}
+}
+
+func TestOrderedGroup(t *testing.T) {
+	wp := New[int, int](func(r int) int {
+		time.Sleep(time.Duration(10-r) * time.Millisecond)
+		return r
+	}, nil)
+	defer wp.Close()
+
+	g := wp.AcquireOrderedGroup()
+	defer wp.ReleaseGroup(g)
+
+	for i := 0; i < 10; i++ {
+		g.Go(i)
+	}
+	var resp []int
+	for chunk := range g.WaitChunks(context.Background(), 3) {
+		resp = append(resp, chunk...)
+	}
+	if fmt.Sprint(resp) != "[0 1 2 3 4 5 6 7 8 9]" {
+		t.Fatalf("unexpected responses %v", resp)
+	}
+
+	emitting := NewWithEmit[int, int](func(r int, emit func(int)) {
+		time.Sleep(time.Duration(5-r) * time.Millisecond)
+		for i := 0; i < r; i++ {
+			emit(r*10 + i)
+		}
+	}, nil)
+	defer emitting.Close()
+
+	eg := emitting.AcquireOrderedGroup()
+	defer emitting.ReleaseGroup(eg)
+	for i := 0; i < 5; i++ {
+		eg.Go(i)
+	}
+	if resp := eg.Wait(context.Background(), nil); fmt.Sprint(resp) != "[10 20 21 30 31 32 40 41 42 43]" {
+		t.Fatalf("unexpected emitted responses %v", resp)
+	}
+}
+
+var allocSink []byte
+
+func TestKindAllocSampling(t *testing.T) {
+	wp := New[string, int](func(r string) int {
+		if r == "large" {
+			allocSink = make([]byte, 1<<20)
+		}
+		return len(r)
+	}, &Options{
+		KindAllocSampling: 2,
+	}, &TypedOptions[string, int]{
+		KindFunc: func(r string) string { return r },
+	})
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	for i := 0; i < 10; i++ {
+		g.Go("large")
+		g.Wait(context.Background(), nil)
+		g.Go("small")
+		g.Wait(context.Background(), nil)
+	}
+
+	stats := wp.KindStats()
+	large := stats["large"]
+	if large.AllocSamples != 10 {
+		t.Fatalf("expect 10 sampled tasks, got %+v", stats)
+	}
+	if large.AllocBytes/large.AllocSamples < 1<<20 {
+		t.Fatalf("expect at least 1MB per large task, got %+v", large)
+	}
+	if small := stats["small"]; small.AllocSamples != 0 {
+		t.Fatalf("expect no sampled small tasks, got %+v", small)
+	}
+}
+
+func TestWaitResultsEnvelope(t *testing.T) {
+	errOdd := errors.New("odd")
+
+	wp := NewWithError[int, int](func(r int) (int, error) {
+		time.Sleep(time.Millisecond * 5)
+		switch {
+		case r == 3:
+			panic("three")
+		case r%2 == 1:
+			return 0, errOdd
+		}
+		return r * 2, nil
+	}, nil)
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	for i := 0; i < 4; i++ {
+		g.Go(i)
+	}
+
+	results := g.WaitResults(context.Background(), nil)
+	sort.Slice(results, func(i, j int) bool { return results[i].Req < results[j].Req })
+	if len(results) != 4 {
+		t.Fatalf("expect 4 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.Busy < time.Millisecond*5 {
+			t.Fatalf("request %d: expect the handler duration at least 5ms, got %v", r.Req, r.Busy)
+		}
+	}
+	var pe *PanicError
+	if results[0].Resp != 0 || results[2].Resp != 4 || !errors.Is(results[1].Err, errOdd) || !errors.As(results[3].Err, &pe) {
+		t.Fatalf("unexpected results %+v", results)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	trace := func(name string) Middleware[int, int] {
+		return func(next Handler[int, int]) Handler[int, int] {
+			return func(ctx context.Context, req int) (int, error) {
+				mu.Lock()
+				calls = append(calls, name)
+				mu.Unlock()
+				return next(ctx, req)
+			}
+		}
+	}
+
+	var failed int32
+	wp := NewWithError[int, int](func(r int) (int, error) {
+		if r < 0 && atomic.AddInt32(&failed, 1) == 1 {
+			return 0, errors.New("flaky")
+		}
+		return r, nil
+	}, nil, &TypedOptions[int, int]{Middleware: []Middleware[int, int]{trace("pool")}})
+	defer wp.Close()
+
+	run := func(g *Group[int, int], req int) ([]int, error) {
+		defer wp.ReleaseGroup(g)
+		mu.Lock()
+		calls = nil
+		mu.Unlock()
+		g.Go(req)
+		return g.WaitErr(context.Background(), nil)
+	}
+
+	run(wp.AcquireGroup(), 1)
+	if fmt.Sprint(calls) != "[pool]" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+
+	run(wp.AcquireGroupWithMiddleware(nil, trace("group")), 1)
+	if fmt.Sprint(calls) != "[pool group]" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+
+	retry := func(next Handler[int, int]) Handler[int, int] {
+		return func(ctx context.Context, req int) (int, error) {
+			resp, err := next(ctx, req)
+			if err != nil {
+				return next(ctx, req)
+			}
+			return resp, err
+		}
+	}
+	resp, err := run(wp.AcquireGroupWithMiddleware(&GroupOptions{OverrideMiddleware: true}, trace("group"), retry), -1)
+	if fmt.Sprint(calls) != "[group]" || err != nil || len(resp) != 1 {
+		t.Fatalf("unexpected calls %v, responses %v, error %v", calls, resp, err)
+	}
+
+	panicking := func(Handler[int, int]) Handler[int, int] {
+		return func(context.Context, int) (int, error) {
+			panic("middleware")
+		}
+	}
+	var pe *PanicError
+	if _, err := run(wp.AcquireGroupWithMiddleware(nil, panicking), 1); !errors.As(err, &pe) {
+		t.Fatalf("expect PanicError, got %v", err)
+	}
+}
+
+func TestResults(t *testing.T) {
+	wp := New[int, int](func(r int) int { return r * 2 }, nil)
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	for i := 0; i < 10; i++ {
+		g.Go(i)
+	}
+
+	sum := 0
+	for resp := range g.Results(context.Background()) {
+		sum += resp
+		if sum >= 20 {
+			break
+		}
+	}
+
+	// remaining results are received later
+	for resp := range g.Results(context.Background()) {
+		sum += resp
+	}
+	if sum != 90 {
+		t.Fatalf("expect the sum 90, got %d", sum)
+	}
+}
+
+func TestResultChan(t *testing.T) {
+	wp := New[int, int](func(r int) int { return r * 2 }, nil)
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	for i := 0; i < 10; i++ {
+		g.Go(i)
+	}
+
+	sum := 0
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for ch := g.ResultChan(); ch != nil; {
+		select {
+		case resp, ok := <-ch:
+			if !ok {
+				ch = nil
+				break
+			}
+			sum += resp
+		case <-ticker.C:
+		}
+	}
+	if sum != 90 {
+		t.Fatalf("expect the sum 90, got %d", sum)
+	}
+
+	// the abandoned channel is closed by the group cancellation
+	g.Go(1)
+	ch := g.ResultChan()
+	g.Cancel()
+	timeout := time.After(time.Second)
+	for ok := true; ok; {
+		select {
+		case _, ok = <-ch:
+		case <-timeout:
+			t.Fatal("expect the closed channel")
+		}
+	}
+}
+
+func TestOnResult(t *testing.T) {
+	wp := NewWithError[int, int](func(r int) (int, error) {
+		time.Sleep(time.Millisecond)
+		if r < 0 {
+			return 0, errors.New("negative")
+		}
+		return r, nil
+	}, nil)
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+
+	sum := 0
+	g.OnResult(func(resp int) {
+		time.Sleep(time.Millisecond)
+		sum += resp
+	})
+	for i := 0; i < 10; i++ {
+		g.Go(i)
+	}
+	g.Go(-1)
+
+	resp, err := g.WaitErr(context.Background(), nil)
+	if len(resp) != 0 || err == nil {
+		t.Fatalf("expect the error only, got %v, %v", resp, err)
+	}
+	if sum != 45 {
+		t.Fatalf("expect the sum 45 after Wait, got %d", sum)
+	}
+}
+
+func TestCoalesceWindow(t *testing.T) {
+	var calls int32
+	wp := New[[]string, []string](func(keys []string) []string {
+		atomic.AddInt32(&calls, 1)
+		return keys
+	}, &Options{
+		TraceScheduling: true,
+		CoalesceWindow:  time.Millisecond * 20,
+	}, &TypedOptions[[]string, []string]{
+		CoalesceKey: func(keys []string) string {
+			return keys[0][:1]
+		},
+		CoalesceMerge: func(held, keys []string) []string {
+			return append(held, keys...)
+		},
+	})
+	defer wp.Close()
+
+	g1 := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g1)
+	g2 := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g2)
+
+	g1.Go([]string{"a1"})
+	g2.Go([]string{"a2"})
+	g1.Go([]string{"b1"})
+
+	res1 := g1.Wait(context.Background(), nil)
+	res2 := g2.Wait(context.Background(), nil)
+	if n := atomic.LoadInt32(&calls); n > 2 {
+		t.Fatalf("expect 2 handler calls, got %d", n)
+	}
+	if len(res1) != 2 || len(res2) != 1 || strings.Join(res2[0], ",") != "a1,a2" {
+		t.Fatalf("unexpected responses %v, %v", res1, res2)
+	}
+	if n := wp.SchedulingTrace()[ReasonCoalesced]; n != 1 {
+		t.Fatalf("expect 1 coalesced task, got %d", n)
+	}
+
+	// the held task is rejected by the closed pool
+	g3 := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g3)
+	g3.Go([]string{"c1"})
+	g3.Go([]string{"c2"})
+	wp.Close()
+	if _, err := g3.WaitErr(context.Background(), nil); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expect ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestCoalesceWindowCanceled(t *testing.T) {
+	release := make(chan struct{})
+	wp := New[string, string](func(key string) string {
+		<-release
+		return key
+	}, &Options{WorkersLimitMax: 1, CoalesceWindow: time.Millisecond * 10}, &TypedOptions[string, string]{
+		CoalesceKey: func(key string) string { return key },
+	})
+	defer wp.Close()
+
+	// the worker is busy, so the held task is queued after the window
+	busy := wp.AcquireGroup()
+	defer wp.ReleaseGroup(busy)
+	busy.Go("")
+
+	g1 := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g1)
+	g2 := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g2)
+	g1.Go("a")
+	g2.Go("a")
+
+	// the task of g2 is merged into the held task of g1 and dropped with it
+	for wp.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	g1.Cancel()
+	close(release)
+	results := g2.WaitResults(context.Background(), nil)
+	if len(results) != 1 || !results[0].Dropped {
+		t.Fatalf("expect the merged task is dropped, got %+v", results)
+	}
+}
+
+func TestWaitN(t *testing.T) {
+	wp := New[int, int](func(r int) int {
+		time.Sleep(time.Millisecond * time.Duration(r))
+		return r
+	}, nil)
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	g.Go(100)
+	g.Go(1)
+	g.Go(2)
+
+	resp := g.WaitN(context.Background(), 2, nil)
+	if len(resp) != 2 || resp[0]+resp[1] != 3 {
+		t.Fatalf("expect 2 fast responses, got %v", resp)
+	}
+
+	resp = g.Wait(context.Background(), nil)
+	if len(resp) != 1 || resp[0] != 100 {
+		t.Fatalf("expect the remaining response, got %v", resp)
+	}
+}
+
+func TestRetryShare(t *testing.T) {
+	var running, maxRunning int32
+	wp := NewWithAttempt[int, int](func(r int, attempt int) int {
+		if attempt > 1 {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+		}
+		time.Sleep(time.Millisecond)
+		if r < 0 && attempt < 3 {
+			return -1
+		}
+		return 1
+	}, &Options{
+		WorkersLimitMax: 4,
+		RetryShare:      0.25,
+	}, &TypedOptions[int, int]{
+		Retry: func(_ int, resp int, _ int) bool {
+			return resp < 0
+		},
+	})
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	for i := 0; i < 8; i++ {
+		g.Go(-1)
+	}
+	for i := 0; i < 8; i++ {
+		g.Go(1)
+	}
+
+	resp := g.Wait(context.Background(), nil)
+	if len(resp) != 16 {
+		t.Fatalf("expect 16 responses, got %d", len(resp))
+	}
+	if n := atomic.LoadInt32(&maxRunning); n != 1 {
+		t.Fatalf("expect 1 retried task at once, got %d", n)
+	}
+}
+
+func TestGroupTransfer(t *testing.T) {
+	wp := New[int, int](func(r int) int { return r * 2 }, nil)
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	g.Go(1)
+	g.Go(2)
+
+	h := g.Transfer()
+	if g.Transfer() != nil {
+		t.Fatal("expect nil for the second transfer")
+	}
+	if err := g.Submit(3); !errors.Is(err, ErrGroupTransferred) {
+		t.Fatalf("expect ErrGroupTransferred, got %v", err)
+	}
+	if resp, err := g.WaitErr(context.Background(), nil); len(resp) != 0 || !errors.Is(err, ErrGroupTransferred) {
+		t.Fatalf("expect ErrGroupTransferred for the previous owner, got %v, %v", resp, err)
+	}
+
+	done := make(chan []int)
+	go func() {
+		defer h.Release()
+		done <- h.Wait(context.Background(), nil)
+	}()
+	if resp := <-done; len(resp) != 2 || resp[0]+resp[1] != 6 {
+		t.Fatalf("unexpected responses %v", resp)
+	}
+}
+
+func TestWaitAny(t *testing.T) {
+	wp := NewWithError[int, int](func(r int) (int, error) {
+		if r < 0 {
+			return 0, errors.New("negative")
+		}
+		time.Sleep(time.Millisecond * time.Duration(r))
+		return r, nil
+	}, nil)
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	g.Go(-1)
+	g.Go(100)
+	g.Go(5)
+
+	if resp, ok := g.WaitAny(context.Background()); !ok || resp != 5 {
+		t.Fatalf("expect the fastest response 5, got %d, %v", resp, ok)
+	}
+	g.Cancel()
+	if _, ok := g.WaitAny(context.Background()); ok {
+		t.Fatal("expect no response of the canceled group")
+	}
+}
+
+func TestRejectionStats(t *testing.T) {
+	wp := New[int, int](func(r int) int {
+		time.Sleep(time.Millisecond * 20)
+		return r
+	}, &Options{
+		WorkersLimitMax:  1,
+		SaturationPolicy: SaturationReject,
+	}, &TypedOptions[int, int]{
+		Interceptors: []func(int) (int, error){func(r int) (int, error) {
+			if r < 0 {
+				return r, errors.New("negative")
+			}
+			return r, nil
+		}},
+	})
+	defer wp.Close()
+
+	g := wp.AcquireGroupWithOptions(&GroupOptions{RateLimit: 1, RateBurst: 3})
+	defer wp.ReleaseGroup(g)
+
+	g.Go(1)
+	g.Go(2) // saturated
+	g.Go(-1)
+	g.TryGo(3) // rate limited
+
+	want := RejectionStats{Saturated: 1, RateLimited: 1, Intercepted: 1}
+	if s := g.Stats().Rejections; s != want {
+		t.Fatalf("expect group rejections %+v, got %+v", want, s)
+	}
+
+	canceled := wp.AcquireGroup()
+	defer wp.ReleaseGroup(canceled)
+	canceled.Cancel()
+	canceled.Go(4)
+
+	want.Canceled = 1
+	if s := wp.Stats().Rejections; s != want {
+		t.Fatalf("expect pool rejections %+v, got %+v", want, s)
+	}
+}
+
+func TestCancelOnError(t *testing.T) {
+	errFirst := errors.New("first")
+	var calls int32
+	wp := NewWithContextError[int, int](func(ctx context.Context, r int) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		if r == 1 {
+			return 0, errFirst
+		}
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}, &Options{WorkersLimitMax: 2, MaxPendingTasks: 10})
+	defer wp.Close()
+
+	g := wp.AcquireGroupWithOptions(&GroupOptions{CancelOnError: true})
+	defer wp.ReleaseGroup(g)
+	g.Go(2)
+	g.Go(1)
+	for i := 0; i < 5; i++ {
+		g.Go(3)
+	}
+
+	if _, err := g.WaitErr(context.Background(), nil); err != errFirst {
+		t.Fatalf("expect the first error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n > 2 {
+		t.Fatalf("expect queued tasks are skipped, got %d calls", n)
+	}
+}
+
+func TestGroupSetLimit(t *testing.T) {
+	var mu sync.Mutex
+	running := map[int]int{}
+	maxRunning := map[int]int{}
+	wp := New[int, int](func(r int) int {
+		mu.Lock()
+		running[r]++
+		maxRunning[r] = max(maxRunning[r], running[r])
+		mu.Unlock()
+		time.Sleep(time.Millisecond * 2)
+		mu.Lock()
+		running[r]--
+		mu.Unlock()
+		return r
+	}, &Options{WorkersLimitMax: 4, TraceScheduling: true})
+	defer wp.Close()
+
+	limited := wp.AcquireGroup()
+	defer wp.ReleaseGroup(limited)
+	limited.SetLimit(2)
+	other := wp.AcquireGroup()
+	defer wp.ReleaseGroup(other)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			limited.Go(1)
+		}()
+		go func() {
+			defer wg.Done()
+			other.Go(2)
+		}()
+	}
+	wg.Wait()
+
+	if resp := limited.Wait(context.Background(), nil); len(resp) != 10 {
+		t.Fatalf("expect 10 responses, got %d", len(resp))
+	}
+	other.Wait(context.Background(), nil)
+
+	if maxRunning[1] > 2 {
+		t.Fatalf("expect at most 2 tasks of the limited group at once, got %d", maxRunning[1])
+	}
+	if wp.SchedulingTrace()[ReasonGroupLimited] == 0 {
+		t.Fatal("expect group limited tasks")
+	}
+}
+
+func TestGroupSetCompaction(t *testing.T) {
+	wp := New[int, int](func(r int) int { return r }, nil)
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	g.SetCompaction(10, func(resps []int) []int {
+		sum := 0
+		for _, v := range resps {
+			sum += v
+		}
+		return []int{sum}
+	})
+	for i := 0; i < 100; i++ {
+		g.Go(i)
+	}
+	<-g.Done()
+
+	results := g.WaitResults(context.Background(), nil)
+	if len(results) > 11 {
+		t.Fatalf("expect compacted results, got %d", len(results))
+	}
+	sum := 0
+	for _, r := range results {
+		if r.TimedOut {
+			t.Fatalf("unexpected placeholder %+v", r)
+		}
+		sum += r.Resp
+	}
+	if sum != 4950 {
+		t.Fatalf("expect the sum 4950, got %d", sum)
+	}
+}
+
+func TestDeprecatedKinds(t *testing.T) {
+	var infos []DeprecationInfo
+	wp := New[string, string](func(r string) string { return r }, &Options{
+		DeprecatedKinds: map[string]string{"old": "use new"},
+		OnDeprecatedKind: func(info DeprecationInfo) {
+			infos = append(infos, info)
+		},
+		DeprecationInterval: time.Millisecond * 50,
+	}, &TypedOptions[string, string]{
+		KindFunc: func(r string) string { return r },
+	})
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	g.Go("old")
+	g.Go("old")
+	g.Go("new")
+	time.Sleep(time.Millisecond * 60)
+	g.Go("old")
+	g.Wait(context.Background(), nil)
+
+	if len(infos) != 2 || infos[0].Message != "use new" || infos[1].Suppressed != 1 {
+		t.Fatalf("unexpected deprecation reports %+v", infos)
+	}
+	if !strings.Contains(infos[0].Caller, "TestDeprecatedKinds") {
+		t.Fatalf("expect the test as the caller, got %q", infos[0].Caller)
+	}
+}
+
+func TestAcquireGroupContext(t *testing.T) {
+	release := make(chan struct{})
+	wp := New[int, int](func(r int) int {
+		<-release
+		return r
+	}, &Options{WorkersLimitMax: 1, MaxPendingTasks: 1})
+	defer wp.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := wp.AcquireGroupContext(ctx)
+	defer wp.ReleaseGroup(g)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			g.Go(i)
+		}
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expect Go to block on the saturated pool")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expect Go to return after the context is canceled")
+	}
+	close(release)
+
+	if err := g.Submit(4); !errors.Is(err, ErrGroupCanceled) {
+		t.Fatalf("expect ErrGroupCanceled, got %v", err)
+	}
+	if resp := g.Wait(context.Background(), nil); len(resp) != 0 {
+		t.Fatalf("expect no responses of the canceled group, got %v", resp)
+	}
+}
+
+func TestShadowSink(t *testing.T) {
+	var mu sync.Mutex
+	var copied []int
+	wp := New[int, int](func(r int) int { return r * 2 }, &Options{
+		ShadowRate: 1,
+	}, &TypedOptions[int, int]{
+		ShadowSink: func(req int, resp int, info TaskInfo) {
+			if resp != req*2 {
+				t.Errorf("expect the response of the request %d, got %d", req, resp)
+			}
+			mu.Lock()
+			copied = append(copied, req)
+			mu.Unlock()
+		},
+	})
+
+	g := wp.AcquireGroup()
+	for i := 0; i < 10; i++ {
+		g.Go(i)
+	}
+	g.Wait(context.Background(), nil)
+	wp.ReleaseGroup(g)
+	wp.Close()
+
+	// the sink is called in background, so it may be called after Close returns
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(copied)
+		mu.Unlock()
+		if n+int(wp.Stats().ShadowDropped) == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expect 10 copied tasks, got %d", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDeadlinePropagation(t *testing.T) {
+	stage2 := NewWithContext[int, time.Time](func(ctx context.Context, r int) time.Time {
+		deadline, _ := ctx.Deadline()
+		return deadline
+	}, nil)
+	defer stage2.Close()
+
+	stage1 := NewWithContext[int, time.Time](func(ctx context.Context, r int) time.Time {
+		g := stage2.AcquireGroupContext(ctx)
+		defer stage2.ReleaseGroup(g)
+		g.Go(r)
+		resp := g.Wait(context.Background(), nil)
+		if len(resp) != 1 {
+			return time.Time{}
+		}
+		return resp[0]
+	}, nil)
+	defer stage1.Close()
+
+	g := stage1.AcquireGroupWithOptions(&GroupOptions{Timeout: time.Second})
+	defer stage1.ReleaseGroup(g)
+	deadline, ok := g.Deadline()
+	if !ok {
+		t.Fatal("expect the group deadline")
+	}
+
+	g.Go(1)
+	resp := g.Wait(context.Background(), nil)
+	if len(resp) != 1 || !resp[0].Equal(deadline) {
+		t.Fatalf("expect the deadline %v in the next stage, got %v", deadline, resp)
+	}
+
+	// the exhausted budget sheds the task at the submission
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Millisecond))
+	defer cancel()
+	g2 := stage2.AcquireGroupContext(ctx)
+	defer stage2.ReleaseGroup(g2)
+	if err := g2.Submit(1); err == nil {
+		t.Fatal("expect the task with the exhausted budget to be rejected")
+	}
+}
+
+func TestDo(t *testing.T) {
+	var calls int64
+	wp := New[int, int](func(r int) int {
+		atomic.AddInt64(&calls, 1)
+		return r
+	}, &Options{WorkersLimitMax: 2})
+
+	for i := 0; i < 50; i++ {
+		if err := wp.Do(i); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	wp.Close()
+
+	if n := atomic.LoadInt64(&calls); n != 50 {
+		t.Fatalf("expect 50 calls, got %d", n)
+	}
+	if n := len(wp.doGroup.results); n != 0 {
+		t.Fatalf("expect no retained results, got %d", n)
+	}
+	if n := wp.Stats().Completed; n != 50 {
+		t.Fatalf("expect 50 completed tasks, got %d", n)
+	}
+}
+
+func TestWorkersLimitSoft(t *testing.T) {
+	release := make(chan struct{})
+	wp := New[int, int](func(r int) int {
+		<-release
+		return r
+	}, &Options{
+		WorkersLimitMax:    4,
+		WorkersLimitSoft:   1,
+		StopWorkerTimeout:  10 * time.Second,
+		BurstWorkerTimeout: 10 * time.Millisecond,
+	})
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	for i := 0; i < 4; i++ {
+		g.Go(i)
+	}
+	if n := wp.WorkersCount(); n != 4 {
+		t.Fatalf("expect 4 workers for the burst, got %d", n)
+	}
+	close(release)
+	g.Wait(context.Background(), nil)
+
+	deadline := time.Now().Add(time.Second)
+	for wp.WorkersCount() > 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect the workers count to decay to the soft limit, got %d", wp.WorkersCount())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := wp.WorkersCount(); n != 1 {
+		t.Fatalf("expect 1 worker at the soft limit, got %d", n)
+	}
+}
+
+func TestRuntimeTrace(t *testing.T) {
+	wp := New[string, string](func(r string) string { return r }, &Options{
+		Name:         "traced",
+		RuntimeTrace: true,
+	}, &TypedOptions[string, string]{
+		KindFunc: func(r string) string { return r },
+	})
+	defer wp.Close()
+
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("runtime trace is not available: %v", err)
+	}
+	g := wp.AcquireGroup()
+	g.Go("resize")
+	g.Wait(context.Background(), nil)
+	wp.ReleaseGroup(g)
+	trace.Stop()
+
+	for _, s := range []string{"wpool/traced", "resize"} {
+		if !bytes.Contains(buf.Bytes(), []byte(s)) {
+			t.Fatalf("expect %q in the trace", s)
+		}
+	}
+}
+
+func TestNewVoid(t *testing.T) {
+	var calls int64
+	wp := NewVoid[int](func(r int) {
+		atomic.AddInt64(&calls, int64(r))
+	}, nil)
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	for i := 1; i <= 10; i++ {
+		g.Go(i)
+	}
+	if err := g.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := atomic.LoadInt64(&calls); n != 55 {
+		t.Fatalf("expect the sum 55, got %d", n)
+	}
+	if n := len(g.group().results); n != 0 {
+		t.Fatalf("expect no retained results, got %d", n)
+	}
+	wp.ReleaseGroup(g)
+	if err := g.Wait(context.Background()); !errors.Is(err, ErrGroupReleased) {
+		t.Fatalf("expect ErrGroupReleased, got %v", err)
+	}
+
+	if err := wp.Do(5); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestRecentFailures(t *testing.T) {
+	wp := NewWithError[int, int](func(r int) (int, error) {
+		if r%2 == 1 {
+			return 0, fmt.Errorf("odd %d", r)
+		}
+		return r, nil
+	}, &Options{FailureHistory: 3, WorkersLimitMax: 1}, &TypedOptions[int, int]{FailureCodec: GobCodec[int]{}})
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	for i := 0; i < 10; i++ {
+		g.Go(i)
+	}
+	g.Wait(context.Background(), nil)
+
+	failures := wp.RecentFailures()
+	if len(failures) != 3 {
+		t.Fatalf("expect 3 recent failures, got %d", len(failures))
+	}
+	for i, f := range failures {
+		if want := 5 + 2*i; f.Req != want || f.Err == nil || f.Err.Error() != fmt.Sprintf("odd %d", want) {
+			t.Fatalf("expect the failure of %d, got %v %v", want, f.Req, f.Err)
+		}
+	}
+}
+
+func TestYield(t *testing.T) {
+	var short int32
+	wp := NewWithContext[int, int](func(ctx context.Context, r int) int {
+		if r == 1 {
+			atomic.StoreInt32(&short, 1)
+			return r
+		}
+		// the long task waits for the short one, which runs in the same worker inside Yield
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadInt32(&short) == 0 && time.Now().Before(deadline) {
+			if err := Yield(ctx); err != nil {
+				return -1
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return r
+	}, &Options{WorkersLimitMax: 1, YieldSlice: time.Millisecond, TraceScheduling: true})
+	defer wp.Close()
+
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	g.Go(0)
+	g.Go(1)
+	resp := g.Wait(context.Background(), nil)
+	if len(resp) != 2 || atomic.LoadInt32(&short) == 0 {
+		t.Fatalf("expect both tasks done, got %v", resp)
+	}
+	if n := wp.SchedulingTrace()[ReasonYielded]; n != 1 {
+		t.Fatalf("expect 1 yielded task, got %d", n)
+	}
+	if s := wp.Stats(); s.Completed != 2 || s.HandlerTime <= 0 {
+		t.Fatalf("expect 2 completed tasks with the handler time, got %d, %s", s.Completed, s.HandlerTime)
+	}
+
+	// Yield returns the error of the canceled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Yield(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+}
+
+func TestDedupKey(t *testing.T) {
+	var calls int64
+	started := make(chan struct{})
+	release := make(chan struct{})
+	wp := New[string, string](func(r string) string {
+		if atomic.AddInt64(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return r + "!"
+	}, nil, &TypedOptions[string, string]{DedupKey: func(r string) string { return r }})
+	defer wp.Close()
+
+	g1 := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g1)
+	g2 := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g2)
+
+	g1.Go("report")
+	<-started
+	g2.Go("report")
+	g2.Go("report")
+	close(release)
+
+	if resp := g1.Wait(context.Background(), nil); len(resp) != 1 || resp[0] != "report!" {
+		t.Fatalf("expect the response of the first group, got %v", resp)
+	}
+	if resp := g2.Wait(context.Background(), nil); len(resp) != 2 || resp[0] != "report!" || resp[1] != "report!" {
+		t.Fatalf("expect the shared responses in the second group, got %v", resp)
+	}
+	if n := atomic.LoadInt64(&calls); n != 1 {
+		t.Fatalf("expect 1 computation, got %d", n)
+	}
+	if s := g2.Stats(); s.Tasks != 2 || s.Shared != 2 {
+		t.Fatalf("expect 2 shared tasks of the second group, got %+v", s)
+	}
+	if n := wp.Stats().Deduplicated; n != 2 {
+		t.Fatalf("expect 2 deduplicated tasks, got %d", n)
+	}
+
+	// the done computation is not shared with new tasks
+	g1.Go("report")
+	g1.Wait(context.Background(), nil)
+	if n := atomic.LoadInt64(&calls); n != 2 {
+		t.Fatalf("expect 2 computations, got %d", n)
+	}
+}
+
+func TestMap(t *testing.T) {
+	wp := New[int, int](func(r int) int {
+		time.Sleep(time.Duration(10-r) * time.Millisecond)
+		return r * r
+	}, &Options{WorkersLimitMax: 4})
+	defer wp.Close()
+
+	resp := Map(context.Background(), wp, []int{1, 2, 3, 4, 5, 6, 7, 8})
+	if fmt.Sprint(resp) != "[1 4 9 16 25 36 49 64]" {
+		t.Fatalf("expect responses in the order of requests, got %v", resp)
+	}
+}
+
+func TestMapCanceled(t *testing.T) {
+	wp := New[int, int](func(r int) int {
+		time.Sleep(20 * time.Millisecond)
+		return r
+	}, &Options{WorkersLimitMax: 1})
+	defer wp.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	resp := Map(ctx, wp, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	if len(resp) != 10 || resp[9] != 0 {
+		t.Fatalf("expect zero responses of canceled tasks, got %v", resp)
+	}
+}
+
+func TestMapCoalesced(t *testing.T) {
+	wp := New[int, int](func(r int) int {
+		return r * 10
+	}, &Options{CoalesceWindow: time.Millisecond * 10}, &TypedOptions[int, int]{
+		CoalesceKey: func(r int) string {
+			if r%2 == 0 {
+				return "even"
+			}
+			return ""
+		},
+	})
+	defer wp.Close()
+
+	// the held task 2 gets its index after tasks 1 and 3, the task 4 is merged into it
+	resp := Map(context.Background(), wp, []int{2, 1, 3, 4})
+	if fmt.Sprint(resp) != "[20 10 30 20]" {
+		t.Fatalf("expect responses in the order of requests, got %v", resp)
+	}
+
+	// results report submission calls
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	reqs := []int{2, 1, 3, 4}
+	for _, r := range reqs {
+		g.Go(r)
+	}
+	for _, r := range g.WaitResults(context.Background(), nil) {
+		if r.Req != reqs[r.Call] {
+			t.Fatalf("expect the request %d of the call %d, got %d", reqs[r.Call], r.Call, r.Req)
+		}
+	}
+}
+
+func TestForEach(t *testing.T) {
+	var sum int64
+	wp := New[int, int](func(r int) int {
+		atomic.AddInt64(&sum, int64(r))
+		return r
+	}, &Options{WorkersLimitMax: 2})
+
+	if err := ForEach(context.Background(), wp, []int{1, 2, 3, 4, 5}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := atomic.LoadInt64(&sum); n != 15 {
+		t.Fatalf("expect the sum 15, got %d", n)
+	}
+
+	wp.Close()
+	if err := ForEach(context.Background(), wp, []int{1}); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expect ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestSpillover(t *testing.T) {
+	handler := func(r int) int {
+		time.Sleep(20 * time.Millisecond)
+		return r
+	}
+	burst := New[int, int](handler, nil)
+	defer burst.Close()
+
+	var done int64
+	wp := New[int, int](handler, &Options{
+		WorkersLimitMax: 1,
+		SpilloverWait:   10 * time.Millisecond,
+	}, &TypedOptions[int, int]{
+		Spillover: SpilloverPool(burst),
+		OnTaskDone: func(req int, resp int, info TaskInfo) {
+			atomic.AddInt64(&done, 1)
+		},
+	})
+	defer wp.Close()
+
+	// the queue wait is estimated by completed tasks
+	g := wp.AcquireGroup()
+	defer wp.ReleaseGroup(g)
+	g.Go(0)
+	g.Wait(context.Background(), nil)
+
+	// the first task is taken by the idle worker, the rest would wait for it
+	deadline := time.Now().Add(time.Second)
+	for wp.Stats().IdleWorkers != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expect the idle worker")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 1; i <= 4; i++ {
+		g.Go(i)
+	}
+	resp := g.Wait(context.Background(), nil)
+	if len(resp) != 4 {
+		t.Fatalf("expect 4 responses, got %v", resp)
+	}
+	if n := wp.Stats().SpilledOver; n != 3 {
+		t.Fatalf("expect 3 tasks passed to the burst pool, got %d", n)
+	}
+	if n := burst.Stats().Completed; n != 3 {
+		t.Fatalf("expect 3 tasks completed by the burst pool, got %d", n)
+	}
+	// spilled over tasks are reported to OnTaskDone like executed ones
+	if n := atomic.LoadInt64(&done); n != 5 {
+		t.Fatalf("expect 5 OnTaskDone calls, got %d", n)
+	}
+}
+
+func TestChain(t *testing.T) {
+	parse := New[string, int](func(r string) int { return len(r) }, &Options{WorkersLimitMax: 2})
+	defer parse.Close()
+
+	var running, maxRunning int64
+	square := New[int, int](func(r int) int {
+		n := atomic.AddInt64(&running, 1)
+		for {
+			m := atomic.LoadInt64(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt64(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt64(&running, -1)
+		return r * r
+	}, &Options{WorkersLimitMax: 1})
+	defer square.Close()
+
+	p := Chain(parse, square)
+	g := p.AcquireGroup()
+	defer p.ReleaseGroup(g)
+
+	for _, s := range []string{"a", "bb", "ccc", "dddd"} {
+		g.Go(s)
+	}
+	resp, err := g.WaitErr(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	sort.Ints(resp)
+	if fmt.Sprint(resp) != "[1 4 9 16]" {
+		t.Fatalf("expect responses of the second stage, got %v", resp)
+	}
+	if n := atomic.LoadInt64(&maxRunning); n != 1 {
+		t.Fatalf("expect the second stage limit, got %d running tasks", n)
+	}
+}
+
+func TestChainConcurrentHandOff(t *testing.T) {
+	first := New[int, int](func(r int) int { return r }, nil)
+	defer first.Close()
+
+	release := make(chan struct{})
+	second := New[int, int](func(r int) int {
+		<-release
+		return r
+	}, &Options{WorkersLimitMax: 1})
+	defer second.Close()
+
+	p := Chain(first, second)
+	g := p.AcquireGroup()
+	defer p.ReleaseGroup(g)
+	for i := 0; i < 3; i++ {
+		g.Go(i)
+	}
+
+	// workers of the first stage wait for the saturated second stage concurrently
+	deadline := time.Now().Add(time.Second)
+	for second.Stats().Queued != 2 {
+		if time.Now().After(deadline) {
+			close(release)
+			t.Fatalf("expect 2 hand-offs queued at once, got %d", second.Stats().Queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	if resp := g.Wait(context.Background(), nil); len(resp) != 3 {
+		t.Fatalf("expect 3 responses, got %v", resp)
+	}
+}
+
+func TestScope(t *testing.T) {
+	var running, done int64
+	wp := NewWithContext[int, int](func(ctx context.Context, r int) int {
+		atomic.AddInt64(&running, 1)
+		defer atomic.AddInt64(&running, -1)
+		if r < 0 {
+			<-ctx.Done()
+			return r
+		}
+		atomic.AddInt64(&done, 1)
+		return r
+	}, &Options{WorkersLimitMax: 2, MaxPendingTasks: 100})
+	defer wp.Close()
+
+	err := Scope(context.Background(), wp, func(s *ScopeGroup[int, int]) error {
+		for i := 0; i < 10; i++ {
+			s.Go(i)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := atomic.LoadInt64(&done); n != 10 {
+		t.Fatalf("expect 10 done tasks, got %d", n)
+	}
+
+	errFailed := errors.New("failed")
+	err = Scope(context.Background(), wp, func(s *ScopeGroup[int, int]) error {
+		for i := 0; i < 10; i++ {
+			s.Go(-1)
+		}
+		return errFailed
+	})
+	if err != errFailed {
+		t.Fatalf("expect the error of fn, got %v", err)
+	}
+	if n := atomic.LoadInt64(&running); n != 0 {
+		t.Fatalf("expect no running tasks, got %d", n)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expect the panic of fn")
+			}
+		}()
+		_ = Scope(context.Background(), wp, func(s *ScopeGroup[int, int]) error {
+			s.Go(-1)
+			s.Go(-1)
+			panic("fn")
+		})
+	}()
+	if n := atomic.LoadInt64(&running); n != 0 {
+		t.Fatalf("expect no running tasks after the panic, got %d", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// the task may observe the done context and return before the scope is canceled, so the error is not checked.
+	// The group takes the context deadline, so the scope may settle slightly before the context is done.
+	_ = Scope(ctx, wp, func(s *ScopeGroup[int, int]) error {
+		s.Go(-1)
+		return nil
+	})
+	if n := atomic.LoadInt64(&running); n != 0 {
+		t.Fatalf("expect no running tasks after the context is done, got %d", n)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expect the context is done")
+	}
+}
+
+func TestConsume(t *testing.T) {
+	wp := New[int, int](func(r int) int {
+		return r * 2
+	}, &Options{WorkersLimitMax: 2})
+	defer wp.Close()
+
+	in := make(chan int)
+	out := make(chan int)
+	go func() {
+		for i := 1; i <= 10; i++ {
+			in <- i
+		}
+		close(in)
+	}()
+	go func() {
+		if err := wp.Consume(context.Background(), in, out); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		close(out)
+	}()
+
+	var sum int
+	for resp := range out {
+		sum += resp
+	}
+	if sum != 110 {
+		t.Fatalf("expect the sum 110, got %d", sum)
+	}
+
+	// nobody receives responses, so Consume returns, when the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	in = make(chan int, 3)
+	in <- 1
+	in <- 2
+	in <- 3
+	if err := wp.Consume(ctx, in, make(chan int)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestDeadlineGroupOrder(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []int
+	p := New[int, int](func(r int) int {
+		if r == 0 {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, r)
+		mu.Unlock()
+		return r
+	}, &Options{WorkersLimitMax: 1, MaxPendingTasks: 10})
+	defer p.Close()
+
+	g := p.AcquireGroup()
+	defer p.ReleaseGroup(g)
+	g.Go(0)
+	g.Go(1)
+
+	// the group deadline does not move tasks ahead of the plain group
+	dg := p.AcquireGroupWithOptions(&GroupOptions{Timeout: time.Minute})
+	defer p.ReleaseGroup(dg)
+	dg.Go(2)
+
+	close(release)
+	g.Wait(context.Background(), nil)
+	dg.Wait(context.Background(), nil)
+	if len(order) != 3 || order[1] != 1 || order[2] != 2 {
+		t.Fatalf("expect tasks in the queue order, got %v", order)
+	}
+}
@@ -0,0 +1,212 @@
+// Package wpoolbench replays workloads against wpool configurations and baselines in real time.
+//
+// Workloads are generated by the wpoolsim package, e.g. wpoolsim.Bursty with wpoolsim.Pareto durations.
+// Unlike the simulation, the benchmark measures the real scheduler, so results depend on the hardware.
+// Compare the pool with baselines, raw goroutines and workers reading a buffered channel,
+// and check Result values in tests or CI to detect performance regressions of the scheduler.
+package wpoolbench
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/negasus/wpool"
+	"github.com/negasus/wpool/wpoolsim"
+)
+
+// Work executes the task of the duration
+type Work func(d time.Duration)
+
+// Sleep is the work of IO bound tasks
+func Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Spin is the work of CPU bound tasks, it burns CPU for the duration
+func Spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+// Target executes tasks
+type Target interface {
+	// Submit executes the task asynchronously, it may block to apply backpressure
+	Submit(task func())
+	// Close waits for all submitted tasks and releases resources
+	Close()
+}
+
+// Result is a benchmark result of the target
+type Result struct {
+	Name  string
+	Tasks int
+
+	// Elapsed is a time from the first arrival to the last completion
+	Elapsed time.Duration
+	// Throughput is a count of done tasks per second
+	Throughput float64
+
+	// Latency is a time from the task arrival to its completion, including the work
+	LatencyMean time.Duration
+	LatencyP50  time.Duration
+	LatencyP99  time.Duration
+	LatencyMax  time.Duration
+
+	// Allocs and Bytes are counts of heap allocations and allocated bytes during the run, including the workload replay
+	Allocs uint64
+	Bytes  uint64
+}
+
+// Run replays tasks against the target and returns the result. The target is closed after the run.
+func Run(name string, target Target, tasks []wpoolsim.Task, work Work) Result {
+	latencies := make([]time.Duration, len(tasks))
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	for i, task := range tasks {
+		if d := time.Until(start.Add(task.Arrival)); d > 0 {
+			time.Sleep(d)
+		}
+		arrival := start.Add(task.Arrival)
+		target.Submit(func() {
+			work(task.Duration)
+			latencies[i] = time.Since(arrival)
+		})
+	}
+	target.Close()
+	elapsed := time.Since(start)
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	r := Result{
+		Name:    name,
+		Tasks:   len(tasks),
+		Elapsed: elapsed,
+		Allocs:  after.Mallocs - before.Mallocs,
+		Bytes:   after.TotalAlloc - before.TotalAlloc,
+	}
+	if len(tasks) == 0 {
+		return r
+	}
+
+	r.Throughput = float64(len(tasks)) / elapsed.Seconds()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	r.LatencyMean = total / time.Duration(len(latencies))
+	r.LatencyP50 = percentile(latencies, 0.5)
+	r.LatencyP99 = percentile(latencies, 0.99)
+	r.LatencyMax = latencies[len(latencies)-1]
+
+	return r
+}
+
+// Compare runs tasks against every target one by one, in order of names, targets are created before the run
+func Compare(targets map[string]func() Target, tasks []wpoolsim.Task, work Work) []Result {
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make([]Result, 0, len(names))
+	for _, name := range names {
+		res = append(res, Run(name, targets[name](), tasks, work))
+	}
+	return res
+}
+
+// percentile returns the p-th percentile of the sorted values
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+type poolTarget struct {
+	wp *wpool.Pool[func(), struct{}]
+	g  *wpool.Group[func(), struct{}]
+}
+
+// Pool returns the target, which executes tasks in one group of the pool with the options
+func Pool(opts *wpool.Options) Target {
+	wp := wpool.New[func(), struct{}](func(task func()) struct{} {
+		task()
+		return struct{}{}
+	}, opts)
+	return &poolTarget{wp: wp, g: wp.AcquireGroup()}
+}
+
+func (p *poolTarget) Submit(task func()) {
+	p.g.Go(task)
+}
+
+func (p *poolTarget) Close() {
+	p.g.Wait(context.Background(), nil)
+	p.wp.ReleaseGroup(p.g)
+	p.wp.Close()
+}
+
+type goroutinesTarget struct {
+	wg sync.WaitGroup
+}
+
+// Goroutines returns the baseline target, which starts a goroutine per task
+func Goroutines() Target {
+	return &goroutinesTarget{}
+}
+
+func (t *goroutinesTarget) Submit(task func()) {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		task()
+	}()
+}
+
+func (t *goroutinesTarget) Close() {
+	t.wg.Wait()
+}
+
+type channelTarget struct {
+	ch chan func()
+	wg sync.WaitGroup
+}
+
+// Channel returns the baseline target with the fixed count of workers, reading tasks from the buffered channel
+func Channel(workers, buffer int) Target {
+	t := &channelTarget{ch: make(chan func(), buffer)}
+	t.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer t.wg.Done()
+			for task := range t.ch {
+				task()
+			}
+		}()
+	}
+	return t
+}
+
+func (t *channelTarget) Submit(task func()) {
+	t.ch <- task
+}
+
+func (t *channelTarget) Close() {
+	close(t.ch)
+	t.wg.Wait()
+}
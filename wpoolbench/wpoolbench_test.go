@@ -0,0 +1,48 @@
+package wpoolbench
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/negasus/wpool"
+	"github.com/negasus/wpool/wpoolsim"
+)
+
+func TestCompare(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tasks := wpoolsim.Bursty(200, 50, time.Millisecond*5, wpoolsim.Pareto(time.Microsecond*100, 1.5), rnd)
+
+	res := Compare(map[string]func() Target{
+		"pool": func() Target {
+			return Pool(&wpool.Options{WorkersLimitMax: 8})
+		},
+		"goroutines": Goroutines,
+		"channel": func() Target {
+			return Channel(8, 100)
+		},
+	}, tasks, Sleep)
+
+	if len(res) != 3 || res[0].Name != "channel" || res[1].Name != "goroutines" || res[2].Name != "pool" {
+		t.Fatalf("expect results in order of names, got %v", res)
+	}
+	for _, r := range res {
+		if r.Tasks != 200 || r.Throughput <= 0 || r.LatencyP50 < time.Microsecond*100 || r.LatencyMax < r.LatencyP99 {
+			t.Fatalf("unexpected result %+v", r)
+		}
+		// the last burst arrives at 15ms
+		if r.Elapsed < time.Millisecond*15 {
+			t.Fatalf("expect the workload replayed in real time, got %s", r.Elapsed)
+		}
+	}
+}
+
+func BenchmarkBursty(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	tasks := wpoolsim.Bursty(1000, 100, time.Millisecond, wpoolsim.Uniform(0, time.Microsecond*50), rnd)
+
+	for i := 0; i < b.N; i++ {
+		r := Run("pool", Pool(nil), tasks, Spin)
+		b.ReportMetric(float64(r.LatencyP99.Microseconds()), "p99-µs")
+	}
+}
@@ -0,0 +1,20 @@
+module github.com/negasus/wpool/wpoolotel
+
+go 1.23
+
+replace github.com/negasus/wpool => ../
+
+require (
+	github.com/negasus/wpool v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.32.0
+	go.opentelemetry.io/otel/sdk v1.32.0
+	go.opentelemetry.io/otel/trace v1.32.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/otel/metric v1.32.0 // indirect
+	golang.org/x/sys v0.27.0 // indirect
+)
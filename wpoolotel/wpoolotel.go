@@ -0,0 +1,61 @@
+// Package wpoolotel starts an OpenTelemetry span around each wpool handler invocation.
+//
+//	wp := wpool.NewWithContext(handler, &wpool.Options{
+//		InvokeHook: wpoolotel.Hook(otel.Tracer("app")),
+//	})
+//
+//	g.GoContext(ctx, req)
+//
+// The span is a child of the span active in the context passed to `group.GoContext`,
+// and the handler receives the context with the task span.
+package wpoolotel
+
+import (
+	"context"
+	"time"
+
+	"github.com/negasus/wpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanName is the name of task spans
+const SpanName = "wpool.task"
+
+// Hook returns the function for wpool.Options.InvokeHook, which starts the span with the tracer.
+// The pool name is the "wpool.pool" attribute of the span, other pool labels are "wpool.label.<name>" attributes.
+// The queue wait time of the first attempt is recorded as the "wpool.queued" event at the submission time.
+func Hook(tracer trace.Tracer) func(context.Context, wpool.InvokeInfo) (context.Context, func(error)) {
+	return func(ctx context.Context, info wpool.InvokeInfo) (context.Context, func(error)) {
+		attrs := make([]attribute.KeyValue, 0, 2+len(info.Labels))
+		attrs = append(attrs, attribute.Int("wpool.attempt", info.Attempt))
+		if info.Kind != "" {
+			attrs = append(attrs, attribute.String("wpool.kind", info.Kind))
+		}
+		for k, v := range info.Labels {
+			if k == "name" {
+				attrs = append(attrs, attribute.String("wpool.pool", v))
+			} else {
+				attrs = append(attrs, attribute.String("wpool.label."+k, v))
+			}
+		}
+
+		ctx, span := tracer.Start(ctx, SpanName, trace.WithAttributes(attrs...))
+
+		if info.Attempt == 1 {
+			span.AddEvent("wpool.queued",
+				trace.WithTimestamp(time.Now().Add(-info.Wait)),
+				trace.WithAttributes(attribute.Float64("wpool.queue_wait_seconds", info.Wait.Seconds())),
+			)
+		}
+
+		return ctx, func(err error) {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package wpoolotel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/negasus/wpool"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHook(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	wp := wpool.NewWithContext[int, trace.SpanContext](func(ctx context.Context, r int) trace.SpanContext {
+		return trace.SpanContextFromContext(ctx)
+	}, &wpool.Options{
+		Name:       "spans",
+		Labels:     map[string]string{"component": "tracing"},
+		InvokeHook: Hook(tracer),
+	})
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+
+	g := wp.AcquireGroup()
+	g.GoContext(ctx, 1)
+	res := g.Wait(context.Background(), nil)
+	wp.ReleaseGroup(g)
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != SpanName {
+		t.Fatalf("expect the task span and the parent span, got %v", spans)
+	}
+
+	task := spans[0]
+	if task.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expect the task span is a child of the submission span")
+	}
+	if len(res) != 1 || res[0].SpanID() != task.SpanContext().SpanID() {
+		t.Fatal("expect the handler context with the task span")
+	}
+	attrs := map[attribute.Key]string{}
+	for _, a := range task.Attributes() {
+		attrs[a.Key] = a.Value.Emit()
+	}
+	if attrs["wpool.pool"] != "spans" || attrs["wpool.label.component"] != "tracing" {
+		t.Fatalf("expect pool labels attributes, got %v", attrs)
+	}
+	if events := task.Events(); len(events) != 1 || events[0].Name != "wpool.queued" || events[0].Time.After(task.StartTime().Add(time.Millisecond)) {
+		t.Fatalf("expect the queued event, got %v", events)
+	}
+}
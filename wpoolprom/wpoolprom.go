@@ -0,0 +1,204 @@
+// Package wpoolprom exports metrics of named wpool pools to Prometheus.
+//
+//	c := wpoolprom.NewCollector("app")
+//	wp := wpool.New(handler, &wpool.Options{
+//		Name:   "images",
+//		Labels: map[string]string{"component": "thumbnails"},
+//	}, &wpool.TypedOptions[*request, *response]{
+//		OnTaskDone: wpoolprom.Observer[*request, *response](c, "images"),
+//	})
+//	c.Register(wp)
+//	prometheus.MustRegister(c)
+package wpoolprom
+
+import (
+	"errors"
+	"maps"
+	"sync"
+
+	"github.com/negasus/wpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Pool is a named pool, any *wpool.Pool implements it
+type Pool interface {
+	Name() string
+	Labels() map[string]string
+	Stats() wpool.Stats
+	Panics() map[string]int64
+}
+
+// Collector is a prometheus.Collector of pools metrics. Pools are distinguished by the "pool" label,
+// other pool labels, see wpool.Options.Labels, are constant labels of the pool metrics.
+// Prometheus requires the same label names for all series of the metric, so pools of one collector
+// should have labels with the same names.
+// Descriptors depend on registered pools, so the collector is unchecked, see prometheus.Collector.
+type Collector struct {
+	namespace string
+
+	mu    sync.RWMutex
+	pools map[string]*poolMetrics
+}
+
+// poolMetrics are metrics of the registered pool, the pool labels are constant labels of descriptors
+type poolMetrics struct {
+	pool Pool
+
+	workers     *prometheus.Desc
+	tasks       *prometheus.Desc
+	submitted   *prometheus.Desc
+	queued      *prometheus.Desc
+	queuedBytes *prometheus.Desc
+	spilled     *prometheus.Desc
+	handlerTime *prometheus.Desc
+	panics      *prometheus.Desc
+	rejections  *prometheus.Desc
+
+	duration *prometheus.HistogramVec
+	wait     prometheus.Histogram
+}
+
+// NewCollector returns the collector with the metrics namespace, e.g. the application name, it may be empty
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		namespace: namespace,
+		pools:     map[string]*poolMetrics{},
+	}
+}
+
+func newPoolMetrics(namespace string, pool Pool) *poolMetrics {
+	labels := prometheus.Labels(pool.Labels())
+	delete(labels, "name")
+	labels["pool"] = pool.Name()
+
+	desc := func(name, help string, variable ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "wpool", name), help, variable, labels)
+	}
+
+	return &poolMetrics{
+		pool: pool,
+
+		workers:     desc("workers", "Count of workers by state.", "state"),
+		tasks:       desc("tasks_total", "Count of tasks by result.", "result"),
+		submitted:   desc("tasks_submitted_total", "Count of tasks passed to the pool, including rejected."),
+		queued:      desc("queued_tasks", "Count of tasks queued in memory."),
+		queuedBytes: desc("queued_bytes", "Size of tasks queued in memory."),
+		spilled:     desc("spilled_tasks", "Count of tasks spilled to disk."),
+		handlerTime: desc("handler_seconds_total", "Cumulative handler execution time."),
+		panics:      desc("panics_total", "Count of recovered handler panics by task kind.", "kind"),
+		rejections:  desc("rejections_total", "Count of tasks rejected at submission by cause.", "cause"),
+
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "wpool",
+			Name:        "task_duration_seconds",
+			Help:        "Handler execution time of tasks by kind, summed over attempts.",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: labels,
+		}, []string{"kind"}),
+		wait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   "wpool",
+			Name:        "task_wait_seconds",
+			Help:        "Time of tasks from the submission to the first attempt.",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: maps.Clone(labels),
+		}),
+	}
+}
+
+// Register adds the pool to the collector. The pool must have the unique name, see wpool.Options.Name
+func (c *Collector) Register(pool Pool) error {
+	name := pool.Name()
+	if name == "" {
+		return errors.New("wpoolprom: pool name is empty")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.pools[name]; ok {
+		return errors.New("wpoolprom: pool " + name + " is already registered")
+	}
+	c.pools[name] = newPoolMetrics(c.namespace, pool)
+	return nil
+}
+
+// Unregister removes the pool and its metrics from the collector, e.g. after the pool shutdown
+func (c *Collector) Unregister(name string) {
+	c.mu.Lock()
+	delete(c.pools, name)
+	c.mu.Unlock()
+}
+
+// Observer returns the function for wpool.TypedOptions.OnTaskDone, which records task latency histograms of the pool.
+// Tasks done, while the pool is not registered, are not recorded.
+func Observer[Req any, Resp any](c *Collector, name string) func(Req, Resp, wpool.TaskInfo) {
+	return func(_ Req, _ Resp, info wpool.TaskInfo) {
+		c.mu.RLock()
+		m := c.pools[name]
+		c.mu.RUnlock()
+		if m == nil {
+			return
+		}
+		m.duration.WithLabelValues(info.Kind).Observe(info.Busy.Seconds())
+		m.wait.Observe(info.Wait.Seconds())
+	}
+}
+
+// Describe implements prometheus.Collector. It sends no descriptors, the collector is unchecked.
+func (c *Collector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	pools := make([]*poolMetrics, 0, len(c.pools))
+	for _, m := range c.pools {
+		pools = append(pools, m)
+	}
+	c.mu.RUnlock()
+
+	for _, m := range pools {
+		m.collect(ch)
+	}
+}
+
+func (m *poolMetrics) collect(ch chan<- prometheus.Metric) {
+	s := m.pool.Stats()
+
+	ch <- prometheus.MustNewConstMetric(m.workers, prometheus.GaugeValue, float64(s.BusyWorkers), "busy")
+	ch <- prometheus.MustNewConstMetric(m.workers, prometheus.GaugeValue, float64(s.IdleWorkers), "idle")
+	ch <- prometheus.MustNewConstMetric(m.workers, prometheus.GaugeValue, float64(s.StuckWorkers), "stuck")
+	ch <- prometheus.MustNewConstMetric(m.workers, prometheus.GaugeValue, float64(s.WarmingWorkers), "warming")
+
+	ch <- prometheus.MustNewConstMetric(m.tasks, prometheus.CounterValue, float64(s.Completed), "completed")
+	ch <- prometheus.MustNewConstMetric(m.tasks, prometheus.CounterValue, float64(s.Rejected), "rejected")
+	ch <- prometheus.MustNewConstMetric(m.tasks, prometheus.CounterValue, float64(s.Dropped), "dropped")
+	ch <- prometheus.MustNewConstMetric(m.submitted, prometheus.CounterValue, float64(s.Submitted))
+
+	ch <- prometheus.MustNewConstMetric(m.queued, prometheus.GaugeValue, float64(s.Queued))
+	ch <- prometheus.MustNewConstMetric(m.queuedBytes, prometheus.GaugeValue, float64(s.QueuedBytes))
+	ch <- prometheus.MustNewConstMetric(m.spilled, prometheus.GaugeValue, float64(s.Spilled))
+	ch <- prometheus.MustNewConstMetric(m.handlerTime, prometheus.CounterValue, s.HandlerTime.Seconds())
+
+	r := s.Rejections
+	for cause, n := range map[string]int64{
+		"saturated":    r.Saturated,
+		"rate_limited": r.RateLimited,
+		"queue_full":   r.QueueFull,
+		"deadline":     r.Deadline,
+		"canceled":     r.Canceled,
+		"closed":       r.Closed,
+		"released":     r.Released,
+		"intercepted":  r.Intercepted,
+	} {
+		ch <- prometheus.MustNewConstMetric(m.rejections, prometheus.CounterValue, float64(n), cause)
+	}
+
+	for kind, n := range m.pool.Panics() {
+		ch <- prometheus.MustNewConstMetric(m.panics, prometheus.CounterValue, float64(n), kind)
+	}
+
+	m.duration.Collect(ch)
+	m.wait.Collect(ch)
+}
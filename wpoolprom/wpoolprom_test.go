@@ -0,0 +1,75 @@
+package wpoolprom
+
+import (
+	"context"
+	"testing"
+
+	"github.com/negasus/wpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector("test")
+
+	wp := wpool.New[int, int](func(r int) int {
+		if r < 0 {
+			panic("negative")
+		}
+		return r
+	}, &wpool.Options{
+		Name:   "numbers",
+		Labels: map[string]string{"component": "math"},
+	}, &wpool.TypedOptions[int, int]{
+		OnTaskDone: Observer[int, int](c, "numbers"),
+	})
+	if err := c.Register(wp); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Register(wp); err == nil {
+		t.Fatal("expect duplicate pool error")
+	}
+
+	g := wp.AcquireGroup()
+	g.Go(1)
+	g.Go(2)
+	g.Go(-1)
+	g.Wait(context.Background(), nil)
+	wp.ReleaseGroup(g)
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]float64{}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["pool"] != "numbers" || labels["component"] != "math" {
+				t.Fatalf("expect pool labels of %s, got %v", f.GetName(), labels)
+			}
+			switch {
+			case m.GetCounter() != nil:
+				values[f.GetName()] += m.GetCounter().GetValue()
+			case m.GetHistogram() != nil:
+				values[f.GetName()] += float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	if values["test_wpool_tasks_submitted_total"] != 3 {
+		t.Fatalf("expect 3 submitted tasks, got %v", values)
+	}
+	if values["test_wpool_panics_total"] != 1 {
+		t.Fatalf("expect 1 panic, got %v", values)
+	}
+	if values["test_wpool_task_duration_seconds"] != 3 || values["test_wpool_task_wait_seconds"] != 3 {
+		t.Fatalf("expect 3 observed tasks, got %v", values)
+	}
+}
@@ -0,0 +1,115 @@
+package wpoolsim
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// DurationFunc returns a random task duration
+type DurationFunc func(rnd *rand.Rand) time.Duration
+
+// Fixed returns the same duration for every task
+func Fixed(d time.Duration) DurationFunc {
+	return func(*rand.Rand) time.Duration {
+		return d
+	}
+}
+
+// Exponential returns exponentially distributed durations with the given mean
+func Exponential(mean time.Duration) DurationFunc {
+	return func(rnd *rand.Rand) time.Duration {
+		return time.Duration(rnd.ExpFloat64() * float64(mean))
+	}
+}
+
+// Uniform returns durations uniformly distributed from min to max
+func Uniform(min, max time.Duration) DurationFunc {
+	return func(rnd *rand.Rand) time.Duration {
+		return min + time.Duration(rnd.Int63n(int64(max-min)+1))
+	}
+}
+
+// Pareto returns heavy-tail durations with the Pareto distribution, min is the scale and alpha is the shape.
+// Smaller alpha means heavier tail, e.g. alpha 1.16 gives the 80/20 rule.
+func Pareto(min time.Duration, alpha float64) DurationFunc {
+	return func(rnd *rand.Rand) time.Duration {
+		return time.Duration(float64(min) / math.Pow(1-rnd.Float64(), 1/alpha))
+	}
+}
+
+// Periodic returns n tasks arriving every interval. The rnd may be nil for non random durations, like Fixed
+func Periodic(n int, interval time.Duration, duration DurationFunc, rnd *rand.Rand) []Task {
+	tasks := make([]Task, n)
+	for i := range tasks {
+		tasks[i] = Task{
+			Arrival:  time.Duration(i) * interval,
+			Duration: duration(rnd),
+		}
+	}
+	return tasks
+}
+
+// Bursty returns n tasks arriving in bursts of the burst size every interval
+func Bursty(n, burst int, interval time.Duration, duration DurationFunc, rnd *rand.Rand) []Task {
+	tasks := make([]Task, n)
+	for i := range tasks {
+		tasks[i] = Task{
+			Arrival:  time.Duration(i/burst) * interval,
+			Duration: duration(rnd),
+		}
+	}
+	return tasks
+}
+
+// Poisson returns n tasks with Poisson arrivals, rate is a mean count of arrivals per second
+func Poisson(n int, rate float64, duration DurationFunc, rnd *rand.Rand) []Task {
+	tasks := make([]Task, n)
+	var at time.Duration
+	for i := range tasks {
+		at += time.Duration(rnd.ExpFloat64() / rate * float64(time.Second))
+		tasks[i] = Task{
+			Arrival:  at,
+			Duration: duration(rnd),
+		}
+	}
+	return tasks
+}
+
+// ReadCSV reads a recorded workload. Every record has two fields, the arrival time and the duration,
+// in the time.ParseDuration format, e.g. "1.5s,20ms". Records are sorted by the arrival time.
+func ReadCSV(r io.Reader) ([]Task, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+
+	var tasks []Task
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		arrival, err := time.ParseDuration(rec[0])
+		if err != nil {
+			return nil, fmt.Errorf("parse arrival at record %d: %w", len(tasks)+1, err)
+		}
+		duration, err := time.ParseDuration(rec[1])
+		if err != nil {
+			return nil, fmt.Errorf("parse duration at record %d: %w", len(tasks)+1, err)
+		}
+
+		tasks = append(tasks, Task{Arrival: arrival, Duration: duration})
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].Arrival < tasks[j].Arrival })
+
+	return tasks, nil
+}
@@ -0,0 +1,330 @@
+// Package wpoolsim replays a workload against a wpool configuration in virtual time.
+//
+// The simulation follows the pool scheduling rules: a task is passed to the most recently used idle worker,
+// or a new worker is started while the workers max limit is not reached, otherwise the task waits in the queue.
+// Idle workers over the min limit stop after the StopWorkerTimeout.
+// It allows to tune pool options offline, without running the real workload.
+package wpoolsim
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+)
+
+// Task is a simulated task
+type Task struct {
+	// Arrival is a task submission time, relative to the simulation start
+	Arrival time.Duration
+	// Duration is a task handler execution time
+	Duration time.Duration
+}
+
+// Config is a simulated pool configuration. It covers the workers limits and the idle timeout of wpool.Options only:
+// the saturation policy is always blocking, the queue is unbounded, and priorities, soft limits, spinning
+// and other options are not simulated.
+type Config struct {
+	// WorkersLimitMax is a maximum workers count, default 0 (unlimited)
+	WorkersLimitMax int
+
+	// WorkersLimitMin is a minimum workers count, default 0. Unlike the pool, which starts workers on demand,
+	// the simulation starts min workers at the beginning.
+	WorkersLimitMin int
+
+	// StopWorkerTimeout is an idle timeout, after which the worker over WorkersLimitMin stops, default 5 seconds
+	StopWorkerTimeout time.Duration
+}
+
+// Report is a simulation result
+type Report struct {
+	// Tasks is a count of simulated tasks
+	Tasks int
+
+	// WaitMean, WaitP50, WaitP99 and WaitMax are queue wait time statistics
+	WaitMean time.Duration
+	WaitP50  time.Duration
+	WaitP99  time.Duration
+	WaitMax  time.Duration
+
+	// LatencyP50, LatencyP99 and LatencyMax are statistics of the time from the task arrival to its completion
+	LatencyP50 time.Duration
+	LatencyP99 time.Duration
+	LatencyMax time.Duration
+
+	// WorkersMax is a maximum workers count
+	WorkersMax int
+	// WorkersMean is a time weighted mean workers count until the Makespan
+	WorkersMean float64
+	// Utilization is a fraction of the workers time spent executing tasks until the Makespan,
+	// idle workers waiting for the timeout after the last task are not counted
+	Utilization float64
+
+	// Spawned is a count of started workers, including min workers
+	Spawned int
+	// Stopped is a count of workers stopped by the timeout
+	Stopped int
+
+	// Makespan is a time of the last task completion
+	Makespan time.Duration
+}
+
+const defaultStopWorkerTimeout = time.Second * 5
+
+type eventKind int
+
+const (
+	eventDone eventKind = iota // completion goes first, so the freed worker can take the task arrived at the same time
+	eventArrival
+	eventTimeout
+)
+
+type event struct {
+	at     time.Duration
+	kind   eventKind
+	seq    int
+	task   int
+	worker *worker
+	gen    int
+}
+
+type events []*event
+
+func (e events) Len() int { return len(e) }
+func (e events) Less(i, j int) bool {
+	if e[i].at != e[j].at {
+		return e[i].at < e[j].at
+	}
+	if e[i].kind != e[j].kind {
+		return e[i].kind < e[j].kind
+	}
+	return e[i].seq < e[j].seq
+}
+func (e events) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e *events) Push(x any)   { *e = append(*e, x.(*event)) }
+func (e *events) Pop() any {
+	old := *e
+	n := len(old)
+	v := old[n-1]
+	old[n-1] = nil
+	*e = old[:n-1]
+	return v
+}
+
+type worker struct {
+	// gen is incremented every time the worker becomes idle, to skip outdated timeout events
+	gen int
+}
+
+type simulation struct {
+	cfg   Config
+	tasks []Task
+
+	now    time.Duration
+	seq    int
+	events events
+
+	idle     []*worker
+	queue    []int
+	workers  int
+	arrivals int
+
+	waits     []time.Duration
+	latencies []time.Duration
+
+	workersArea float64 // workers count integrated over time
+	busyArea    float64 // busy workers count integrated over time
+	busy        int
+	lastAt      time.Duration
+
+	// areas at the last task completion, the idle tail after it is not reported
+	doneWorkersArea float64
+	doneBusyArea    float64
+
+	report Report
+}
+
+// Run simulates the workload with the pool configuration and returns the report
+func Run(cfg Config, tasks []Task) Report {
+	if cfg.StopWorkerTimeout <= 0 {
+		cfg.StopWorkerTimeout = defaultStopWorkerTimeout
+	}
+
+	s := &simulation{
+		cfg:       cfg,
+		tasks:     tasks,
+		waits:     make([]time.Duration, len(tasks)),
+		latencies: make([]time.Duration, len(tasks)),
+	}
+
+	for i := 0; i < cfg.WorkersLimitMin; i++ {
+		s.park(s.spawn())
+	}
+
+	for i, t := range tasks {
+		s.push(&event{at: t.Arrival, kind: eventArrival, task: i})
+	}
+
+	for s.events.Len() > 0 {
+		e := heap.Pop(&s.events).(*event)
+		s.advance(e.at)
+
+		switch e.kind {
+		case eventArrival:
+			s.arrival(e.task)
+		case eventDone:
+			s.doneWorkersArea, s.doneBusyArea = s.workersArea, s.busyArea
+			s.done(e.worker)
+		case eventTimeout:
+			s.timeout(e)
+		}
+	}
+
+	return s.buildReport()
+}
+
+func (s *simulation) push(e *event) {
+	s.seq++
+	e.seq = s.seq
+	heap.Push(&s.events, e)
+}
+
+func (s *simulation) advance(at time.Duration) {
+	d := float64(at - s.lastAt)
+	s.workersArea += d * float64(s.workers)
+	s.busyArea += d * float64(s.busy)
+	s.lastAt = at
+	s.now = at
+}
+
+func (s *simulation) spawn() *worker {
+	s.workers++
+	s.report.Spawned++
+	if s.workers > s.report.WorkersMax {
+		s.report.WorkersMax = s.workers
+	}
+	return &worker{}
+}
+
+func (s *simulation) arrival(task int) {
+	s.arrivals++
+
+	if n := len(s.idle); n > 0 {
+		w := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.start(w, task)
+		return
+	}
+
+	if s.cfg.WorkersLimitMax <= 0 || s.workers < s.cfg.WorkersLimitMax {
+		s.start(s.spawn(), task)
+		return
+	}
+
+	s.queue = append(s.queue, task)
+}
+
+func (s *simulation) start(w *worker, task int) {
+	t := s.tasks[task]
+	wait := s.now - t.Arrival
+	s.waits[task] = wait
+	s.latencies[task] = wait + t.Duration
+	s.busy++
+
+	if end := s.now + t.Duration; end > s.report.Makespan {
+		s.report.Makespan = end
+	}
+
+	s.push(&event{at: s.now + t.Duration, kind: eventDone, worker: w})
+}
+
+func (s *simulation) done(w *worker) {
+	s.busy--
+
+	if len(s.queue) > 0 {
+		task := s.queue[0]
+		s.queue = s.queue[1:]
+		s.start(w, task)
+		return
+	}
+
+	s.park(w)
+}
+
+// park puts the worker to the idle list and schedules its timeout
+func (s *simulation) park(w *worker) {
+	w.gen++
+	s.idle = append(s.idle, w)
+	s.push(&event{at: s.now + s.cfg.StopWorkerTimeout, kind: eventTimeout, worker: w, gen: w.gen})
+}
+
+func (s *simulation) timeout(e *event) {
+	w := e.worker
+	if w.gen != e.gen {
+		// the worker was busy after the timeout was scheduled
+		return
+	}
+
+	if s.workers <= s.cfg.WorkersLimitMin {
+		// keep the worker, but stop scheduling timeouts after the last task, the simulation would never end
+		if s.arrivals == len(s.tasks) && s.busy == 0 {
+			return
+		}
+		s.push(&event{at: s.now + s.cfg.StopWorkerTimeout, kind: eventTimeout, worker: w, gen: w.gen})
+		return
+	}
+
+	for i, v := range s.idle {
+		if v == w {
+			s.idle = append(s.idle[:i], s.idle[i+1:]...)
+			s.workers--
+			s.report.Stopped++
+			return
+		}
+	}
+}
+
+func (s *simulation) buildReport() Report {
+	r := s.report
+	r.Tasks = len(s.tasks)
+
+	if r.Tasks == 0 {
+		return r
+	}
+
+	var total time.Duration
+	for _, w := range s.waits {
+		total += w
+	}
+	r.WaitMean = total / time.Duration(r.Tasks)
+
+	sort.Slice(s.waits, func(i, j int) bool { return s.waits[i] < s.waits[j] })
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+
+	r.WaitP50 = percentile(s.waits, 0.5)
+	r.WaitP99 = percentile(s.waits, 0.99)
+	r.WaitMax = s.waits[len(s.waits)-1]
+	r.LatencyP50 = percentile(s.latencies, 0.5)
+	r.LatencyP99 = percentile(s.latencies, 0.99)
+	r.LatencyMax = s.latencies[len(s.latencies)-1]
+
+	if r.Makespan > 0 {
+		r.WorkersMean = s.doneWorkersArea / float64(r.Makespan)
+	}
+	if s.doneWorkersArea > 0 {
+		r.Utilization = s.doneBusyArea / s.doneWorkersArea
+	}
+
+	return r
+}
+
+// percentile returns the p-th percentile of the sorted values
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
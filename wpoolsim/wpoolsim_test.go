@@ -0,0 +1,113 @@
+package wpoolsim
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnlimited(t *testing.T) {
+	tasks := Periodic(100, time.Millisecond, Fixed(time.Millisecond*10), nil)
+
+	r := Run(Config{}, tasks)
+
+	if r.Tasks != 100 {
+		t.Fatalf("expect 100 tasks, got %d", r.Tasks)
+	}
+	if r.WaitMax != 0 {
+		t.Fatalf("expect no waits, got %s", r.WaitMax)
+	}
+	if r.WorkersMax != 10 {
+		t.Fatalf("expect 10 workers max, got %d", r.WorkersMax)
+	}
+	if r.Stopped != r.Spawned {
+		t.Fatalf("all workers must be stopped, spawned %d, stopped %d", r.Spawned, r.Stopped)
+	}
+}
+
+func TestMaxLimit(t *testing.T) {
+	tasks := Periodic(10, 0, Fixed(time.Millisecond*10), nil)
+
+	r := Run(Config{WorkersLimitMax: 2}, tasks)
+
+	if r.WorkersMax != 2 {
+		t.Fatalf("expect 2 workers max, got %d", r.WorkersMax)
+	}
+	if r.WaitMax != time.Millisecond*40 {
+		t.Fatalf("expect 40ms max wait, got %s", r.WaitMax)
+	}
+	if r.Makespan != time.Millisecond*50 {
+		t.Fatalf("expect 50ms makespan, got %s", r.Makespan)
+	}
+}
+
+func TestMinWorkers(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tasks := Poisson(1000, 100, Exponential(time.Millisecond*5), rnd)
+
+	r := Run(Config{WorkersLimitMin: 4, StopWorkerTimeout: time.Millisecond * 100}, tasks)
+
+	if r.Spawned-r.Stopped != 4 {
+		t.Fatalf("expect 4 workers left, spawned %d, stopped %d", r.Spawned, r.Stopped)
+	}
+	if r.Utilization <= 0 || r.Utilization > 1 {
+		t.Fatalf("unexpected utilization %f", r.Utilization)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	tasks, err := ReadCSV(strings.NewReader("20ms, 5ms\n0s, 10ms\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("expect 2 tasks, got %d", len(tasks))
+	}
+	if tasks[0].Arrival != 0 || tasks[0].Duration != time.Millisecond*10 {
+		t.Fatalf("unexpected first task %+v", tasks[0])
+	}
+}
+
+func TestWorkloads(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	tasks := Bursty(10, 4, time.Second, Uniform(time.Millisecond, time.Millisecond*2), rnd)
+	if tasks[3].Arrival != 0 || tasks[4].Arrival != time.Second || tasks[9].Arrival != time.Second*2 {
+		t.Fatalf("unexpected arrivals %v", tasks)
+	}
+	for _, task := range tasks {
+		if task.Duration < time.Millisecond || task.Duration > time.Millisecond*2 {
+			t.Fatalf("expect uniform durations from 1ms to 2ms, got %s", task.Duration)
+		}
+	}
+
+	pareto := Pareto(time.Millisecond, 1.16)
+	var max time.Duration
+	for i := 0; i < 1000; i++ {
+		d := pareto(rnd)
+		if d < time.Millisecond {
+			t.Fatalf("expect durations from 1ms, got %s", d)
+		}
+		if d > max {
+			max = d
+		}
+	}
+	if max < time.Millisecond*100 {
+		t.Fatalf("expect heavy tail, got max %s", max)
+	}
+}
+
+func TestUtilization(t *testing.T) {
+	tasks := Periodic(1000, time.Millisecond, Fixed(time.Millisecond*10), nil)
+
+	// the idle tail of workers waiting for the timeout after the last task is not counted
+	r := Run(Config{StopWorkerTimeout: time.Second}, tasks)
+
+	if r.Utilization < 0.9 {
+		t.Fatalf("expect utilization over 0.9, got %f", r.Utilization)
+	}
+	if r.WorkersMean < 9 || r.WorkersMean > 10 {
+		t.Fatalf("expect about 10 workers in mean, got %f", r.WorkersMean)
+	}
+}
@@ -0,0 +1,237 @@
+package wpoolsock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/negasus/wpool"
+)
+
+// ErrClientClosed is returned, if the connection to the server is closed
+var ErrClientClosed = errors.New("wpoolsock: client is closed")
+
+// Client submits tasks to the pool served by Serve
+type Client[Req any, Resp any] struct {
+	conn net.Conn
+	req  wpool.Codec[Req]
+	resp wpool.Codec[Resp]
+
+	wmu sync.Mutex
+
+	mu        sync.Mutex
+	groups    map[uint64]*Group[Req, Resp]
+	nextGroup uint64
+	err       error         // the connection error, guarded by mu
+	closed    chan struct{} // closed when the connection is closed
+}
+
+// Dial connects to the server at the Unix socket path
+func Dial[Req any, Resp any](ctx context.Context, path string, req wpool.Codec[Req], resp wpool.Codec[Resp]) (*Client[Req, Resp], error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn, req, resp), nil
+}
+
+// NewClient creates the client over the established connection to the server
+func NewClient[Req any, Resp any](conn net.Conn, req wpool.Codec[Req], resp wpool.Codec[Resp]) *Client[Req, Resp] {
+	c := &Client[Req, Resp]{
+		conn:   conn,
+		req:    req,
+		resp:   resp,
+		groups: map[uint64]*Group[Req, Resp]{},
+		closed: make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+// Close closes the connection, the server releases groups of the client
+func (c *Client[Req, Resp]) Close() error {
+	return c.conn.Close()
+}
+
+// AcquireGroup acquires the new remote group. You should call ReleaseGroup after `group.Wait` is done.
+func (c *Client[Req, Resp]) AcquireGroup() *Group[Req, Resp] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextGroup++
+	g := &Group[Req, Resp]{client: c, id: c.nextGroup}
+	c.groups[g.id] = g
+	return g
+}
+
+// ReleaseGroup releases the remote group. You must not use the group after calling ReleaseGroup.
+func (c *Client[Req, Resp]) ReleaseGroup(g *Group[Req, Resp]) {
+	c.mu.Lock()
+	delete(c.groups, g.id)
+	c.mu.Unlock()
+	_ = c.write(frame{typ: msgRelease, group: g.id})
+}
+
+// read dispatches frames of the server to groups until the connection is closed
+func (c *Client[Req, Resp]) read() {
+	r := bufio.NewReader(c.conn)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			close(c.closed)
+			return
+		}
+
+		c.mu.Lock()
+		g := c.groups[f.group]
+		c.mu.Unlock()
+		if g != nil {
+			g.receive(f)
+		}
+	}
+}
+
+func (c *Client[Req, Resp]) write(f frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := writeFrame(c.conn, f); err != nil {
+		return errors.Join(ErrClientClosed, err)
+	}
+	return nil
+}
+
+// closeErr returns the error of the closed connection
+func (c *Client[Req, Resp]) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return errors.Join(ErrClientClosed, c.err)
+}
+
+// Group is a remote group of tasks, see wpool.Group.
+// Go and Submit are safe for concurrent use, Wait calls must not be concurrent.
+type Group[Req any, Resp any] struct {
+	client   *Client[Req, Resp]
+	id       uint64
+	nextTask uint64
+
+	mu      sync.Mutex
+	results []remoteResult[Resp]
+	waiting bool          // the server waits for the group tasks
+	done    chan struct{} // closed when the server wait is done
+}
+
+type remoteResult[Resp any] struct {
+	resp    Resp
+	err     error
+	dropped bool
+}
+
+// Go submits the task to the remote group. Use Submit to get the connection error.
+func (g *Group[Req, Resp]) Go(req Req) {
+	_ = g.Submit(req)
+}
+
+// Submit submits the task to the remote group. It returns the encoding or the connection error only,
+// errors of the server, e.g. wpool.ErrPoolClosed, are returned by WaitErr as RemoteError.
+// The task is submitted by the server in background, so Submit does not block, if the pool is saturated.
+func (g *Group[Req, Resp]) Submit(req Req) error {
+	p, err := g.client.req.Encode(req)
+	if err != nil {
+		return err
+	}
+	return g.client.write(frame{typ: msgSubmit, group: g.id, task: atomic.AddUint64(&g.nextTask, 1), payload: p})
+}
+
+// Wait waits for all submitted tasks to be done or context is done, like wpool.Group.Wait.
+// If the context is done, results of remaining tasks are received by the next Wait call.
+func (g *Group[Req, Resp]) Wait(ctx context.Context, dest []Resp) []Resp {
+	results, _ := g.wait(ctx)
+	for _, r := range results {
+		if r.err == nil && !r.dropped {
+			dest = append(dest, r.resp)
+		}
+	}
+	return dest
+}
+
+// WaitErr waits like Wait, but returns responses of succeeded tasks only and errors of failed tasks
+// joined with errors.Join, including the context and the connection errors.
+func (g *Group[Req, Resp]) WaitErr(ctx context.Context, dest []Resp) ([]Resp, error) {
+	results, err := g.wait(ctx)
+	errs := []error{err}
+	for _, r := range results {
+		switch {
+		case r.err != nil:
+			errs = append(errs, r.err)
+		case !r.dropped:
+			dest = append(dest, r.resp)
+		}
+	}
+	return dest, errors.Join(errs...)
+}
+
+func (g *Group[Req, Resp]) wait(ctx context.Context) ([]remoteResult[Resp], error) {
+	g.mu.Lock()
+	if !g.waiting {
+		g.waiting = true
+		g.done = make(chan struct{})
+		if err := g.client.write(frame{typ: msgWait, group: g.id}); err != nil {
+			g.waiting = false
+			g.mu.Unlock()
+			return nil, err
+		}
+	}
+	done := g.done
+	g.mu.Unlock()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-g.client.closed:
+		err = g.client.closeErr()
+	}
+
+	g.mu.Lock()
+	results := g.results
+	g.results = nil
+	g.mu.Unlock()
+
+	return results, err
+}
+
+// receive handles the frame of the server
+func (g *Group[Req, Resp]) receive(f frame) {
+	var r remoteResult[Resp]
+	switch f.typ {
+	case msgResult:
+		resp, err := g.client.resp.Decode(f.payload)
+		r = remoteResult[Resp]{resp: resp, err: err}
+	case msgError:
+		r.err = decodeError(f.payload)
+	case msgDropped:
+		r.dropped = true
+	case msgDone:
+		g.mu.Lock()
+		if g.waiting {
+			g.waiting = false
+			close(g.done)
+		}
+		g.mu.Unlock()
+		return
+	default:
+		return
+	}
+
+	g.mu.Lock()
+	g.results = append(g.results, r)
+	g.mu.Unlock()
+}
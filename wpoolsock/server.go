@@ -0,0 +1,219 @@
+package wpoolsock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/negasus/wpool"
+)
+
+// Serve accepts connections on the listener and executes tasks of the clients in the pool,
+// every remote group is served by its own group of the pool. It returns nil, when the listener is closed.
+// Requests and responses are encoded with the codecs, e.g. wpool.GobCodec.
+func Serve[Req any, Resp any](ln net.Listener, pool *wpool.Pool[Req, Resp], req wpool.Codec[Req], resp wpool.Codec[Resp]) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		sc := &serverConn[Req, Resp]{
+			conn:   conn,
+			pool:   pool,
+			req:    req,
+			resp:   resp,
+			groups: map[uint64]*serverGroup[Req, Resp]{},
+		}
+		go sc.serve()
+	}
+}
+
+type serverConn[Req any, Resp any] struct {
+	conn net.Conn
+	pool *wpool.Pool[Req, Resp]
+	req  wpool.Codec[Req]
+	resp wpool.Codec[Resp]
+
+	// ctx is canceled, when the connection is closed, groups of the client are bound to it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wmu    sync.Mutex
+	groups map[uint64]*serverGroup[Req, Resp] // used by the serve goroutine only
+}
+
+// serverGroup is the remote group served by its own goroutine, so a blocked submission, e.g. with
+// wpool.SaturationBlock, does not stall frames of other groups of the connection
+type serverGroup[Req any, Resp any] struct {
+	id uint64
+	g  *wpool.Group[Req, Resp]
+
+	mu     sync.Mutex
+	ids    []uint64      // client task ids by the submission call in the group, see wpool.Result.Call
+	frames []frame       // frames of the group waiting for the group goroutine
+	wake   chan struct{} // notifies the group goroutine about new frames
+}
+
+// serve reads frames of the client until the connection is closed, then cancels groups of the client
+func (c *serverConn[Req, Resp]) serve() {
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	defer func() {
+		c.cancel()
+		c.conn.Close()
+	}()
+
+	r := bufio.NewReader(c.conn)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			return
+		}
+
+		sg := c.groups[f.group]
+		switch f.typ {
+		case msgSubmit:
+			if sg == nil {
+				sg = &serverGroup[Req, Resp]{
+					id:   f.group,
+					g:    c.pool.AcquireGroupContext(c.ctx),
+					wake: make(chan struct{}, 1),
+				}
+				c.groups[f.group] = sg
+				go c.run(sg)
+			}
+			sg.push(f)
+		case msgWait:
+			if sg != nil {
+				sg.push(f)
+			} else {
+				c.write(frame{typ: msgDone, group: f.group})
+			}
+		case msgRelease:
+			if sg != nil {
+				delete(c.groups, f.group)
+				sg.push(f)
+			}
+		}
+	}
+}
+
+// push passes the frame to the group goroutine
+func (sg *serverGroup[Req, Resp]) push(f frame) {
+	sg.mu.Lock()
+	sg.frames = append(sg.frames, f)
+	sg.mu.Unlock()
+
+	select {
+	case sg.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the next frame of the group, false if the connection is closed
+func (c *serverConn[Req, Resp]) next(sg *serverGroup[Req, Resp]) (frame, bool) {
+	for {
+		sg.mu.Lock()
+		if len(sg.frames) > 0 {
+			f := sg.frames[0]
+			sg.frames[0] = frame{}
+			sg.frames = sg.frames[1:]
+			sg.mu.Unlock()
+			return f, true
+		}
+		sg.mu.Unlock()
+
+		select {
+		case <-sg.wake:
+		case <-c.ctx.Done():
+			return frame{}, false
+		}
+	}
+}
+
+// run handles frames of the group in order until the group is released or the connection is closed
+func (c *serverConn[Req, Resp]) run(sg *serverGroup[Req, Resp]) {
+	defer c.pool.ReleaseGroup(sg.g)
+
+	for {
+		f, ok := c.next(sg)
+		if !ok {
+			return
+		}
+		switch f.typ {
+		case msgSubmit:
+			c.submit(sg, f)
+		case msgWait:
+			go c.wait(sg)
+		case msgRelease:
+			return
+		}
+	}
+}
+
+// submit submits the task to the group.
+// Tasks are submitted one by one, so submission calls in the group follow the order of client task ids.
+func (c *serverConn[Req, Resp]) submit(sg *serverGroup[Req, Resp], f frame) {
+	req, err := c.req.Decode(f.payload)
+	if err != nil {
+		c.write(frame{typ: msgError, group: f.group, task: f.task, payload: encodeError(err)})
+		return
+	}
+
+	// the id is added before the submission, the task may be done before Submit returns.
+	// The rejected call is counted by the group too, so its id is kept.
+	sg.mu.Lock()
+	sg.ids = append(sg.ids, f.task)
+	sg.mu.Unlock()
+
+	if err := sg.g.Submit(req); err != nil {
+		c.write(frame{typ: msgError, group: f.group, task: f.task, payload: encodeError(err)})
+	}
+}
+
+// wait sends results of the group tasks, when all of them are done or the connection is closed
+func (c *serverConn[Req, Resp]) wait(sg *serverGroup[Req, Resp]) {
+	id := sg.id
+	results := sg.g.WaitResults(c.ctx, nil)
+	if c.ctx.Err() != nil {
+		return
+	}
+
+	for _, r := range results {
+		if r.TimedOut {
+			continue
+		}
+		sg.mu.Lock()
+		task := sg.ids[r.Call]
+		sg.mu.Unlock()
+
+		f := frame{typ: msgResult, group: id, task: task}
+		switch {
+		case r.Dropped:
+			f.typ = msgDropped
+		case r.Err != nil:
+			f.typ, f.payload = msgError, encodeError(r.Err)
+		default:
+			p, err := c.resp.Encode(r.Resp)
+			if err != nil {
+				f.typ, p = msgError, encodeError(err)
+			}
+			f.payload = p
+		}
+		if c.write(f) != nil {
+			return
+		}
+	}
+
+	c.write(frame{typ: msgDone, group: id})
+}
+
+func (c *serverConn[Req, Resp]) write(f frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return writeFrame(c.conn, f)
+}
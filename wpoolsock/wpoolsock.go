@@ -0,0 +1,157 @@
+// Package wpoolsock serves a wpool pool to other processes over a Unix domain socket.
+//
+// A long-lived worker daemon serves its pool with Serve, sidecar processes connect with Dial and submit
+// encoded tasks to remote groups with the same semantics as local groups: Go submits a task, Wait waits
+// for all submitted tasks and returns their responses. The daemon keeps its workers and their caches warm,
+// and with socket activation, see Listen, the socket survives restarts of the daemon across deployments.
+package wpoolsock
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/negasus/wpool"
+)
+
+// msgType is a type of the protocol frame
+type msgType uint8
+
+const (
+	msgSubmit  msgType = iota + 1 // client: submit the task to the group
+	msgWait                       // client: wait for the group tasks
+	msgRelease                    // client: release the group
+	msgResult                     // server: the task response
+	msgError                      // server: the task error, or the submission rejection
+	msgDropped                    // server: the task is dropped without execution
+	msgDone                       // server: all tasks of the group are done
+)
+
+// headerSize is a size of the frame header: the length of the rest of the frame, the type, the group and the task
+const headerSize = 4 + 1 + 8 + 8
+
+// maxFrameSize limits the size of frames read from the peer
+const maxFrameSize = 64 << 20
+
+var errFrameSize = errors.New("wpoolsock: invalid frame size")
+
+type frame struct {
+	typ     msgType
+	group   uint64
+	task    uint64
+	payload []byte
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	buf := make([]byte, headerSize+len(f.payload))
+	binary.BigEndian.PutUint32(buf, uint32(headerSize-4+len(f.payload)))
+	buf[4] = byte(f.typ)
+	binary.BigEndian.PutUint64(buf[5:], f.group)
+	binary.BigEndian.PutUint64(buf[13:], f.task)
+	copy(buf[headerSize:], f.payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	var hdr [headerSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return frame{}, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:4])
+	if n < headerSize-4 || n > maxFrameSize {
+		return frame{}, errFrameSize
+	}
+	f := frame{
+		typ:   msgType(hdr[4]),
+		group: binary.BigEndian.Uint64(hdr[5:]),
+		task:  binary.BigEndian.Uint64(hdr[13:]),
+	}
+	if size := int(n) - (headerSize - 4); size > 0 {
+		f.payload = make([]byte, size)
+		if _, err := io.ReadFull(r, f.payload); err != nil {
+			return frame{}, err
+		}
+	}
+	return f, nil
+}
+
+// knownErrors are passed by their codes, so the client can match them with errors.Is
+var knownErrors = []error{
+	nil,
+	wpool.ErrSaturated,
+	wpool.ErrQueueFull,
+	wpool.ErrPoolClosed,
+	wpool.ErrGroupCanceled,
+	wpool.ErrDeadlineExceeded,
+	wpool.ErrGroupReleased,
+	wpool.ErrGroupExpired,
+	wpool.ErrTaskTimeout,
+}
+
+// RemoteError is the error of the remote task: the handler error or the submission rejection.
+// It unwraps to the wpool error, e.g. wpool.ErrPoolClosed, if the server rejected the task with it.
+type RemoteError struct {
+	// Msg is the error text
+	Msg string
+
+	err error
+}
+
+func (e *RemoteError) Error() string {
+	return e.Msg
+}
+
+func (e *RemoteError) Unwrap() error {
+	return e.err
+}
+
+func encodeError(err error) []byte {
+	code := 0
+	for i := 1; i < len(knownErrors); i++ {
+		if errors.Is(err, knownErrors[i]) {
+			code = i
+			break
+		}
+	}
+	return append([]byte{byte(code)}, err.Error()...)
+}
+
+func decodeError(p []byte) error {
+	if len(p) == 0 {
+		return &RemoteError{Msg: "wpoolsock: unknown error"}
+	}
+	e := &RemoteError{Msg: string(p[1:])}
+	if code := int(p[0]); code < len(knownErrors) {
+		e.err = knownErrors[code]
+	}
+	return e
+}
+
+// listenFdsStart is the first file descriptor passed with socket activation, see sd_listen_fds(3)
+const listenFdsStart = 3
+
+// Listen returns the listener passed by the service manager with socket activation, see sd_listen_fds(3),
+// or listens on the Unix socket at the path, if the process is not socket activated.
+// With socket activation, the service manager keeps the socket while the daemon restarts,
+// so clients are not disconnected from the socket path across deployments.
+func Listen(path string) (net.Listener, error) {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	fds, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if pid != os.Getpid() || fds < 1 {
+		return net.Listen("unix", path)
+	}
+
+	// the variables are not inherited by child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(listenFdsStart, "wpoolsock")
+	defer f.Close()
+	return net.FileListener(f)
+}
@@ -0,0 +1,156 @@
+package wpoolsock
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/negasus/wpool"
+)
+
+func TestServe(t *testing.T) {
+	errNegative := errors.New("negative")
+
+	pool := wpool.NewWithError[int, int](func(r int) (int, error) {
+		if r < 0 {
+			return 0, errNegative
+		}
+		time.Sleep(time.Millisecond)
+		return r * 2, nil
+	}, nil)
+
+	ln, err := Listen(filepath.Join(t.TempDir(), "wpool.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve[int, int](ln, pool, wpool.GobCodec[int]{}, wpool.GobCodec[int]{})
+	}()
+
+	client, err := Dial[int, int](context.Background(), ln.Addr().String(), wpool.GobCodec[int]{}, wpool.GobCodec[int]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	g := client.AcquireGroup()
+	for i := 1; i <= 10; i++ {
+		g.Go(i)
+	}
+	g.Go(-1)
+
+	resp, err := g.WaitErr(context.Background(), nil)
+	sort.Ints(resp)
+	var re *RemoteError
+	if len(resp) != 10 || resp[0] != 2 || resp[9] != 20 || !errors.As(err, &re) || re.Msg != "negative" {
+		t.Fatalf("unexpected responses %v, error %v", resp, err)
+	}
+
+	// the group is reused for the next tasks
+	g.Go(100)
+	if resp := g.Wait(context.Background(), nil); len(resp) != 1 || resp[0] != 200 {
+		t.Fatalf("unexpected responses %v", resp)
+	}
+	client.ReleaseGroup(g)
+
+	// server errors are matched with errors.Is
+	pool.Close()
+	g = client.AcquireGroup()
+	g.Go(1)
+	if _, err := g.WaitErr(context.Background(), nil); !errors.Is(err, wpool.ErrPoolClosed) {
+		t.Fatalf("expect ErrPoolClosed, got %v", err)
+	}
+
+	ln.Close()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitContext(t *testing.T) {
+	release := make(chan struct{})
+	pool := wpool.New[int, int](func(r int) int {
+		<-release
+		return r
+	}, nil)
+	defer pool.Close()
+
+	ln, err := Listen(filepath.Join(t.TempDir(), "wpool.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go Serve[int, int](ln, pool, wpool.GobCodec[int]{}, wpool.GobCodec[int]{})
+
+	client, err := Dial[int, int](context.Background(), ln.Addr().String(), wpool.GobCodec[int]{}, wpool.GobCodec[int]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	g := client.AcquireGroup()
+	defer client.ReleaseGroup(g)
+	g.Go(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+	if _, err := g.WaitErr(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect the context error, got %v", err)
+	}
+
+	// the result is received by the next Wait
+	close(release)
+	if resp := g.Wait(context.Background(), nil); len(resp) != 1 || resp[0] != 1 {
+		t.Fatalf("unexpected responses %v", resp)
+	}
+}
+
+func TestServeSaturated(t *testing.T) {
+	release := make(chan struct{})
+	pool := wpool.New[int, int](func(r int) int {
+		<-release
+		return r
+	}, &wpool.Options{WorkersLimitMax: 1})
+	defer pool.Close()
+
+	ln, err := Listen(filepath.Join(t.TempDir(), "wpool.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go Serve[int, int](ln, pool, wpool.GobCodec[int]{}, wpool.GobCodec[int]{})
+
+	client, err := Dial[int, int](context.Background(), ln.Addr().String(), wpool.GobCodec[int]{}, wpool.GobCodec[int]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// the second task blocks the submission on the server until the worker is free
+	g := client.AcquireGroup()
+	g.Go(1)
+	g.Go(2)
+
+	// frames of other groups are still served
+	other := client.AcquireGroup()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := other.WaitErr(ctx, nil); err != nil {
+		t.Fatalf("expect the empty group is done, got %v", err)
+	}
+
+	// groups of the closed connection are canceled, queued tasks are dropped
+	client.Close()
+	deadline := time.Now().Add(time.Second)
+	for pool.Stats().Dropped == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect queued tasks are dropped, stats %+v", pool.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+}
@@ -0,0 +1,97 @@
+package wpool
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// yieldKey is the context key of the yielder of the running task
+type yieldKey struct{}
+
+// yielder is the running task, which may give the worker to queued tasks, see Yield
+type yielder interface {
+	yield()
+}
+
+// Yield is called by long-running handlers at safe points, e.g. between chunks of work.
+// It returns the context error, if the task context is done, e.g. the group is canceled, so the handler stops early.
+// If the task has run longer than Options.YieldSlice since its start or the previous yield, and tasks are queued,
+// Yield executes the next queued task in the current goroutine before returning, so a long task does not hold
+// the worker from urgent tasks: it is the soft preemption without spawning workers above the limits.
+// The yielded task is executed with its own context, its calls of Yield do not yield further.
+// Otherwise, and for handlers of pools without YieldSlice, Yield lets other goroutines run, see runtime.Gosched.
+func Yield(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if y, ok := ctx.Value(yieldKey{}).(yielder); ok {
+		y.yield()
+	} else {
+		runtime.Gosched()
+	}
+	return ctx.Err()
+}
+
+// taskYielder yields the worker of the running task to queued tasks, see Options.YieldSlice
+type taskYielder[Req any, Resp any] struct {
+	w     *Pool[Req, Resp]
+	t     *task[Req, Resp]
+	slice int64 // nanotime of the current time slice start
+}
+
+func (y *taskYielder[Req, Resp]) yield() {
+	now := nanotime()
+	if now-y.slice < int64(y.w.yieldSlice) {
+		runtime.Gosched()
+		return
+	}
+
+	y.w.mu.Lock()
+	t := y.w.dequeue()
+	if t != nil && t.dequeued != nil {
+		close(t.dequeued)
+		t.dequeued = nil
+	}
+	y.w.mu.Unlock()
+
+	if t == nil {
+		y.slice = now
+		runtime.Gosched()
+		return
+	}
+
+	y.w.runYielded(t)
+
+	// the time of the yielded task is not accounted to the yielding one
+	y.slice = nanotime()
+	y.t.busy -= y.slice - now
+}
+
+// runYielded executes the queued task inside Yield of the running task
+func (w *Pool[Req, Resp]) runYielded(t *task[Req, Resp]) {
+	t.nested = true
+
+	var r result[Req, Resp]
+	if t.group.isCanceled() {
+		w.traceDecision(ReasonDropped)
+		t.group.deadLetter(t.req)
+		t.deliverCoalesced(result[Req, Resp]{dropped: true})
+		t.group.drop()
+		w.releaseTask(t)
+		return
+	} else if now := time.Now(); !t.deadline.IsZero() && !t.deadline.After(now) {
+		w.traceDecision(ReasonDropped)
+		t.group.expireOverdue(now)
+		t.group.deadLetter(t.req)
+		r = result[Req, Resp]{index: t.index, dropped: true}
+	} else {
+		w.traceDecision(ReasonYielded)
+		r, _ = w.executeTask(t)
+		// the handler time is already in the busy time of the worker running the yielding task,
+		// so only the completion is recorded
+		w.util.shard(0).taskCompleted()
+	}
+	t.deliver(r)
+	w.releaseTask(t)
+}